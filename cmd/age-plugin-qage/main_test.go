@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+func TestMain(m *testing.M) {
+	// When age execs the test binary as age-plugin-qage, act as the plugin.
+	if filepath.Base(os.Args[0]) == "age-plugin-qage" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// installPlugin makes the test binary available as age-plugin-qage on PATH.
+func installPlugin(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin execution is not tested on Windows")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Symlink(exe, filepath.Join(dir, "age-plugin-qage")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// pluginStrings returns the age1qage1... and AGE-PLUGIN-QAGE-1... encodings
+// of a qage identity and its recipient.
+func pluginStrings(t *testing.T, id *qage.Identity) (recipient, identity string) {
+	t.Helper()
+
+	recipient, err := id.Recipient().PluginString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err = id.PluginString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recipient, identity
+}
+
+func newIdentity(t *testing.T, suite qage.Suite) *qage.Identity {
+	t.Helper()
+	id, err := qage.NewIdentityWithConfig(qage.Config{Suite: suite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func encrypt(t *testing.T, plaintext []byte, recipients ...age.Recipient) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := age.Encrypt(buf, recipients...)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(ciphertext []byte, identities ...age.Identity) ([]byte, error) {
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestPluginRoundTrip(t *testing.T) {
+	installPlugin(t)
+
+	for _, suite := range []qage.Suite{qage.HybridX25519MLKEM768, qage.HybridP384MLKEM1024} {
+		t.Run(suite.String(), func(t *testing.T) {
+			id := newIdentity(t, suite)
+			recStr, idStr := pluginStrings(t, id)
+
+			pr, err := plugin.NewRecipient(recStr, &plugin.ClientUI{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pi, err := plugin.NewIdentity(idStr, &plugin.ClientUI{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			plaintext := []byte("encrypted through age-plugin-qage")
+
+			// Encrypted by the plugin, decrypted natively.
+			out, err := decrypt(encrypt(t, plaintext, pr), id)
+			if err != nil {
+				t.Fatalf("native decrypt: %v", err)
+			}
+			if !bytes.Equal(out, plaintext) {
+				t.Fatalf("native decrypt: got %q", out)
+			}
+
+			// Encrypted natively, decrypted by the plugin.
+			out, err = decrypt(encrypt(t, plaintext, id.Recipient()), pi)
+			if err != nil {
+				t.Fatalf("plugin decrypt: %v", err)
+			}
+			if !bytes.Equal(out, plaintext) {
+				t.Fatalf("plugin decrypt: got %q", out)
+			}
+		})
+	}
+}
+
+func TestPluginLabels(t *testing.T) {
+	installPlugin(t)
+
+	id := newIdentity(t, qage.HybridX25519MLKEM768)
+	recStr, _ := pluginStrings(t, id)
+	pr, err := plugin.NewRecipient(recStr, &plugin.ClientUI{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	classical, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The postquantum label survives the plugin protocol.
+	if _, err := age.Encrypt(io.Discard, pr, id.Recipient()); err != nil {
+		t.Errorf("mixing plugin and native qage recipients: %v", err)
+	}
+	if _, err := age.Encrypt(io.Discard, pr, classical.Recipient()); err == nil {
+		t.Error("expected mixing with an X25519 recipient to fail")
+	}
+}
+
+func TestPluginWrongIdentity(t *testing.T) {
+	installPlugin(t)
+
+	id := newIdentity(t, qage.HybridX25519MLKEM768)
+	other := newIdentity(t, qage.HybridX25519MLKEM768)
+	_, otherStr := pluginStrings(t, other)
+
+	pi, err := plugin.NewIdentity(otherStr, &plugin.ClientUI{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext := encrypt(t, []byte("secret"), id.Recipient())
+	if _, err := decrypt(ciphertext, pi); err == nil {
+		t.Fatal("expected decryption with the wrong identity to fail")
+	}
+}
+
+func TestPluginErrors(t *testing.T) {
+	installPlugin(t)
+
+	// Well-formed bech32 with a payload that is not a qage recipient.
+	pr, err := plugin.NewRecipient(plugin.EncodeRecipient("qage", []byte{2, 1, 2, 3}), &plugin.ClientUI{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = age.Encrypt(io.Discard, pr)
+	if err == nil {
+		t.Fatal("expected an error for an invalid recipient")
+	}
+	if !strings.Contains(err.Error(), "invalid hybrid recipient length") {
+		t.Errorf("error does not carry the plugin message: %v", err)
+	}
+
+	pi, err := plugin.NewIdentity(plugin.EncodeIdentity("qage", []byte{9}), &plugin.ClientUI{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := newIdentity(t, qage.HybridX25519MLKEM768)
+	_, err = decrypt(encrypt(t, []byte("secret"), id.Recipient()), pi)
+	if err == nil {
+		t.Fatal("expected an error for an invalid identity")
+	}
+	if !strings.Contains(err.Error(), "unsupported suite") {
+		t.Errorf("error does not carry the plugin message: %v", err)
+	}
+}
+
+// TestRecipientV1Protocol drives the recipient-v1 state machine directly, with
+// several recipients, several file keys and a grease stanza from the client.
+func TestRecipientV1Protocol(t *testing.T) {
+	id1 := newIdentity(t, qage.HybridX25519MLKEM768)
+	id2 := newIdentity(t, qage.HybridP384MLKEM1024)
+	rec1, _ := pluginStrings(t, id1)
+	rec2, _ := pluginStrings(t, id2)
+
+	fileKeys := [][]byte{
+		bytes.Repeat([]byte{1}, 16),
+		bytes.Repeat([]byte{2}, 16),
+		bytes.Repeat([]byte{3}, 16),
+	}
+
+	c := runPlugin(t, func(p *plugin.Plugin) int { return p.RecipientV1() })
+	c.write("add-recipient", []string{rec1}, nil)
+	c.write("grease-x", []string{"qage"}, []byte("ignored"))
+	c.write("add-recipient", []string{rec2}, nil)
+	for _, fk := range fileKeys {
+		c.write("wrap-file-key", nil, fk)
+	}
+	c.write("done", nil, nil)
+
+	stanzas := make([][]*age.Stanza, len(fileKeys))
+	for _, s := range c.serve() {
+		if s.Type != "recipient-stanza" {
+			t.Fatalf("unexpected %s stanza", s.Type)
+		}
+		i, err := strconv.Atoi(s.Args[0])
+		if err != nil || i >= len(fileKeys) {
+			t.Fatalf("bad file index %q", s.Args[0])
+		}
+		stanzas[i] = append(stanzas[i], &age.Stanza{Type: s.Args[1], Args: s.Args[2:], Body: s.Body})
+	}
+	c.wait(0)
+
+	for i, fk := range fileKeys {
+		if len(stanzas[i]) != 2 {
+			t.Fatalf("file %d: got %d stanzas, want 2", i, len(stanzas[i]))
+		}
+		for _, id := range []*qage.Identity{id1, id2} {
+			got, err := id.Unwrap(stanzas[i])
+			if err != nil {
+				t.Fatalf("file %d: unwrap: %v", i, err)
+			}
+			if !bytes.Equal(got, fk) {
+				t.Fatalf("file %d: file key mismatch", i)
+			}
+		}
+	}
+}
+
+// TestIdentityV1Protocol drives the identity-v1 state machine directly, with
+// several identities and several files, one of which no identity can open.
+func TestIdentityV1Protocol(t *testing.T) {
+	id1 := newIdentity(t, qage.HybridX25519MLKEM768)
+	id2 := newIdentity(t, qage.HybridP384MLKEM1024)
+	stranger := newIdentity(t, qage.HybridX25519MLKEM768)
+	_, idStr1 := pluginStrings(t, id1)
+	_, idStr2 := pluginStrings(t, id2)
+
+	fk0 := bytes.Repeat([]byte{4}, 16)
+	fk2 := bytes.Repeat([]byte{5}, 16)
+	files := [][]*age.Stanza{
+		wrap(t, id2.Recipient(), fk0),
+		wrap(t, stranger.Recipient(), bytes.Repeat([]byte{6}, 16)),
+		append(wrap(t, stranger.Recipient(), fk2), wrap(t, id1.Recipient(), fk2)...),
+	}
+
+	c := runPlugin(t, func(p *plugin.Plugin) int { return p.IdentityV1() })
+	c.write("add-identity", []string{idStr1}, nil)
+	c.write("add-identity", []string{idStr2}, nil)
+	for i, ss := range files {
+		for _, s := range ss {
+			c.write("recipient-stanza", append([]string{fmt.Sprint(i), s.Type}, s.Args...), s.Body)
+		}
+	}
+	c.write("grease-y", nil, nil)
+	c.write("done", nil, nil)
+
+	got := map[int][]byte{}
+	for _, s := range c.serve() {
+		if s.Type != "file-key" {
+			t.Fatalf("unexpected %s stanza: %v", s.Type, s.Args)
+		}
+		i, _ := strconv.Atoi(s.Args[0])
+		got[i] = s.Body
+	}
+	c.wait(0)
+
+	if len(got) != 2 || !bytes.Equal(got[0], fk0) || !bytes.Equal(got[2], fk2) {
+		t.Fatalf("unexpected file keys: %x", got)
+	}
+}
+
+// TestIdentityV1Error checks that a stanza addressed to the identity that
+// cannot be processed is reported with an error stanza.
+func TestIdentityV1Error(t *testing.T) {
+	id := newIdentity(t, qage.HybridX25519MLKEM768)
+	_, idStr := pluginStrings(t, id)
+
+	s := wrap(t, id.Recipient(), bytes.Repeat([]byte{7}, 16))[0]
+
+	c := runPlugin(t, func(p *plugin.Plugin) int { return p.IdentityV1() })
+	c.write("add-identity", []string{idStr}, nil)
+	c.write("recipient-stanza", append([]string{"0", s.Type}, s.Args...), s.Body[:10])
+	c.write("done", nil, nil)
+
+	resp := c.serve()
+	c.wait(0)
+	if len(resp) != 1 || resp[0].Type != "error" || resp[0].Args[0] != "stanza" {
+		t.Fatalf("expected a stanza error, got %v", resp)
+	}
+	if !strings.Contains(string(resp[0].Body), "malformed stanza") {
+		t.Errorf("unexpected error message %q", resp[0].Body)
+	}
+}
+
+func TestRecipientV1Error(t *testing.T) {
+	c := runPlugin(t, func(p *plugin.Plugin) int { return p.RecipientV1() })
+	c.write("add-recipient", []string{plugin.EncodeRecipient("qage", []byte{7})}, nil)
+	c.write("wrap-file-key", nil, bytes.Repeat([]byte{8}, 16))
+	c.write("done", nil, nil)
+
+	resp := c.serve()
+	c.wait(3)
+	if len(resp) != 1 || resp[0].Type != "error" || resp[0].Args[0] != "recipient" {
+		t.Fatalf("expected a recipient error, got %v", resp)
+	}
+}
+
+func wrap(t *testing.T, r *qage.Recipient, fileKey []byte) []*age.Stanza {
+	t.Helper()
+	ss, err := r.Wrap(fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ss
+}
+
+// clientConn is a minimal age plugin client speaking to an in-process plugin.
+type clientConn struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	stderr *bytes.Buffer
+	exit   chan int
+}
+
+func runPlugin(t *testing.T, phase func(*plugin.Plugin) int) *clientConn {
+	t.Helper()
+
+	p, err := newPlugin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &clientConn{t: t, in: inW, out: bufio.NewReader(outR), stderr: &bytes.Buffer{}, exit: make(chan int, 1)}
+	p.SetIO(inR, outW, c.stderr)
+
+	go func() {
+		code := phase(p)
+		outW.Close()
+		c.exit <- code
+	}()
+	t.Cleanup(func() { inW.Close() })
+
+	return c
+}
+
+// write sends a stanza, with its body wrapped at 64 columns as in the age
+// header format.
+func (c *clientConn) write(typ string, args []string, body []byte) {
+	c.t.Helper()
+	var b strings.Builder
+	b.WriteString("-> " + strings.Join(append([]string{typ}, args...), " ") + "\n")
+	enc := base64.RawStdEncoding.EncodeToString(body)
+	for len(enc) >= 64 {
+		b.WriteString(enc[:64] + "\n")
+		enc = enc[64:]
+	}
+	b.WriteString(enc + "\n")
+	if _, err := io.WriteString(c.in, b.String()); err != nil {
+		c.t.Fatalf("write %s: %v", typ, err)
+	}
+}
+
+// read returns the next stanza from the plugin, or nil if the plugin closed
+// the connection.
+func (c *clientConn) read() *age.Stanza {
+	c.t.Helper()
+	line, err := c.out.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return nil
+	}
+	if err != nil {
+		c.t.Fatalf("read stanza: %v (stderr: %s)", err, c.stderr)
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "-> "))
+	if !strings.HasPrefix(line, "-> ") || len(fields) == 0 {
+		c.t.Fatalf("malformed stanza line %q", line)
+	}
+
+	s := &age.Stanza{Type: fields[0], Args: fields[1:]}
+	for {
+		line, err := c.out.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("read stanza body: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		b, err := base64.RawStdEncoding.DecodeString(line)
+		if err != nil {
+			c.t.Fatalf("decode stanza body: %v", err)
+		}
+		s.Body = append(s.Body, b...)
+		if len(line) < 64 {
+			return s
+		}
+	}
+}
+
+// serve answers the plugin until it sends done or exits, acknowledging
+// results and errors and rejecting grease. It returns every stanza it
+// acknowledged.
+func (c *clientConn) serve() []*age.Stanza {
+	c.t.Helper()
+	var got []*age.Stanza
+	for {
+		s := c.read()
+		if s == nil {
+			return got
+		}
+		switch s.Type {
+		case "done":
+			return got
+		case "recipient-stanza", "file-key", "error":
+			got = append(got, s)
+			c.write("ok", nil, nil)
+		default:
+			c.write("unsupported", nil, nil)
+		}
+	}
+}
+
+func (c *clientConn) wait(want int) {
+	c.t.Helper()
+	if code := <-c.exit; code != want {
+		c.t.Fatalf("plugin exited with %d, want %d (stderr: %s)", code, want, c.stderr)
+	}
+}
+
+// TestRecipientV1Identity checks that identities can be used as recipients.
+func TestRecipientV1Identity(t *testing.T) {
+	id := newIdentity(t, qage.HybridX25519MLKEM768)
+	_, idStr := pluginStrings(t, id)
+	fk := bytes.Repeat([]byte{9}, 16)
+
+	c := runPlugin(t, func(p *plugin.Plugin) int { return p.RecipientV1() })
+	c.write("add-identity", []string{idStr}, nil)
+	c.write("wrap-file-key", nil, fk)
+	c.write("done", nil, nil)
+
+	resp := c.serve()
+	c.wait(0)
+	if len(resp) != 1 || resp[0].Type != "recipient-stanza" {
+		t.Fatalf("expected one recipient stanza, got %v", resp)
+	}
+	s := &age.Stanza{Type: resp[0].Args[1], Args: resp[0].Args[2:], Body: resp[0].Body}
+	got, err := id.Unwrap([]*age.Stanza{s})
+	if err != nil {
+		t.Fatalf("unwrap: %v", err)
+	}
+	if !bytes.Equal(got, fk) {
+		t.Fatal("file key mismatch")
+	}
+}
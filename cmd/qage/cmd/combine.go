@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+var combineCmd = &cobra.Command{
+	Use:   "combine [SHARES...]",
+	Short: "Rebuild an identity from its shares",
+	Long: `Rebuild an identity split with split from at least as many shares as its
+threshold. Shares are read from the given files, or from stdin if none are
+given, one per line; blank lines and comments are ignored.
+
+The rebuilt identity is checked against the fingerprint carried by the
+shares, so shares of different identities or corrupted shares are reported
+instead of yielding a wrong key.
+
+The identity is printed to stdout unless -o is specified.`,
+	Example: `  # Rebuild a key from three shares
+  qage combine alice.share bob.share carol.share -o recovery.key
+
+  # Paste the shares at the prompt
+  qage combine -o recovery.key`,
+	RunE: runCombine,
+}
+
+var (
+	combineOutput  string
+	combineComment string
+	combinePlugin  bool
+)
+
+func init() {
+	combineCmd.Flags().StringVarP(&combineOutput, "output", "o", "", "output file (default: stdout)")
+	combineCmd.Flags().StringVarP(&combineComment, "comment", "c", "", "comment for the key")
+	combineCmd.Flags().BoolVar(&combinePlugin, "plugin-identity", false, "write the identity in the age plugin encoding (AGE-PLUGIN-QAGE-1...)")
+}
+
+func runCombine(cmd *cobra.Command, args []string) error {
+	var shares []string
+	if len(args) == 0 {
+		in := cmd.InOrStdin()
+		if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			fmt.Fprintln(cmd.ErrOrStderr(), "Enter the shares, one per line, then press Ctrl-D:")
+		}
+		s, err := readShares(in)
+		if err != nil {
+			return err
+		}
+		shares = s
+	}
+	for _, name := range args {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to open share file: %w", err)
+		}
+		s, err := readShares(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		shares = append(shares, s...)
+	}
+	if len(shares) == 0 {
+		return errors.New("no shares given")
+	}
+
+	identity, err := qage.CombineShares(shares)
+	if err != nil {
+		return err
+	}
+
+	var formatted string
+	if combinePlugin {
+		formatted, err = formatPluginIdentity(identity, combineComment)
+	} else {
+		formatted, err = identity.FormatFile(combineComment)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to format identity: %w", err)
+	}
+
+	w, closeOut, err := openSecretOutput(cmd, combineOutput)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	if _, err := fmt.Fprintln(w, formatted); err != nil {
+		return err
+	}
+	printVerification(cmd.ErrOrStderr(), identity.Recipient())
+	return nil
+}
+
+// readShares reads the shares in r, one per line, skipping blank lines and
+// comments.
+func readShares(r io.Reader) ([]string, error) {
+	var shares []string
+	scanner := bufio.NewScanner(io.LimitReader(r, 1<<20))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		shares = append(shares, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read shares: %w", err)
+	}
+	return shares, nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert qage identities to age hybrid identities",
+	Long: `Convert the identities in an identity file to age's native post-quantum
+hybrid format (AGE-SECRET-KEY-PQ-1...), so that the same keys can be used
+with age alone. Files encrypted to the age1pq1 recipient printed with each
+converted identity decrypt with both age and the original qage identity;
+files encrypted to the qage1 recipient still need qage or age-plugin-qage.
+
+Only identities whose key material age can represent are converted: compact
+X25519 + ML-KEM-768 identities with a 32-byte seed, as generated by keygen,
+which age expands to the same keys. Identities that predate the compact
+format only store the expanded keys, from which the seed can't be recovered,
+and age doesn't support P-384 + ML-KEM-1024 or legacy Kyber768 identities;
+convert then explains why and writes nothing. age hybrid identities are
+copied unchanged.
+
+The result is printed to stdout unless -o is specified.`,
+	Example: `  # Convert a key for use with age
+  qage convert -i ~/.qage/key -o ~/.age/key`,
+	Args: cobra.NoArgs,
+	RunE: runConvert,
+}
+
+var (
+	convertIdentity string
+	convertOutput   string
+)
+
+func init() {
+	convertCmd.Flags().StringVarP(&convertIdentity, "identity", "i", "-", "identity file ('-' for stdin)")
+	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "output file (default: stdout)")
+}
+
+func runConvert(cmd *cobra.Command, args []string) error {
+	identities, err := loadIdentities(cmd, convertIdentity)
+	if err != nil {
+		return err
+	}
+
+	// Convert every identity before writing any of them
+	var b strings.Builder
+	for i, identity := range identities {
+		var comment string
+		var hid *age.HybridIdentity
+		switch id := identity.(type) {
+		case *qage.Identity:
+			comment = id.Comment()
+			hid, err = id.HybridIdentity()
+		case *age.HybridIdentity:
+			hid = id
+		case *age.X25519Identity:
+			err = errors.New("classical age X25519 identities have no post-quantum equivalent")
+		default:
+			err = fmt.Errorf("unsupported identity type %T", identity)
+		}
+		if err != nil {
+			return fmt.Errorf("can't convert identity %d: %w", i+1, err)
+		}
+
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if comment != "" {
+			fmt.Fprintf(&b, "# %s\n", comment)
+		}
+		fmt.Fprintf(&b, "# public key: %s\n", hid.Recipient())
+		fmt.Fprintf(&b, "%s\n", hid)
+	}
+
+	w, closeOut, err := openSecretOutput(cmd, convertOutput)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	_, err = w.Write([]byte(b.String()))
+	return err
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/spf13/cobra"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt [file]",
+	Short: "Decrypt a file with qage and age identities",
+	Long: `Decrypt a file, or stdin, with one or more identity files.
+
+Identity files can contain qage identities (QAGE-SECRET-KEY-1 or
+AGE-PLUGIN-QAGE-1...) and native age hybrid and X25519 identities
+(AGE-SECRET-KEY-PQ-1... and AGE-SECRET-KEY-1...), or be an SSH private key.
+Identity files encrypted with keygen --passphrase are unlocked with a
+passphrase prompt, or $QAGE_PASSPHRASE or $QAGE_PASSPHRASE_FD. Without -i,
+a file encrypted with encrypt --passphrase is decrypted with a passphrase.
+ASCII-armored input is detected automatically. Files encrypted with
+encrypt --threshold are decrypted by combining the shares of all the qage
+identities given.
+
+The output is written to stdout unless -o is specified.`,
+	Example: `  # Decrypt with a qage identity
+  qage decrypt -i key.txt -o secret.txt secret.age
+
+  # Decrypt a threshold file with the keys of two officers
+  qage decrypt -i alice.key -i bob.key -o secret.txt secret.age
+
+  # Try several identities, streaming stdin to stdout
+  qage decrypt -i key.txt -i ~/.ssh/id_ed25519 < secret.age > secret.txt`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runDecrypt,
+}
+
+var (
+	decryptIdentities []string
+	decryptOutput     string
+)
+
+func init() {
+	decryptCmd.Flags().StringArrayVarP(&decryptIdentities, "identity", "i", nil, "identity file to decrypt with (can be repeated)")
+	decryptCmd.Flags().StringVarP(&decryptOutput, "output", "o", "", "output file (default: stdout)")
+}
+
+func runDecrypt(cmd *cobra.Command, args []string) error {
+	var identities []age.Identity
+	for _, name := range decryptIdentities {
+		ids, err := loadIdentities(cmd, name)
+		if err != nil {
+			return err
+		}
+		identities = append(identities, ids...)
+	}
+	identities = groupQageIdentities(identities)
+
+	in, closeIn, err := openInput(cmd, args)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	src := bufio.NewReader(in)
+	var ciphertext io.Reader = src
+	if start, _ := src.Peek(len(armor.Header)); string(start) == armor.Header {
+		ciphertext = armor.NewReader(src)
+	}
+
+	if len(identities) == 0 {
+		// Only prompt for a passphrase if the file was encrypted with one
+		hdr, rest, err := readHeader(ciphertext)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt: %w", err)
+		}
+		if !slices.ContainsFunc(hdr.Stanzas, func(s *age.Stanza) bool { return s.Type == "scrypt" }) {
+			return errors.New("the file is not encrypted with a passphrase, use -i to decrypt it with an identity")
+		}
+		ciphertext = rest
+
+		pass, err := readPassphrase("Enter passphrase")
+		if err != nil {
+			return err
+		}
+		id, err := age.NewScryptIdentity(pass)
+		if err != nil {
+			return err
+		}
+		identities = append(identities, id)
+	}
+
+	r, err := age.Decrypt(ciphertext, identities...)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	out, closeOut, err := openOutput(cmd, decryptOutput)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	if _, err := io.Copy(out, r); err != nil {
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return nil
+}
+
+// groupQageIdentities replaces the qage identities among identities with a
+// single ThresholdIdentity holding all of them, which unwraps their own
+// stanzas as well as threshold shares addressed to several of them.
+func groupQageIdentities(identities []age.Identity) []age.Identity {
+	var qageIdentities []*qage.Identity
+	var others []age.Identity
+	for _, i := range identities {
+		if id, ok := i.(*qage.Identity); ok {
+			qageIdentities = append(qageIdentities, id)
+		} else {
+			others = append(others, i)
+		}
+	}
+	if len(qageIdentities) == 0 {
+		return identities
+	}
+	return append([]age.Identity{qage.NewThresholdIdentity(qageIdentities...)}, others...)
+}
@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/spf13/cobra"
+
+	"github.com/zlobste/qage/internal/format"
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt [file]",
+	Short: "Encrypt a file to qage and age recipients",
+	Long: `Encrypt a file, or stdin, to one or more recipients.
+
+Recipients can be qage recipients (qage1... or age1qage1...), native age
+hybrid and X25519 recipients (age1pq1... and age1...) and SSH public keys
+(ssh-ed25519, ssh-rsa), in any combination, with one exception: qage and age
+hybrid recipients are post-quantum and are not mixed with classical ones (age
+X25519 and SSH keys) unless --allow-classical is given, since anyone who
+breaks the classical recipient could decrypt the file. With --passphrase the
+file is encrypted with a passphrase instead, which cannot be combined with
+recipients.
+
+With --threshold k, the file key is split across the recipients, which must
+all be qage recipients, so that the file can only be decrypted with the
+identities of k of them together, passed to decrypt with -i.
+
+qage stanzas are anonymous: whoever decrypts tries each of their keys on
+each stanza. With --key-hint, every qage stanza is tagged with a short hint
+keyed by its recipient, so that holders of many keys skip the stanzas of
+others at no cost. The hint differs from file to file, but reveals to anyone
+who has a recipient which files are encrypted to it, and files with hints
+can't be decrypted by releases of qage that predate them.
+
+The output is written to stdout unless -o is specified.`,
+	Example: `  # Encrypt to a qage recipient
+  qage encrypt -r $(qage pub -i key.txt) -o secret.age secret.txt
+
+  # Mix qage, age and SSH recipients from a file
+  qage encrypt --allow-classical -R recipients.txt -r age1... < secret.txt > secret.age
+
+  # Require two of three officers to decrypt
+  qage encrypt --threshold 2 -r qage1... -r qage1... -r qage1... secret.txt
+
+  # ASCII-armored output
+  qage encrypt --armor -r qage1... secret.txt`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runEncrypt,
+}
+
+var (
+	encryptRecipients     []string
+	encryptRecipientFiles []string
+	encryptOutput         string
+	encryptArmor          bool
+	encryptPassphrase     bool
+	encryptAllowClassical bool
+	encryptThreshold      int
+	encryptKeyHint        bool
+)
+
+func init() {
+	encryptCmd.Flags().StringArrayVarP(&encryptRecipients, "recipient", "r", nil, "recipient to encrypt to (can be repeated)")
+	encryptCmd.Flags().StringArrayVarP(&encryptRecipientFiles, "recipients-file", "R", nil, "file with one recipient per line (can be repeated)")
+	encryptCmd.Flags().StringVarP(&encryptOutput, "output", "o", "", "output file (default: stdout)")
+	encryptCmd.Flags().BoolVarP(&encryptArmor, "armor", "a", false, "write ASCII-armored output")
+	encryptCmd.Flags().BoolVarP(&encryptPassphrase, "passphrase", "p", false, "encrypt with a passphrase")
+	encryptCmd.Flags().BoolVar(&encryptAllowClassical, "allow-classical", false, "allow mixing post-quantum recipients with classical ones")
+	encryptCmd.Flags().IntVar(&encryptThreshold, "threshold", 0, "require the identities of this many recipients to decrypt")
+	encryptCmd.Flags().BoolVar(&encryptKeyHint, "key-hint", false, "tag qage stanzas with a hint of their recipient, for faster decryption")
+}
+
+func runEncrypt(cmd *cobra.Command, args []string) error {
+	recipients, err := loadRecipients(encryptRecipients, encryptRecipientFiles, encryptAllowClassical)
+	if err != nil {
+		return err
+	}
+	if encryptKeyHint {
+		recipients = withKeyHints(recipients)
+	}
+
+	if encryptThreshold != 0 {
+		r, err := thresholdRecipient(recipients)
+		if err != nil {
+			return err
+		}
+		recipients = []age.Recipient{r}
+	}
+
+	if encryptPassphrase {
+		if len(recipients) > 0 {
+			return errors.New("--passphrase can't be combined with recipients")
+		}
+		pass, err := readNewPassphrase()
+		if err != nil {
+			return err
+		}
+		r, err := age.NewScryptRecipient(pass)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, r)
+	}
+
+	if len(recipients) == 0 {
+		return errors.New("no recipients specified, use -r, -R or --passphrase")
+	}
+
+	in, closeIn, err := openInput(cmd, args)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	out, closeOut, err := openOutput(cmd, encryptOutput)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	var dst io.Writer = out
+	var armorWriter io.WriteCloser
+	if encryptArmor {
+		armorWriter = armor.NewWriter(out)
+		dst = armorWriter
+	}
+
+	w, err := age.Encrypt(dst, recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if armorWriter != nil {
+		if err := armorWriter.Close(); err != nil {
+			return fmt.Errorf("failed to write armor: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// loadRecipients parses the recipients given with -r and -R. With
+// allowClassical, post-quantum recipients drop their label so that they can be
+// mixed with classical ones.
+func loadRecipients(args, files []string, allowClassical bool) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, arg := range args {
+		r, err := qage.ParseRecipientLine(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", arg, err)
+		}
+		recipients = append(recipients, r)
+	}
+	for _, name := range files {
+		rs, err := readRecipientsFile(name)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, rs...)
+	}
+
+	if allowClassical {
+		for i, r := range recipients {
+			switch r := r.(type) {
+			case *qage.Recipient:
+				recipients[i] = r.AllowClassical()
+			case *age.HybridRecipient:
+				recipients[i] = unlabeledRecipient{r}
+			}
+		}
+	}
+	return recipients, nil
+}
+
+// thresholdRecipient splits the file key across recipients with --threshold.
+func thresholdRecipient(recipients []age.Recipient) (*qage.ThresholdRecipient, error) {
+	qageRecipients := make([]*qage.Recipient, len(recipients))
+	for i, r := range recipients {
+		switch r := r.(type) {
+		case *qage.Recipient:
+			qageRecipients[i] = r
+		case *age.HybridRecipient, unlabeledRecipient:
+			return nil, errors.New("--threshold only supports qage recipients, not age1pq1 ones")
+		default:
+			return nil, fmt.Errorf("--threshold only supports qage recipients, not %T", r)
+		}
+	}
+	if encryptThreshold < 2 || encryptThreshold > len(recipients) {
+		return nil, fmt.Errorf("--threshold %d needs between 2 and %d, the number of recipients", encryptThreshold, len(recipients))
+	}
+	return qage.NewThresholdRecipient(encryptThreshold, qageRecipients...)
+}
+
+// withKeyHints makes the qage recipients among recipients tag their stanzas
+// with a key hint.
+func withKeyHints(recipients []age.Recipient) []age.Recipient {
+	for i, r := range recipients {
+		if r, ok := r.(*qage.Recipient); ok {
+			recipients[i] = r.WithKeyHint()
+		}
+	}
+	return recipients
+}
+
+// unlabeledRecipient hides the WrapWithLabels method of a recipient, and with
+// it the postquantum label, so that age lets it be mixed with classical ones.
+type unlabeledRecipient struct {
+	age.Recipient
+}
+
+// readRecipientsFile reads every recipient in a recipients file.
+func readRecipientsFile(name string) ([]age.Recipient, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recipients file: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to close file: %v\n", closeErr)
+		}
+	}()
+
+	recipients, err := qage.ParseRecipients(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipients file %s: %w", name, err)
+	}
+
+	return recipients, nil
+}
+
+// openInput opens the file named by args, or stdin if there is none or it is
+// "-".
+func openInput(cmd *cobra.Command, args []string) (io.Reader, func(), error) {
+	if len(args) == 0 || args[0] == "-" {
+		return cmd.InOrStdin(), func() {}, nil
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	return f, func() {
+		if closeErr := f.Close(); closeErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to close file: %v\n", closeErr)
+		}
+	}, nil
+}
+
+// readHeader reads the header of the age file in r, which must not be
+// armored, and returns it with a reader of the whole file, header included.
+func readHeader(r io.Reader) (*format.Header, io.Reader, error) {
+	hdr, payload, err := format.Parse(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	var header bytes.Buffer
+	if err := hdr.Marshal(&header); err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	return hdr, io.MultiReader(&header, payload), nil
+}
+
+// openOutput creates the named file, or returns stdout if name is empty or
+// "-".
+func openOutput(cmd *cobra.Command, name string) (io.Writer, func(), error) {
+	if name == "" || name == "-" {
+		return cmd.OutOrStdout(), func() {}, nil
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return f, func() {
+		if closeErr := f.Close(); closeErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to close file: %v\n", closeErr)
+		}
+	}, nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+var fingerprintCmd = &cobra.Command{
+	Use:   "fingerprint [RECIPIENTS...]",
+	Short: "Show the fingerprint of recipients",
+	Long: `Show the fingerprint, verification words and randomart of qage recipients,
+given as arguments or read from recipients files with -R, or from stdin if
+neither is given.
+
+Recipients are too long to compare by eye. Before encrypting to a recipient
+received by email or chat, ask its owner to read out the verification words
+printed by qage pub --fingerprint, inspect or keygen, and check that they
+match. The fingerprint is the same for the qage1... and age1qage1...
+encodings.`,
+	Example: `  # Check a recipient received by email
+  qage fingerprint qage1...
+
+  # List the fingerprints of a team
+  qage fingerprint -R team.txt`,
+	RunE: runFingerprint,
+}
+
+var fingerprintRecipientFiles []string
+
+func init() {
+	fingerprintCmd.Flags().StringArrayVarP(&fingerprintRecipientFiles, "recipients-file", "R", nil, "file with recipients, one per line (can be repeated)")
+}
+
+// fingerprintResult is the JSON output of fingerprint.
+type fingerprintResult struct {
+	SchemaVersion int        `json:"schema_version"`
+	Recipients    []*keyInfo `json:"recipients"`
+}
+
+func runFingerprint(cmd *cobra.Command, args []string) error {
+	var recipients []age.Recipient
+	if len(args) == 0 && len(fingerprintRecipientFiles) == 0 {
+		rs, err := qage.ParseRecipients(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("failed to read recipients: %w", err)
+		}
+		recipients = rs
+	} else {
+		rs, err := loadRecipients(args, fingerprintRecipientFiles, false)
+		if err != nil {
+			return err
+		}
+		recipients = rs
+	}
+
+	qageRecipients := make([]*qage.Recipient, len(recipients))
+	for i, r := range recipients {
+		qr, ok := r.(*qage.Recipient)
+		if !ok {
+			return fmt.Errorf("only qage recipients have fingerprints, not %T", r)
+		}
+		qageRecipients[i] = qr
+	}
+
+	w := cmd.OutOrStdout()
+	if jsonOutput() {
+		result := fingerprintResult{SchemaVersion: schemaVersion, Recipients: []*keyInfo{}}
+		for _, r := range qageRecipients {
+			info, err := describeRecipient(r)
+			if err != nil {
+				return err
+			}
+			result.Recipients = append(result.Recipients, info)
+		}
+		return writeJSON(w, result)
+	}
+
+	for i, r := range qageRecipients {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if len(qageRecipients) > 1 {
+			fmt.Fprintf(w, "Recipient %d: %s\n", i+1, r.Suite())
+		}
+		printVerification(w, r)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+// readIdentityFile reads an identity file, decrypting it first if it is
+// wrapped in a passphrase-encrypted age envelope, armored or not, as written
+// by keygen --passphrase. name is only used in prompts and errors.
+func readIdentityFile(r io.Reader, name string) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, qage.IdentityFileSizeLimit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity file: %w", err)
+	}
+
+	var src io.Reader
+	switch {
+	case bytes.HasPrefix(data, []byte("age-encryption.org/")):
+		src = bytes.NewReader(data)
+	case bytes.HasPrefix(data, []byte(armor.Header)):
+		src = armor.NewReader(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+
+	pass, err := readPassphrase(fmt.Sprintf("Enter passphrase for identity file %s", name))
+	if err != nil {
+		return nil, err
+	}
+	id, err := age.NewScryptIdentity(pass)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := age.Decrypt(src, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt identity file %s: %w", name, err)
+	}
+	data, err = io.ReadAll(dec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt identity file %s: %w", name, err)
+	}
+
+	return data, nil
+}
+
+// encryptIdentityFile wraps the contents of an identity file in a
+// passphrase-encrypted age envelope, optionally armored.
+func encryptIdentityFile(data []byte, passphrase string, armored bool) ([]byte, error) {
+	r, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	var dst io.Writer = buf
+	var armorWriter io.WriteCloser
+	if armored {
+		armorWriter = armor.NewWriter(buf)
+		dst = armorWriter
+	}
+
+	w, err := age.Encrypt(dst, r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if armorWriter != nil {
+		if err := armorWriter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// loadIdentities reads the identities in the identity file given by an -i
+// flag, '-' meaning stdin: either an SSH private key, or qage and age
+// identities, one per line, possibly in a passphrase-encrypted envelope.
+func loadIdentities(cmd *cobra.Command, flag string) ([]age.Identity, error) {
+	r := cmd.InOrStdin()
+	if flag != "-" {
+		f, err := os.Open(flag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open identity file: %w", err)
+		}
+		defer func() {
+			if closeErr := f.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close file: %v\n", closeErr)
+			}
+		}()
+		r = f
+	}
+
+	name := identityFileName(flag)
+	data, err := readIdentityFile(r, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte("-----BEGIN")) {
+		id, err := parseSSHIdentity(name, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH identity %s: %w", name, err)
+		}
+		return []age.Identity{id}, nil
+	}
+
+	ids, err := qage.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity file %s: %w", name, err)
+	}
+	return ids, nil
+}
+
+// parseSSHIdentity parses an SSH private key, prompting for its passphrase
+// when a stanza for it is found if the key is encrypted.
+func parseSSHIdentity(name string, pemBytes []byte) (age.Identity, error) {
+	id, err := agessh.ParseIdentity(pemBytes)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return id, err
+	}
+	if missing.PublicKey == nil {
+		return nil, errors.New("encrypted key without an embedded public key")
+	}
+
+	return agessh.NewEncryptedSSHIdentity(missing.PublicKey, pemBytes, func() ([]byte, error) {
+		pass, err := readPassphrase(fmt.Sprintf("Enter passphrase for %s", name))
+		return []byte(pass), err
+	})
+}
+
+// identityFileName describes the identity file given by an -i flag in prompts
+// and errors.
+func identityFileName(flag string) string {
+	if flag == "-" {
+		return "from standard input"
+	}
+	return flag
+}
+
+// openSecretOutput creates the named file for secret keys, with its parent
+// directories, refusing to overwrite an existing file. It returns stdout if
+// name is empty.
+func openSecretOutput(cmd *cobra.Command, name string) (io.Writer, func(), error) {
+	if name == "" {
+		return cmd.OutOrStdout(), func() {}, nil
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return f, func() {
+		if closeErr := f.Close(); closeErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to close file: %v\n", closeErr)
+		}
+	}, nil
+}
@@ -1,12 +1,10 @@
 package cmd
 
 import (
-	"bufio"
 	"fmt"
 	"io"
-	"os"
-	"strings"
 
+	"filippo.io/age"
 	"github.com/spf13/cobra"
 
 	"github.com/zlobste/qage/pkg/qage"
@@ -15,13 +13,19 @@ import (
 var inspectCmd = &cobra.Command{
 	Use:   "inspect",
 	Short: "Show identity metadata",
-	Long: `Show metadata about a qage identity including the cryptographic suite,
-key lengths, and public recipient.`,
+	Long: `Show metadata about every identity in an identity file, including the
+cryptographic suite, key lengths, and public recipient, followed by the
+fingerprint of the recipient, its verification words and randomart.
+
+With --format json, the same is printed as a JSON object for scripts.`,
 	Example: `  # Inspect from file
   qage inspect -i ~/.qage/key
 
   # Inspect from stdin
-  cat ~/.qage/key | qage inspect`,
+  cat ~/.qage/key | qage inspect
+
+  # Machine-readable output
+  qage inspect --format json -i ~/.qage/key`,
 	RunE: runInspect,
 }
 
@@ -31,93 +35,88 @@ func init() {
 	inspectCmd.Flags().StringVarP(&inspectIdentity, "identity", "i", "-", "identity file ('-' for stdin)")
 }
 
+// inspectResult is the JSON output of inspect.
+type inspectResult struct {
+	SchemaVersion int        `json:"schema_version"`
+	Identities    []*keyInfo `json:"identities"`
+}
+
 func runInspect(cmd *cobra.Command, args []string) error {
-	identity, comment, err := readIdentity()
+	identities, err := loadIdentities(cmd, inspectIdentity)
 	if err != nil {
 		return err
 	}
 
-	return displayIdentityInfo(identity, comment)
-}
-
-func readIdentity() (*qage.Identity, string, error) {
-	// Read identity
-	var r io.Reader = os.Stdin
-	if inspectIdentity != "-" {
-		f, err := os.Open(inspectIdentity)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to open identity file: %w", err)
-		}
-		defer func() {
-			if closeErr := f.Close(); closeErr != nil {
-				// Log error but don't override main error
-				fmt.Fprintf(os.Stderr, "Warning: failed to close file: %v\n", closeErr)
+	w := cmd.OutOrStdout()
+	if jsonOutput() {
+		result := inspectResult{SchemaVersion: schemaVersion, Identities: []*keyInfo{}}
+		for _, identity := range identities {
+			info, err := describeIdentity(identity, false)
+			if err != nil {
+				return err
 			}
-		}()
-		r = f
+			result.Identities = append(result.Identities, info)
+		}
+		return writeJSON(w, result)
 	}
 
-	// Read first non-empty, non-comment line
-	scanner := bufio.NewScanner(r)
-	var identityLine string
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "#") {
-			identityLine = line
-			break
+	for i, identity := range identities {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if err := displayIdentityInfo(w, identity); err != nil {
+			return err
 		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, "", fmt.Errorf("failed to read identity: %w", err)
-	}
-	if identityLine == "" {
-		return nil, "", fmt.Errorf("no identity found in input")
 	}
 
-	// Parse identity
-	var identity *qage.Identity
-	var comment string
-	var err error
+	return nil
+}
 
-	if strings.HasPrefix(identityLine, "QAGE-SECRET-KEY-1 ") {
-		// File format
-		identity, comment, err = qage.ParseIdentityFile(identityLine)
-	} else {
-		// Direct bech32
-		identity, err = qage.ParseIdentity(identityLine)
+func displayIdentityInfo(w io.Writer, identity age.Identity) error {
+	switch id := identity.(type) {
+	case *age.X25519Identity:
+		fmt.Fprintf(w, "Type: age X25519 identity\n")
+		fmt.Fprintf(w, "Public recipient: %s\n", id.Recipient())
+		return nil
+	case *age.HybridIdentity:
+		fmt.Fprintf(w, "Type: age hybrid identity (ML-KEM-768 + X25519)\n")
+		fmt.Fprintf(w, "Public recipient: %s\n", id.Recipient())
+		return nil
 	}
 
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to parse identity: %w", err)
+	qid, ok := identity.(*qage.Identity)
+	if !ok {
+		return fmt.Errorf("unsupported identity type %T", identity)
 	}
 
-	return identity, comment, nil
-}
-
-func displayIdentityInfo(identity *qage.Identity, comment string) error {
 	// Show metadata
-	fmt.Printf("Type: qage identity\n")
-	fmt.Printf("Suite: %s\n", identity.Suite())
-	if comment != "" {
-		fmt.Printf("Comment: %s\n", comment)
+	fmt.Fprintf(w, "Type: qage identity\n")
+	fmt.Fprintf(w, "Suite: %s\n", qid.Suite())
+	if qid.Compact() {
+		fmt.Fprintf(w, "Format: compact (seed)\n")
+	} else {
+		fmt.Fprintf(w, "Format: expanded keys\n")
+	}
+	if comment := qid.Comment(); comment != "" {
+		fmt.Fprintf(w, "Comment: %s\n", comment)
 	}
 
 	// Get recipient
-	recipient := identity.Recipient()
-	recipientStr, err := recipient.String()
+	recipientStr, err := recipientString(qid, false)
 	if err != nil {
 		return fmt.Errorf("failed to encode recipient: %w", err)
 	}
 
-	fmt.Printf("Public recipient: %s\n", recipientStr)
-	fmt.Printf("Recipient length: %d characters\n", len(recipientStr))
+	fmt.Fprintf(w, "Public recipient: %s\n", recipientStr)
+	fmt.Fprintf(w, "Recipient length: %d characters\n", len(recipientStr))
 
 	// Get identity string
-	identityStr, err := identity.String()
+	identityStr, err := qid.String()
 	if err != nil {
 		return fmt.Errorf("failed to encode identity: %w", err)
 	}
-	fmt.Printf("Identity length: %d characters\n", len(identityStr))
+	fmt.Fprintf(w, "Identity length: %d characters\n", len(identityStr))
+	printVerification(w, qid.Recipient())
 
 	return nil
 }
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage identity files",
+	Long:  `Commands that rewrite existing identity files.`,
+}
+
+var keyCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Rewrite identities in the compact seed format",
+	Long: `Rewrite the identities in an identity file in the compact format, which
+stores a 32- or 64-byte seed instead of the expanded secret keys and makes
+for a line of about 85 characters instead of about 3900.
+
+This doesn't migrate old keys. Identities generated by releases before the
+compact format only stored their expanded keys, from which the seed can't be
+recovered, so they can't be compacted: they are kept as they are, with a
+warning, and compact fails if no identity in the file has a seed. To move to
+compact keys, generate a new key with keygen and rekey your files to its
+recipient instead.
+
+Identities generated since then are written in the compact format already,
+so compact only re-encodes them, for example in the age plugin encoding with
+--plugin-identity, or passphrase-protected with --passphrase. Other
+identities in the file are copied unchanged; comment lines are dropped.
+
+The result is printed to stdout unless -o is specified.`,
+	Example: `  # Rewrite a key file in the age plugin encoding
+  qage key compact -i ~/.qage/key --plugin-identity -o ~/.qage/key.plugin
+
+  # Passphrase-protect a key file
+  qage key compact -i ~/.qage/key --passphrase -o ~/.qage/key.protected`,
+	Args: cobra.NoArgs,
+	RunE: runKeyCompact,
+}
+
+var (
+	keyCompactIdentity string
+	keyCompactOutput   string
+	keyCompactPlugin   bool
+	keyCompactPass     bool
+	keyCompactArmor    bool
+)
+
+func init() {
+	keyCompactCmd.Flags().StringVarP(&keyCompactIdentity, "identity", "i", "-", "identity file ('-' for stdin)")
+	keyCompactCmd.Flags().StringVarP(&keyCompactOutput, "output", "o", "", "output file (default: stdout)")
+	keyCompactCmd.Flags().BoolVar(&keyCompactPlugin, "plugin-identity", false, "write qage identities in the age plugin encoding (AGE-PLUGIN-QAGE-1...)")
+	keyCompactCmd.Flags().BoolVarP(&keyCompactPass, "passphrase", "p", false, "encrypt the identity file with a passphrase")
+	keyCompactCmd.Flags().BoolVarP(&keyCompactArmor, "armor", "a", false, "ASCII-armor the encrypted identity file (with --passphrase)")
+
+	keyCmd.AddCommand(keyCompactCmd)
+}
+
+func runKeyCompact(cmd *cobra.Command, args []string) error {
+	if keyCompactArmor && !keyCompactPass {
+		return fmt.Errorf("--armor requires --passphrase")
+	}
+
+	identities, err := loadIdentities(cmd, keyCompactIdentity)
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	var compact int
+	for i, identity := range identities {
+		var line string
+		switch id := identity.(type) {
+		case *qage.Identity:
+			if id.Compact() {
+				compact++
+			} else {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: identity %d predates the compact format and stores no seed, keeping it as is\n", i+1)
+			}
+			if keyCompactPlugin {
+				line, err = formatPluginIdentity(id, id.Comment())
+			} else {
+				line, err = id.FormatFile(id.Comment())
+			}
+			if err != nil {
+				return fmt.Errorf("failed to format identity %d: %w", i+1, err)
+			}
+		case *age.HybridIdentity:
+			line = id.String()
+		case *age.X25519Identity:
+			line = id.String()
+		default:
+			return fmt.Errorf("unsupported identity type %T", identity)
+		}
+		lines = append(lines, line)
+	}
+	if compact == 0 {
+		return errors.New("no qage identity in the file can be written in the compact format; generate a new key with keygen and rekey files to it")
+	}
+
+	contents := []byte(strings.Join(lines, "\n") + "\n")
+	if keyCompactPass {
+		pass, err := readNewPassphrase()
+		if err != nil {
+			return err
+		}
+		if contents, err = encryptIdentityFile(contents, pass, keyCompactArmor); err != nil {
+			return fmt.Errorf("failed to encrypt identity: %w", err)
+		}
+	}
+
+	w, closeOut, err := openSecretOutput(cmd, keyCompactOutput)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	_, err = w.Write(contents)
+	return err
+}
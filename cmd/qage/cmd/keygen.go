@@ -2,8 +2,9 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -15,58 +16,255 @@ var keygenCmd = &cobra.Command{
 	Short: "Generate a new qage identity",
 	Long: `Generate a new qage identity with X25519 + ML-KEM-768 hybrid keys.
 
-The identity will be printed to stdout unless -o is specified.`,
+Use --suite p384-mlkem1024 for P-384 + ML-KEM-1024 keys, which provide
+category 5 security for long-term archives.
+
+Both halves of the key are expanded from a random 32-byte seed, and the
+identity is written in the compact format that stores only the seed.
+
+The fingerprint of the new key, its verification words and randomart are
+printed to stderr, for comparing the key with those who encrypt to it.
+
+With --mnemonic, the key is derived from a new 24-word BIP-39 recovery
+phrase instead, which is printed to stderr for a paper backup; restore
+rebuilds the identity from it. Add
+--mnemonic-passphrase to require an extra passphrase along with the words.
+
+Use --plugin-identity to write the identity in the age plugin encoding
+(AGE-PLUGIN-QAGE-1...), preceded by its age1qage1... recipient. The result is
+an age identity file that works with age -i through age-plugin-qage.
+
+With --passphrase, the identity file is encrypted with a passphrase in an age
+scrypt envelope (ASCII-armored with --armor). pub, inspect, decrypt and age
+itself prompt for the passphrase when reading it; set $QAGE_PASSPHRASE or
+$QAGE_PASSPHRASE_FD to supply it non-interactively.
+
+The identity will be printed to stdout unless -o is specified. With
+--format json, a description of the new key is printed instead, with the
+identity file in its identity_file field unless -o is specified; the
+recovery phrase of --mnemonic is still printed to stderr.`,
 	Example: `  # Generate a key to stdout
   qage keygen --comment "laptop"
 
+  # Generate a high-security key
+  qage keygen --suite p384-mlkem1024 --comment "archive"
+
   # Generate a key to file
-  qage keygen -o ~/.qage/key --comment "laptop"`,
+  qage keygen -o ~/.qage/key --comment "laptop"
+
+  # Generate an identity file for age and age-plugin-qage
+  qage keygen --plugin-identity -o ~/.qage/age-key
+
+  # Generate a passphrase-protected key
+  qage keygen --passphrase -o ~/.qage/key
+
+  # Generate a key with a recovery phrase
+  qage keygen --mnemonic -o ~/.qage/key
+
+  # Generate a key from a provisioning script
+  qage keygen --format json -o ~/.qage/key`,
 	RunE: runKeygen,
 }
 
 var (
 	keygenOutput  string
 	keygenComment string
+	keygenSuite   string
+	keygenPlugin  bool
+	keygenPass    bool
+	keygenArmor   bool
+
+	keygenMnemonic     bool
+	keygenMnemonicPass bool
 )
 
 func init() {
 	keygenCmd.Flags().StringVarP(&keygenOutput, "output", "o", "", "output file (default: stdout)")
 	keygenCmd.Flags().StringVarP(&keygenComment, "comment", "c", "", "comment for the key")
+	keygenCmd.Flags().StringVar(&keygenSuite, "suite", suiteFlagName(qage.DefaultConfig().Suite), "cryptographic suite (x25519-mlkem768 or p384-mlkem1024)")
+	keygenCmd.Flags().BoolVar(&keygenPlugin, "plugin-identity", false, "write the identity in the age plugin encoding (AGE-PLUGIN-QAGE-1...)")
+	keygenCmd.Flags().BoolVarP(&keygenPass, "passphrase", "p", false, "encrypt the identity file with a passphrase")
+	keygenCmd.Flags().BoolVarP(&keygenArmor, "armor", "a", false, "ASCII-armor the encrypted identity file (with --passphrase)")
+	keygenCmd.Flags().BoolVar(&keygenMnemonic, "mnemonic", false, "derive the key from a new 24-word recovery phrase, printed to stderr")
+	keygenCmd.Flags().BoolVar(&keygenMnemonicPass, "mnemonic-passphrase", false, "protect the recovery phrase with an extra passphrase (with --mnemonic)")
 }
 
 func runKeygen(cmd *cobra.Command, args []string) error {
+	if keygenArmor && !keygenPass {
+		return fmt.Errorf("--armor requires --passphrase")
+	}
+	if keygenMnemonicPass && !keygenMnemonic {
+		return fmt.Errorf("--mnemonic-passphrase requires --mnemonic")
+	}
+
+	suite, err := qage.ParseSuite(keygenSuite)
+	if err != nil {
+		return err
+	}
+
 	// Generate new identity
-	identity, err := qage.NewIdentity()
+	created := time.Now().UTC().Truncate(time.Second)
+	var identity *qage.Identity
+	var mnemonic string
+	if keygenMnemonic {
+		identity, mnemonic, err = newMnemonicIdentity(suite)
+	} else {
+		identity, err = qage.NewIdentityWithConfig(qage.Config{Suite: suite})
+	}
 	if err != nil {
 		return fmt.Errorf("failed to generate identity: %w", err)
 	}
 
 	// Format for file
-	formatted, err := identity.FormatFile(keygenComment)
+	var formatted string
+	if keygenPlugin {
+		formatted, err = formatPluginIdentity(identity, keygenComment)
+	} else {
+		formatted, err = identity.FormatFile(keygenComment)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to format identity: %w", err)
 	}
+	contents := []byte(formatted + "\n")
 
-	// Output
-	w := cmd.OutOrStdout()
-	if keygenOutput != "" {
-		// Ensure directory exists
-		if mkdirErr := os.MkdirAll(filepath.Dir(keygenOutput), 0700); mkdirErr != nil {
-			return fmt.Errorf("failed to create directory: %w", mkdirErr)
+	if keygenPass {
+		pass, err := readNewPassphrase()
+		if err != nil {
+			return err
 		}
+		if contents, err = encryptIdentityFile(contents, pass, keygenArmor); err != nil {
+			return fmt.Errorf("failed to encrypt identity: %w", err)
+		}
+	}
 
-		f, err := os.OpenFile(keygenOutput, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	// Output
+	if jsonOutput() && keygenOutput == "" {
+		if keygenPass && !keygenArmor {
+			return fmt.Errorf("--format json can't print a binary identity file, use -o or --armor")
+		}
+	} else {
+		w, closeOut, err := openSecretOutput(cmd, keygenOutput)
 		if err != nil {
-			return fmt.Errorf("failed to create output file: %w", err)
+			return err
+		}
+		defer closeOut()
+
+		if _, err := w.Write(contents); err != nil {
+			return err
 		}
-		defer func() {
-			if closeErr := f.Close(); closeErr != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to close file: %v\n", closeErr)
+	}
+
+	if mnemonic != "" {
+		printMnemonic(cmd.ErrOrStderr(), mnemonic, strings.ToLower(keygenSuite))
+	}
+	if jsonOutput() {
+		return printKeygenResult(cmd.OutOrStdout(), identity, created, mnemonic != "", contents)
+	}
+	printVerification(cmd.ErrOrStderr(), identity.Recipient())
+	return nil
+}
+
+// keygenResult is the JSON output of keygen.
+type keygenResult struct {
+	SchemaVersion int      `json:"schema_version"`
+	Identity      *keyInfo `json:"identity"`
+
+	// Created is when the key was generated, and Source "random" or
+	// "mnemonic" for keys derived from a recovery phrase.
+	Created time.Time `json:"created"`
+	Source  string    `json:"source"`
+
+	// File is the file written with -o. Without -o, IdentityFile holds
+	// the contents that would have been written instead.
+	File         string `json:"file,omitempty"`
+	IdentityFile string `json:"identity_file,omitempty"`
+	Encrypted    bool   `json:"encrypted"`
+}
+
+// printKeygenResult prints the JSON output of keygen. The comment is the one
+// given with -c, which is written to the identity file rather than the key.
+func printKeygenResult(w io.Writer, identity *qage.Identity, created time.Time, fromMnemonic bool, contents []byte) error {
+	info, err := describeQageIdentity(identity, false)
+	if err != nil {
+		return err
+	}
+	info.Comment = keygenComment
+
+	result := keygenResult{
+		SchemaVersion: schemaVersion,
+		Identity:      info,
+		Created:       created,
+		Source:        "random",
+		File:          keygenOutput,
+		Encrypted:     keygenPass,
+	}
+	if fromMnemonic {
+		result.Source = "mnemonic"
+	}
+	if keygenOutput == "" {
+		result.IdentityFile = string(contents)
+	}
+	return writeJSON(w, result)
+}
+
+// newMnemonicIdentity generates a recovery phrase and derives an identity of
+// the suite from it, with the extra passphrase if requested.
+func newMnemonicIdentity(suite qage.Suite) (*qage.Identity, string, error) {
+	mnemonic, err := qage.NewMnemonic()
+	if err != nil {
+		return nil, "", err
+	}
+	var pass string
+	if keygenMnemonicPass {
+		if pass, err = readNewPassphrase(); err != nil {
+			return nil, "", err
+		}
+	}
+	identity, err := qage.NewIdentityFromMnemonic(mnemonic, pass, qage.Config{Suite: suite})
+	if err != nil {
+		return nil, "", err
+	}
+	return identity, mnemonic, nil
+}
+
+// printMnemonic prints a recovery phrase as a numbered grid. The phrase
+// doesn't record the suite, so the restore command line names it.
+func printMnemonic(w io.Writer, mnemonic, suite string) {
+	fmt.Fprintln(w, "Recovery phrase, write it down and keep it safe. Anyone with it can")
+	fmt.Fprintf(w, "recreate the key with: qage restore --suite %s\n\n", suite)
+
+	words := strings.Fields(mnemonic)
+	const columns = 4
+	rows := (len(words) + columns - 1) / columns
+	for r := 0; r < rows; r++ {
+		var line strings.Builder
+		for c := 0; c < columns; c++ {
+			if i := c*rows + r; i < len(words) {
+				fmt.Fprintf(&line, "  %2d. %-9s", i+1, words[i])
 			}
-		}()
-		w = f
+		}
+		fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
 	}
+	fmt.Fprintln(w)
+}
 
-	_, err = fmt.Fprintln(w, formatted)
-	return err
+// formatPluginIdentity formats an identity as an age identity file: comment
+// lines followed by the bare AGE-PLUGIN-QAGE-1... identity.
+func formatPluginIdentity(identity *qage.Identity, comment string) (string, error) {
+	recipient, err := identity.Recipient().PluginString()
+	if err != nil {
+		return "", err
+	}
+	encoded, err := identity.PluginString()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if comment != "" {
+		fmt.Fprintf(&b, "# %s\n", comment)
+	}
+	fmt.Fprintf(&b, "# public key: %s\n", recipient)
+	b.WriteString(encoded)
+	return b.String(), nil
 }
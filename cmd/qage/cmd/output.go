@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+// Values of the global --format flag.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// schemaVersion is the version of the JSON output of every command. Fields
+// may be added within a version, but are never removed or changed.
+const schemaVersion = 1
+
+// outputFormat is the value of the global --format flag.
+var outputFormat string
+
+// addFormatFlag adds the global --format flag to a root command. It can't be
+// called --output, which the subcommands use for their output file.
+func addFormatFlag(root *cobra.Command) {
+	root.PersistentFlags().StringVar(&outputFormat, "format", formatText, "output format of keygen, pub, fingerprint, inspect, inspect-file, selftest and version: text or json (-o/--output names output files)")
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		switch outputFormat {
+		case formatText, formatJSON:
+			return nil
+		default:
+			return fmt.Errorf("unknown --format %q, use text or json", outputFormat)
+		}
+	}
+}
+
+// jsonOutput reports whether --format json was given.
+func jsonOutput() bool {
+	return outputFormat == formatJSON
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// PrintError prints an error returned by a command to its stderr, as a JSON
+// object with --format json.
+func PrintError(c *cobra.Command, err error) {
+	w := c.ErrOrStderr()
+	if !jsonOutput() {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		return
+	}
+	type jsonError struct {
+		Message string `json:"message"`
+	}
+	_ = writeJSON(w, struct {
+		SchemaVersion int       `json:"schema_version"`
+		Error         jsonError `json:"error"`
+	}{schemaVersion, jsonError{err.Error()}})
+}
+
+// keyInfo is the JSON description of an identity, or of its recipient.
+type keyInfo struct {
+	// Type is "qage", "age-hybrid" or "age-x25519".
+	Type string `json:"type"`
+
+	// Suite is the name accepted by --suite, SuiteID its number in the key
+	// encoding, and SuiteName its display name. They are only set for qage
+	// keys, as are the fields that follow.
+	Suite     string `json:"suite,omitempty"`
+	SuiteID   int    `json:"suite_id,omitempty"`
+	SuiteName string `json:"suite_name,omitempty"`
+	Combiner  string `json:"combiner,omitempty"`
+
+	// Format is "compact" for identities stored as a seed and "expanded"
+	// otherwise. It is omitted for recipients.
+	Format  string `json:"format,omitempty"`
+	Comment string `json:"comment,omitempty"`
+
+	Recipient       string `json:"recipient"`
+	PluginRecipient string `json:"plugin_recipient,omitempty"`
+
+	// Fingerprint, VerificationWords and Randomart are renderings of the
+	// fingerprint of qage recipients for out-of-band verification.
+	Fingerprint       string `json:"fingerprint,omitempty"`
+	VerificationWords string `json:"verification_words,omitempty"`
+	Randomart         string `json:"randomart,omitempty"`
+
+	Sizes *keySizes `json:"sizes,omitempty"`
+}
+
+// keySizes are the sizes of the keys of a qage identity, in bytes, and of
+// their encodings, in characters.
+type keySizes struct {
+	ECPublicKey    int `json:"ec_public_key"`
+	MLKEMPublicKey int `json:"mlkem_public_key"`
+	Recipient      int `json:"recipient"`
+	Identity       int `json:"identity,omitempty"`
+}
+
+// suiteFlagName returns the --suite name of a suite.
+func suiteFlagName(s qage.Suite) string {
+	switch s {
+	case qage.HybridX25519Kyber768:
+		return "x25519-kyber768"
+	case qage.HybridX25519MLKEM768:
+		return "x25519-mlkem768"
+	case qage.HybridP384MLKEM1024:
+		return "p384-mlkem1024"
+	default:
+		return ""
+	}
+}
+
+// suitePublicKeySizes returns the sizes of the EC and ML-KEM public keys of a
+// suite.
+func suitePublicKeySizes(s qage.Suite) (ec, mlkem int) {
+	switch s {
+	case qage.HybridX25519Kyber768, qage.HybridX25519MLKEM768:
+		return 32, 1184
+	case qage.HybridP384MLKEM1024:
+		return 97, 1568
+	default:
+		return 0, 0
+	}
+}
+
+// describeIdentity returns the JSON description of an identity. With
+// public set, only its recipient is described.
+func describeIdentity(identity age.Identity, public bool) (*keyInfo, error) {
+	switch id := identity.(type) {
+	case *age.X25519Identity:
+		return &keyInfo{Type: "age-x25519", Recipient: id.Recipient().String()}, nil
+	case *age.HybridIdentity:
+		return &keyInfo{Type: "age-hybrid", Recipient: id.Recipient().String()}, nil
+	case *qage.Identity:
+		return describeQageIdentity(id, public)
+	default:
+		return nil, fmt.Errorf("unsupported identity type %T", identity)
+	}
+}
+
+// describeQageIdentity returns the JSON description of a qage identity.
+func describeQageIdentity(id *qage.Identity, public bool) (*keyInfo, error) {
+	info, err := describeRecipient(id.Recipient())
+	if err != nil {
+		return nil, err
+	}
+	info.Comment = id.Comment()
+	if public {
+		return info, nil
+	}
+
+	info.Format = "expanded"
+	if id.Compact() {
+		info.Format = "compact"
+	}
+	encoded, err := id.String()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode identity: %w", err)
+	}
+	info.Sizes.Identity = len(encoded)
+	return info, nil
+}
+
+// describeRecipient returns the JSON description of a qage recipient.
+func describeRecipient(r *qage.Recipient) (*keyInfo, error) {
+	recipient, err := r.String()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode recipient: %w", err)
+	}
+	info := &keyInfo{
+		Type:              "qage",
+		Suite:             suiteFlagName(r.Suite()),
+		SuiteID:           int(r.Suite()),
+		SuiteName:         r.Suite().String(),
+		Combiner:          r.Combiner().String(),
+		Recipient:         recipient,
+		Fingerprint:       r.Fingerprint(),
+		VerificationWords: r.VerificationWords(),
+		Randomart:         r.Randomart(),
+		Sizes:             &keySizes{Recipient: len(recipient)},
+	}
+	info.Sizes.ECPublicKey, info.Sizes.MLKEMPublicKey = suitePublicKeySizes(r.Suite())
+	if info.PluginRecipient, err = r.PluginString(); err != nil {
+		return nil, fmt.Errorf("failed to encode recipient: %w", err)
+	}
+	return info, nil
+}
+
+// printVerification prints the fingerprint of a qage recipient, its
+// verification words and its randomart, for comparing keys out of band.
+func printVerification(w io.Writer, r *qage.Recipient) {
+	fmt.Fprintf(w, "Fingerprint: %s\n", r.Fingerprint())
+	fmt.Fprintf(w, "Verification words: %s\n", r.VerificationWords())
+	fmt.Fprint(w, r.Randomart())
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Passphrases are read from these environment variables, in order, before
+// falling back to a terminal prompt. $QAGE_PASSPHRASE holds the passphrase
+// itself; $QAGE_PASSPHRASE_FD names an inherited file descriptor to read it
+// from, one passphrase per line, e.g. in scripts and CI.
+const (
+	passphraseEnv   = "QAGE_PASSPHRASE"
+	passphraseFdEnv = "QAGE_PASSPHRASE_FD"
+)
+
+// passphraseFd is the reader over $QAGE_PASSPHRASE_FD, opened on first use so
+// that consecutive prompts read consecutive lines.
+var passphraseFd *bufio.Reader
+
+// readPassphrase returns the passphrase from the environment or, failing
+// that, prompts for it on the terminal.
+func readPassphrase(prompt string) (string, error) {
+	if p, ok := os.LookupEnv(passphraseEnv); ok {
+		return p, nil
+	}
+	if fdStr, ok := os.LookupEnv(passphraseFdEnv); ok {
+		return readPassphraseFd(fdStr)
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no terminal to read the passphrase from; set $%s or $%s", passphraseEnv, passphraseFdEnv)
+	}
+	defer func() {
+		if closeErr := tty.Close(); closeErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to close terminal: %v\n", closeErr)
+		}
+	}()
+
+	fmt.Fprintf(tty, "%s: ", prompt)
+	p, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(p), nil
+}
+
+// readPassphraseFd reads one line from the file descriptor in fdStr.
+func readPassphraseFd(fdStr string) (string, error) {
+	if passphraseFd == nil {
+		fd, err := strconv.Atoi(fdStr)
+		if err != nil || fd < 0 {
+			return "", fmt.Errorf("invalid $%s %q", passphraseFdEnv, fdStr)
+		}
+		passphraseFd = bufio.NewReader(os.NewFile(uintptr(fd), "passphrase"))
+	}
+
+	line, err := passphraseFd.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("failed to read passphrase from $%s: %w", passphraseFdEnv, err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readNewPassphrase reads a passphrase like readPassphrase, asking for it twice
+// when prompting.
+func readNewPassphrase() (string, error) {
+	_, fromEnv := os.LookupEnv(passphraseEnv)
+	_, fromFd := os.LookupEnv(passphraseFdEnv)
+	if fromEnv || fromFd {
+		return readPassphrase("")
+	}
+
+	p, err := readPassphrase("Enter passphrase")
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", errors.New("empty passphrase")
+	}
+	confirm, err := readPassphrase("Confirm passphrase")
+	if err != nil {
+		return "", err
+	}
+	if confirm != p {
+		return "", errors.New("passphrases didn't match")
+	}
+	return p, nil
+}
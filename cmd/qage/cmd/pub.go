@@ -1,12 +1,9 @@
 package cmd
 
 import (
-	"bufio"
 	"fmt"
-	"io"
-	"os"
-	"strings"
 
+	"filippo.io/age"
 	"github.com/spf13/cobra"
 
 	"github.com/zlobste/qage/pkg/qage"
@@ -15,82 +12,117 @@ import (
 var pubCmd = &cobra.Command{
 	Use:   "pub",
 	Short: "Extract public recipient from identity",
-	Long: `Extract the public recipient string from a qage identity.
+	Long: `Extract the public recipient strings from an identity file.
 
-The recipient can be used with age -R or age --recipient.`,
+One recipient is printed per identity in the file, including native age
+hybrid and X25519 identities.
+
+The recipient can be used with age -R or age --recipient. With --plugin,
+the recipient is printed in the age plugin encoding (age1qage1...), which
+makes age invoke age-plugin-qage.
+
+A recipient is too long to compare by eye. With --fingerprint, its short
+fingerprint, 12 verification words and randomart image are printed instead,
+to read out to whoever encrypts to it; qage fingerprint shows the same for
+the recipient they were given.
+
+With --format json, each recipient is described in both encodings along with
+its suite and fingerprint.`,
 	Example: `  # From file
   qage pub -i ~/.qage/key
 
   # From stdin
   cat ~/.qage/key | qage pub
 
-  # Use with age
-  age -R $(qage pub -i ~/.qage/key) -o secret.age secret.txt`,
+  # Use with age through age-plugin-qage
+  age -r $(qage pub --plugin -i ~/.qage/key) -o secret.age secret.txt
+
+  # Verify a key over the phone
+  qage pub --fingerprint -i ~/.qage/key
+
+  # Machine-readable output
+  qage pub --format json -i ~/.qage/key`,
 	RunE: runPub,
 }
 
-var pubIdentity string
+var (
+	pubIdentity    string
+	pubPlugin      bool
+	pubFingerprint bool
+)
 
 func init() {
 	pubCmd.Flags().StringVarP(&pubIdentity, "identity", "i", "-", "identity file ('-' for stdin)")
+	pubCmd.Flags().BoolVar(&pubPlugin, "plugin", false, "print the age plugin encoding (age1qage1...)")
+	pubCmd.Flags().BoolVar(&pubFingerprint, "fingerprint", false, "print the fingerprint, verification words and randomart instead")
+}
+
+// pubResult is the JSON output of pub.
+type pubResult struct {
+	SchemaVersion int        `json:"schema_version"`
+	Recipients    []*keyInfo `json:"recipients"`
 }
 
 func runPub(cmd *cobra.Command, args []string) error {
-	// Read identity
-	var r io.Reader = os.Stdin
-	if pubIdentity != "-" {
-		f, err := os.Open(pubIdentity)
-		if err != nil {
-			return fmt.Errorf("failed to open identity file: %w", err)
-		}
-		defer func() {
-			if closeErr := f.Close(); closeErr != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to close file: %v\n", closeErr)
-			}
-		}()
-		r = f
+	identities, err := loadIdentities(cmd, pubIdentity)
+	if err != nil {
+		return err
 	}
 
-	// Read first non-empty, non-comment line
-	scanner := bufio.NewScanner(r)
-	var identityLine string
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "#") {
-			identityLine = line
-			break
+	if jsonOutput() {
+		result := pubResult{SchemaVersion: schemaVersion, Recipients: []*keyInfo{}}
+		for _, identity := range identities {
+			info, err := describeIdentity(identity, true)
+			if err != nil {
+				return err
+			}
+			result.Recipients = append(result.Recipients, info)
 		}
+		return writeJSON(cmd.OutOrStdout(), result)
 	}
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("failed to read identity: %w", err)
-	}
-	if identityLine == "" {
-		return fmt.Errorf("no identity found in input")
-	}
-
-	// Parse identity
-	var identity *qage.Identity
-	var err error
 
-	if strings.HasPrefix(identityLine, "QAGE-SECRET-KEY-1 ") {
-		// File format
-		identity, _, err = qage.ParseIdentityFile(identityLine)
-	} else {
-		// Direct bech32
-		identity, err = qage.ParseIdentity(identityLine)
+	if pubFingerprint {
+		for i, identity := range identities {
+			qid, ok := identity.(*qage.Identity)
+			if !ok {
+				return fmt.Errorf("only qage recipients have fingerprints, not %T", identity)
+			}
+			if i > 0 {
+				fmt.Fprintln(cmd.OutOrStdout())
+			}
+			printVerification(cmd.OutOrStdout(), qid.Recipient())
+		}
+		return nil
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to parse identity: %w", err)
+	// Print the recipient of every identity in the file
+	for _, identity := range identities {
+		recipientStr, err := recipientString(identity, pubPlugin)
+		if err != nil {
+			return fmt.Errorf("failed to encode recipient: %w", err)
+		}
+		if _, err := fmt.Fprintln(cmd.OutOrStdout(), recipientStr); err != nil {
+			return err
+		}
 	}
 
-	// Get recipient
-	recipient := identity.Recipient()
-	recipientStr, err := recipient.String()
-	if err != nil {
-		return fmt.Errorf("failed to encode recipient: %w", err)
-	}
+	return nil
+}
 
-	_, err = fmt.Fprintln(cmd.OutOrStdout(), recipientStr)
-	return err
+// recipientString returns the recipient of a qage or age identity, using the
+// age plugin encoding for qage recipients if plugin is set.
+func recipientString(identity age.Identity, plugin bool) (string, error) {
+	switch id := identity.(type) {
+	case *qage.Identity:
+		if plugin {
+			return id.Recipient().PluginString()
+		}
+		return id.Recipient().String()
+	case *age.HybridIdentity:
+		return id.Recipient().String(), nil
+	case *age.X25519Identity:
+		return id.Recipient().String(), nil
+	default:
+		return "", fmt.Errorf("unsupported identity type %T", identity)
+	}
 }
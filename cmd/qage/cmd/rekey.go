@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/spf13/cobra"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey [file]",
+	Short: "Change the recipients of an encrypted file",
+	Long: `Add recipients to, or remove recipients from, an encrypted file without
+re-encrypting its contents. The file key is unwrapped with an identity given
+with -i, and only the header is rewritten: the payload is copied through
+untouched, so rekeying a large archive is fast.
+
+By default the existing recipients are kept and those given with -r and -R
+are added. --remove drops the N-th recipient stanza of the file, as numbered
+by inspect-file, and --replace drops all of them, so that only the given
+recipients can decrypt the new file. As with encrypt, post-quantum and
+classical recipients are not mixed unless --allow-classical is given, and
+--key-hint tags the new qage stanzas with a hint of their recipient.
+
+Removing a recipient only affects the new file: anyone who kept a copy of
+the old file can still decrypt it with their key.
+
+The file is read from stdin unless given, and written to stdout unless -o is
+specified. The output file only appears once the file key was unwrapped and
+the new header written, and it can't be the input file. ASCII-armored files
+stay armored.`,
+	Example: `  # Give a new engineer access to an archive
+  qage rekey -i key.txt -r qage1... -o archive.new.age archive.age
+
+  # Re-encrypt the file key to the current team only
+  qage rekey -i key.txt --replace -R team.txt -o archive.new.age archive.age`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runRekey,
+}
+
+var (
+	rekeyIdentities     []string
+	rekeyRecipients     []string
+	rekeyRecipientFiles []string
+	rekeyRemove         []int
+	rekeyReplace        bool
+	rekeyAllowClassical bool
+	rekeyKeyHint        bool
+	rekeyOutput         string
+)
+
+func init() {
+	rekeyCmd.Flags().StringArrayVarP(&rekeyIdentities, "identity", "i", nil, "identity file to unwrap the file key with (can be repeated)")
+	rekeyCmd.Flags().StringArrayVarP(&rekeyRecipients, "recipient", "r", nil, "recipient to add (can be repeated)")
+	rekeyCmd.Flags().StringArrayVarP(&rekeyRecipientFiles, "recipients-file", "R", nil, "file with recipients to add, one per line (can be repeated)")
+	rekeyCmd.Flags().IntSliceVar(&rekeyRemove, "remove", nil, "remove the N-th recipient stanza (can be repeated)")
+	rekeyCmd.Flags().BoolVar(&rekeyReplace, "replace", false, "remove every existing recipient")
+	rekeyCmd.Flags().BoolVar(&rekeyAllowClassical, "allow-classical", false, "allow mixing post-quantum recipients with classical ones")
+	rekeyCmd.Flags().BoolVar(&rekeyKeyHint, "key-hint", false, "tag the new qage stanzas with a hint of their recipient")
+	rekeyCmd.Flags().StringVarP(&rekeyOutput, "output", "o", "", "output file (default: stdout)")
+}
+
+func runRekey(cmd *cobra.Command, args []string) error {
+	if len(rekeyIdentities) == 0 {
+		return errors.New("no identities specified, use -i to unwrap the file key")
+	}
+	if rekeyReplace && len(rekeyRemove) > 0 {
+		return errors.New("--remove can't be combined with --replace")
+	}
+	for _, n := range rekeyRemove {
+		if n < 1 {
+			return fmt.Errorf("invalid --remove %d, stanzas are numbered from 1", n)
+		}
+	}
+
+	recipients, err := loadRecipients(rekeyRecipients, rekeyRecipientFiles, rekeyAllowClassical)
+	if err != nil {
+		return err
+	}
+	if rekeyKeyHint {
+		recipients = withKeyHints(recipients)
+	}
+	if len(recipients) == 0 && !rekeyReplace && len(rekeyRemove) == 0 {
+		return errors.New("nothing to do, use -r, -R, --remove or --replace")
+	}
+
+	var identities []age.Identity
+	for _, name := range rekeyIdentities {
+		ids, err := loadIdentities(cmd, name)
+		if err != nil {
+			return err
+		}
+		identities = append(identities, ids...)
+	}
+	identities = groupQageIdentities(identities)
+
+	in, closeIn, err := openInput(cmd, args)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	src := bufio.NewReader(in)
+	var ciphertext io.Reader = src
+	armored := false
+	if start, _ := src.Peek(len(armor.Header)); string(start) == armor.Header {
+		ciphertext = armor.NewReader(src)
+		armored = true
+	}
+
+	// Check --remove against the header before writing anything
+	hdr, ciphertext, err := readHeader(ciphertext)
+	if err != nil {
+		return err
+	}
+	for _, n := range rekeyRemove {
+		if n > len(hdr.Stanzas) {
+			return fmt.Errorf("invalid --remove %d, the stanzas of the file are numbered from 1 to %d", n, len(hdr.Stanzas))
+		}
+	}
+
+	out, commitOut, abortOut, err := createRekeyOutput(cmd, rekeyOutput, args)
+	if err != nil {
+		return err
+	}
+	defer abortOut()
+
+	var dst io.Writer = out
+	var armorWriter io.WriteCloser
+	if armored {
+		armorWriter = armor.NewWriter(out)
+		dst = armorWriter
+	}
+
+	err = qage.Rekey(dst, ciphertext, qage.RekeyOptions{
+		Identities: identities,
+		Keep: func(i int, s *age.Stanza) bool {
+			return !rekeyReplace && !slices.Contains(rekeyRemove, i+1)
+		},
+		Recipients:     recipients,
+		AllowClassical: rekeyAllowClassical,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rekey: %w", err)
+	}
+	if armorWriter != nil {
+		if err := armorWriter.Close(); err != nil {
+			return fmt.Errorf("failed to write armor: %w", err)
+		}
+	}
+
+	return commitOut()
+}
+
+// createRekeyOutput returns the writer of the rekeyed file, stdout if name is
+// empty or "-". A named file is written to a temporary file in the same
+// directory, which commit renames to name and abort removes, so that a failed
+// rekey leaves nothing behind. Writing over the input file, named in args, is
+// refused.
+func createRekeyOutput(cmd *cobra.Command, name string, args []string) (w io.Writer, commit func() error, abort func(), err error) {
+	if name == "" || name == "-" {
+		return cmd.OutOrStdout(), func() error { return nil }, func() {}, nil
+	}
+
+	if len(args) > 0 && args[0] != "-" {
+		in, inErr := os.Stat(args[0])
+		out, outErr := os.Stat(name)
+		if inErr == nil && outErr == nil && os.SameFile(in, out) {
+			return nil, nil, nil, fmt.Errorf("output file %s is the input file, write to a new file instead", name)
+		}
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	// Keep the mode of a file being replaced
+	if fi, err := os.Stat(name); err == nil {
+		if err := f.Chmod(fi.Mode().Perm()); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, nil, nil, fmt.Errorf("failed to create output file: %w", err)
+		}
+	}
+
+	done := false
+	commit = func() error {
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		if err := os.Rename(f.Name(), name); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		done = true
+		return nil
+	}
+	abort = func() {
+		if !done {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+	return f, commit, abort, nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore an identity from its recovery phrase",
+	Long: `Rebuild an identity from the 24-word recovery phrase printed by
+keygen --mnemonic, read from stdin.
+
+The words are checked against the BIP-39 word list and checksum, so a
+mistyped or misordered word is reported. The phrase doesn't record the
+suite: pass the --suite the key was generated with, and
+--mnemonic-passphrase if it was protected with one. A wrong suite or
+passphrase silently yields a different key, so compare the fingerprint
+printed to stderr with the one printed by keygen.
+
+The identity is printed to stdout unless -o is specified.`,
+	Example: `  # Restore a key, typing the words at the prompt
+  qage restore -o ~/.qage/key --comment "laptop"
+
+  # Restore a P-384 + ML-KEM-1024 key from a file
+  qage restore --suite p384-mlkem1024 < phrase.txt`,
+	Args: cobra.NoArgs,
+	RunE: runRestore,
+}
+
+var (
+	restoreOutput       string
+	restoreComment      string
+	restoreSuite        string
+	restorePlugin       bool
+	restoreMnemonicPass bool
+)
+
+func init() {
+	restoreCmd.Flags().StringVarP(&restoreOutput, "output", "o", "", "output file (default: stdout)")
+	restoreCmd.Flags().StringVarP(&restoreComment, "comment", "c", "", "comment for the key")
+	restoreCmd.Flags().StringVar(&restoreSuite, "suite", suiteFlagName(qage.DefaultConfig().Suite), "cryptographic suite the key was generated with")
+	restoreCmd.Flags().BoolVar(&restorePlugin, "plugin-identity", false, "write the identity in the age plugin encoding (AGE-PLUGIN-QAGE-1...)")
+	restoreCmd.Flags().BoolVar(&restoreMnemonicPass, "mnemonic-passphrase", false, "the recovery phrase is protected with an extra passphrase")
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	suite, err := qage.ParseSuite(restoreSuite)
+	if err != nil {
+		return err
+	}
+
+	mnemonic, err := readMnemonic(cmd)
+	if err != nil {
+		return err
+	}
+	var pass string
+	if restoreMnemonicPass {
+		if pass, err = readPassphrase("Enter recovery passphrase"); err != nil {
+			return err
+		}
+	}
+
+	identity, err := qage.NewIdentityFromMnemonic(mnemonic, pass, qage.Config{Suite: suite})
+	if err != nil {
+		return err
+	}
+
+	var formatted string
+	if restorePlugin {
+		formatted, err = formatPluginIdentity(identity, restoreComment)
+	} else {
+		formatted, err = identity.FormatFile(restoreComment)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to format identity: %w", err)
+	}
+
+	w, closeOut, err := openSecretOutput(cmd, restoreOutput)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	if _, err := fmt.Fprintln(w, formatted); err != nil {
+		return err
+	}
+	printVerification(cmd.ErrOrStderr(), identity.Recipient())
+	return nil
+}
+
+// readMnemonic reads the words of a recovery phrase from stdin, over as many
+// lines as needed, prompting for them if stdin is a terminal.
+func readMnemonic(cmd *cobra.Command) (string, error) {
+	in := cmd.InOrStdin()
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fmt.Fprintln(cmd.ErrOrStderr(), "Enter the 24-word recovery phrase, then press Enter:")
+	}
+
+	var words []string
+	scanner := bufio.NewScanner(io.LimitReader(in, 1<<16))
+	for len(words) < 24 && scanner.Scan() {
+		words = append(words, strings.Fields(scanner.Text())...)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read recovery phrase: %w", err)
+	}
+	if len(words) == 0 {
+		return "", errors.New("no recovery phrase given on stdin")
+	}
+	return strings.Join(words, " "), nil
+}
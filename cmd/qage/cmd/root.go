@@ -2,7 +2,6 @@
 package cmd
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -23,9 +22,9 @@ Examples:
   # Get the public recipient
   qage pub -i key.txt
 
-  # Use with age
-  age -R $(qage pub -i key.txt) -o secret.age secret.txt
-  age -d -i key.txt secret.age`,
+  # Encrypt and decrypt
+  qage encrypt -r $(qage pub -i key.txt) -o secret.age secret.txt
+  qage decrypt -i key.txt secret.age`,
 	SilenceUsage:  true,
 	SilenceErrors: true,
 }
@@ -33,15 +32,27 @@ Examples:
 // Execute runs the root command.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		PrintError(rootCmd, err)
 		os.Exit(1)
 	}
 }
 
 func init() {
+	addFormatFlag(rootCmd)
+
 	rootCmd.AddCommand(keygenCmd)
 	rootCmd.AddCommand(pubCmd)
+	rootCmd.AddCommand(fingerprintCmd)
+	rootCmd.AddCommand(encryptCmd)
+	rootCmd.AddCommand(decryptCmd)
+	rootCmd.AddCommand(rekeyCmd)
 	rootCmd.AddCommand(inspectCmd)
+	rootCmd.AddCommand(inspectFileCmd)
+	rootCmd.AddCommand(convertCmd)
+	rootCmd.AddCommand(keyCmd)
+	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(splitCmd)
+	rootCmd.AddCommand(combineCmd)
 	rootCmd.AddCommand(selftestCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(completionCmd)
@@ -65,14 +76,25 @@ Examples:
   # Get the public recipient
   qage pub -i key.txt
 
-  # Use with age
-  age -R $(qage pub -i key.txt) -o secret.age secret.txt
-  age -d -i key.txt secret.age`,
+  # Encrypt and decrypt
+  qage encrypt -r $(qage pub -i key.txt) -o secret.age secret.txt
+  qage decrypt -i key.txt secret.age`,
 	}
+	addFormatFlag(cmd)
 
 	cmd.AddCommand(keygenCmd)
 	cmd.AddCommand(pubCmd)
+	cmd.AddCommand(fingerprintCmd)
+	cmd.AddCommand(encryptCmd)
+	cmd.AddCommand(decryptCmd)
+	cmd.AddCommand(rekeyCmd)
 	cmd.AddCommand(inspectCmd)
+	cmd.AddCommand(inspectFileCmd)
+	cmd.AddCommand(convertCmd)
+	cmd.AddCommand(keyCmd)
+	cmd.AddCommand(restoreCmd)
+	cmd.AddCommand(splitCmd)
+	cmd.AddCommand(combineCmd)
 	cmd.AddCommand(selftestCmd)
 	cmd.AddCommand(versionCmd)
 	cmd.AddCommand(completionCmd)
@@ -5,6 +5,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/zlobste/qage/pkg/crypto"
 	"github.com/zlobste/qage/pkg/qage"
 )
 
@@ -13,15 +14,140 @@ var selftestCmd = &cobra.Command{
 	Short: "Run internal validation tests",
 	Long: `Run internal validation tests to verify that qage is working correctly.
 
-This tests key generation, encoding/decoding, and age integration.
-No output means all tests passed.`,
-	Example: `  qage selftest`,
-	RunE:    runSelftest,
+This runs known-answer tests of the cryptographic primitives, with NIST ACVP
+vectors for ML-KEM-768 and ML-KEM-1024 and decapsulation tests of the keys of
+their keyGen vectors, RFC 7748 vectors for X25519 and RFC 5869 vectors for
+HKDF-SHA-256, and tests key generation, encoding/decoding, and age
+integration. The known-answer tests also run as a power-on self-test the
+first time a crypto backend is used, and qage refuses to use a backend that
+fails them. No output means all tests passed; -v lists each test.
+
+With --vectors, the build is also checked against the published test vectors
+embedded in the binary. Tests and vectors that the crypto backend can't check
+are skipped, with a note on stderr: in FIPS 140-3 mode, X25519, and the ACVP
+encapsulation and expanded-key decapsulation vectors, which the standard
+library can't run.
+
+With --format json, a summary of every test is printed, and "passed" is false
+if any failed.`,
+	Example: `  qage selftest
+
+  # List each test
+  qage selftest -v
+
+  # Also check the published test vectors
+  qage selftest --vectors`,
+	RunE: runSelftest,
+}
+
+var (
+	selftestVectors bool
+	selftestVerbose bool
+)
+
+func init() {
+	selftestCmd.Flags().BoolVar(&selftestVectors, "vectors", false, "also check the embedded test vectors")
+	selftestCmd.Flags().BoolVarP(&selftestVerbose, "verbose", "v", false, "list each test and its result")
+}
+
+// selftestResult is the JSON output of selftest.
+type selftestResult struct {
+	SchemaVersion int                    `json:"schema_version"`
+	Backend       string                 `json:"backend"`
+	FIPS140       bool                   `json:"fips140"`
+	Passed        bool                   `json:"passed"`
+	Tests         []selftestTest         `json:"tests"`
+	Vectors       *selftestVectorsResult `json:"vectors,omitempty"`
+}
+
+// selftestTest is the JSON result of one test.
+type selftestTest struct {
+	Name string `json:"name"`
+
+	// Result is "pass", "skip" or "fail". Error is the reason of a skip or
+	// failure.
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// selftestVectorsResult is the JSON summary of the test vectors.
+type selftestVectorsResult struct {
+	Checked int `json:"checked"`
+	Skipped int `json:"skipped"`
 }
 
 func runSelftest(cmd *cobra.Command, args []string) error {
-	if err := qage.Selftest(); err != nil {
-		return fmt.Errorf("selftest failed: %w", err)
+	results := qage.SelftestResults()
+	var vectors *selftestVectorsResult
+	if selftestVectors {
+		checked, skipped, err := qage.SelftestVectors()
+		vectors = &selftestVectorsResult{Checked: checked, Skipped: skipped}
+		results = append(results, qage.SelftestResult{
+			Name: fmt.Sprintf("test vectors (%d checked, %d skipped)", checked, skipped),
+			Err:  err,
+		})
+	}
+
+	var failed error
+	for _, r := range results {
+		if r.Err != nil && !r.Skipped {
+			failed = fmt.Errorf("selftest failed: %s: %w", r.Name, r.Err)
+			break
+		}
+	}
+
+	w := cmd.OutOrStdout()
+	if jsonOutput() {
+		result := selftestResult{
+			SchemaVersion: schemaVersion,
+			Backend:       qage.DefaultConfig().Backend.Name(),
+			FIPS140:       crypto.FIPSMode(),
+			Passed:        failed == nil,
+			Tests:         []selftestTest{},
+			Vectors:       vectors,
+		}
+		for _, r := range results {
+			test := selftestTest{Name: r.Name, Result: "pass"}
+			if r.Err != nil {
+				test.Error = r.Err.Error()
+				test.Result = "fail"
+				if r.Skipped {
+					test.Result = "skip"
+				}
+			}
+			result.Tests = append(result.Tests, test)
+		}
+		if err := writeJSON(w, result); err != nil {
+			return err
+		}
+		return failed
+	}
+
+	if selftestVerbose {
+		for _, r := range results {
+			switch {
+			case r.Skipped:
+				fmt.Fprintf(w, "SKIP  %s: %v\n", r.Name, r.Err)
+			case r.Err != nil:
+				fmt.Fprintf(w, "FAIL  %s: %v\n", r.Name, r.Err)
+			default:
+				fmt.Fprintf(w, "PASS  %s\n", r.Name)
+			}
+		}
+	} else {
+		backend := qage.DefaultConfig().Backend.Name()
+		skipped := 0
+		for _, r := range results {
+			if r.Skipped {
+				skipped++
+			}
+		}
+		if skipped > 0 {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Note: skipped %d of %d tests not supported by the %s backend, -v lists them\n", skipped, len(results), backend)
+		}
+		if vectors != nil && vectors.Skipped > 0 {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Note: skipped %d of %d test vectors not supported by the %s backend\n", vectors.Skipped, vectors.Checked+vectors.Skipped, backend)
+		}
 	}
-	return nil
+	return failed
 }
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zlobste/qage/pkg/qage"
+)
+
+var splitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Split an identity into shares",
+	Long: `Split an identity into n shares with Shamir's secret sharing, so that any
+k of them rebuild it with combine and fewer reveal nothing about it. Hand
+each share to a different person, so that nobody holds the whole key.
+
+Each share is a line starting with qagshare1, preceded by a comment with
+its number, the threshold and the fingerprint of the identity, which
+combine checks the rebuilt identity against. The identity file must hold a
+single qage identity. Compact identities, as generated by keygen, make
+shares of about 100 characters.
+
+The shares are printed to stdout unless -o is specified.`,
+	Example: `  # Split a recovery key into 5 shares, any 3 of which rebuild it
+  qage split -k 3 -n 5 -i recovery.key`,
+	Args: cobra.NoArgs,
+	RunE: runSplit,
+}
+
+var (
+	splitIdentity  string
+	splitOutput    string
+	splitThreshold int
+	splitShares    int
+)
+
+func init() {
+	splitCmd.Flags().StringVarP(&splitIdentity, "identity", "i", "-", "identity file ('-' for stdin)")
+	splitCmd.Flags().StringVarP(&splitOutput, "output", "o", "", "output file (default: stdout)")
+	splitCmd.Flags().IntVarP(&splitThreshold, "threshold", "k", 0, "number of shares needed to rebuild the identity")
+	splitCmd.Flags().IntVarP(&splitShares, "shares", "n", 0, "number of shares to create")
+	_ = splitCmd.MarkFlagRequired("threshold")
+	_ = splitCmd.MarkFlagRequired("shares")
+}
+
+func runSplit(cmd *cobra.Command, args []string) error {
+	if splitThreshold < 2 || splitThreshold > splitShares || splitShares > 255 {
+		return fmt.Errorf("invalid -k %d -n %d: need 2 <= k <= n <= 255", splitThreshold, splitShares)
+	}
+
+	identities, err := loadIdentities(cmd, splitIdentity)
+	if err != nil {
+		return err
+	}
+	var identity *qage.Identity
+	for _, i := range identities {
+		if id, ok := i.(*qage.Identity); ok {
+			if identity != nil {
+				return errors.New("identity file holds more than one qage identity; split them one at a time")
+			}
+			identity = id
+		}
+	}
+	if identity == nil {
+		return errors.New("identity file holds no qage identity")
+	}
+	if !identity.Compact() {
+		fmt.Fprintln(cmd.ErrOrStderr(), "Warning: the identity predates the compact format, so each share is as long as the identity")
+	}
+
+	shares, err := qage.SplitIdentity(identity, splitThreshold, splitShares)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fp := identity.Fingerprint()
+	for i, s := range shares {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# share %d of %d, %d needed to rebuild %s\n", i+1, splitShares, splitThreshold, fp)
+		fmt.Fprintf(&b, "%s\n", s)
+	}
+
+	w, closeOut, err := openSecretOutput(cmd, splitOutput)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	_, err = w.Write([]byte(b.String()))
+	return err
+}
@@ -6,16 +6,56 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/zlobste/qage/internal/version"
+	"github.com/zlobste/qage/pkg/crypto"
+	"github.com/zlobste/qage/pkg/qage"
 )
 
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Show version information",
-	Long:  `Show the version, commit, and build date of qage.`,
-	RunE:  runVersion,
+	Long: `Show the version, commit, and build date of qage, and the cryptographic
+backend in use.
+
+The backend is "circl" by default. In FIPS 140-3 mode, enabled with
+GODEBUG=fips140=on or by building with GOFIPS140, it is "stdlib": the KEMs,
+ECDH and HKDF come from the FIPS 140-3 validated Go Cryptographic Module, new
+keys default to p384-mlkem1024, and keys of X25519 suites are refused. The
+file key is still sealed in each stanza, and the payload encrypted, with
+ChaCha20-Poly1305 from golang.org/x/crypto as the age format requires, which
+is neither approved nor validated.`,
+	RunE: runVersion,
+}
+
+// versionResult is the JSON output of version.
+type versionResult struct {
+	SchemaVersion int    `json:"schema_version"`
+	Version       string `json:"version"`
+	Commit        string `json:"commit,omitempty"`
+	BuildDate     string `json:"build_date,omitempty"`
+	Backend       string `json:"backend"`
+	FIPS140       bool   `json:"fips140"`
 }
 
 func runVersion(cmd *cobra.Command, args []string) error {
-	fmt.Println(version.String())
+	w := cmd.OutOrStdout()
+	backend := qage.DefaultConfig().Backend.Name()
+	if jsonOutput() {
+		return writeJSON(w, versionResult{
+			SchemaVersion: schemaVersion,
+			Version:       version.Version,
+			Commit:        version.Commit,
+			BuildDate:     version.BuildDate,
+			Backend:       backend,
+			FIPS140:       crypto.FIPSMode(),
+		})
+	}
+
+	fips := "off"
+	if crypto.FIPSMode() {
+		fips = "on"
+	}
+	fmt.Fprintln(w, version.String())
+	fmt.Fprintf(w, "Backend: %s\n", backend)
+	fmt.Fprintf(w, "FIPS 140-3 mode: %s\n", fips)
 	return nil
 }
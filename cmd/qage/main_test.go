@@ -2,9 +2,29 @@ package main
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/crypto/ssh"
+
 	"github.com/zlobste/qage/cmd/qage/cmd"
+	"github.com/zlobste/qage/pkg/crypto"
+	"github.com/zlobste/qage/pkg/encoding"
+	"github.com/zlobste/qage/pkg/qage"
 )
 
 func TestRootHelp(t *testing.T) {
@@ -36,3 +56,1253 @@ func TestKeygenCommandDry(t *testing.T) {
 		t.Fatalf("expected key output, got: %s", output)
 	}
 }
+
+func TestKeygenSuite(t *testing.T) {
+	b := &bytes.Buffer{}
+	rootCmd := cmd.NewRootCmd()
+	rootCmd.SetOut(b)
+	rootCmd.SetErr(b)
+	rootCmd.SetArgs([]string{"keygen", "--suite", "p384-mlkem1024"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	output := b.String()
+	if !bytes.Contains([]byte(output), []byte("QAGE-SECRET-KEY-1")) {
+		t.Fatalf("expected key output, got: %s", output)
+	}
+
+	rootCmd.SetArgs([]string{"keygen", "--suite", "bogus"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatalf("expected error for unknown suite")
+	}
+
+	// Reset the shared flag for other tests
+	rootCmd.SetArgs([]string{"keygen", "--suite", "x25519-mlkem768"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+}
+
+func TestPluginEncodings(t *testing.T) {
+	b := &bytes.Buffer{}
+	rootCmd := cmd.NewRootCmd()
+	rootCmd.SetOut(b)
+	rootCmd.SetErr(&bytes.Buffer{})
+	rootCmd.SetArgs([]string{"keygen", "--plugin-identity", "--comment", "age"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, b.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b.Bytes(), []byte("# public key: age1qage1")) || !bytes.Contains(b.Bytes(), []byte("\nAGE-PLUGIN-QAGE-1")) {
+		t.Fatalf("expected a plugin identity file, got: %s", b)
+	}
+
+	b.Reset()
+	rootCmd.SetArgs([]string{"pub", "--plugin", "-i", keyFile})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("pub: %v", err)
+	}
+	if !bytes.HasPrefix(b.Bytes(), []byte("age1qage1")) {
+		t.Fatalf("expected a plugin recipient, got: %s", b)
+	}
+
+	// Reset the shared flags for other tests
+	rootCmd.SetArgs([]string{"keygen", "--plugin-identity=false"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	rootCmd.SetArgs([]string{"pub", "--plugin=false", "-i", keyFile})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("pub: %v", err)
+	}
+}
+
+// execute runs the CLI with the given stdin and arguments and resets every
+// flag afterwards, since the subcommands are shared between root commands.
+func execute(t *testing.T, stdin []byte, args ...string) ([]byte, error) {
+	t.Helper()
+
+	out, _, err := executeStderr(t, stdin, args...)
+	return out, err
+}
+
+// executeStderr is like execute, but also returns what was written to
+// stderr.
+func executeStderr(t *testing.T, stdin []byte, args ...string) (stdout, stderr []byte, err error) {
+	t.Helper()
+
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	rootCmd := cmd.NewRootCmd()
+	rootCmd.SetIn(bytes.NewReader(stdin))
+	rootCmd.SetOut(out)
+	rootCmd.SetErr(errOut)
+	rootCmd.SetArgs(args)
+	err = rootCmd.Execute()
+
+	resetFlags(rootCmd)
+
+	return out.Bytes(), errOut.Bytes(), err
+}
+
+// resetFlags restores the flags of every subcommand of c, recursively, to
+// their defaults.
+func resetFlags(c *cobra.Command) {
+	for _, sub := range c.Commands() {
+		sub.Flags().VisitAll(func(f *pflag.Flag) {
+			if sv, ok := f.Value.(pflag.SliceValue); ok {
+				_ = sv.Replace(nil)
+			} else {
+				_ = f.Value.Set(f.DefValue)
+			}
+			f.Changed = false
+		})
+		resetFlags(sub)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// qage identity
+	qid, err := qage.NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	qidLine, err := qid.FormatFile("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	qageKey := writeFile("qage.txt", qidLine+"\n")
+	qageRecipient, err := qid.Recipient().String()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Native age X25519 identity
+	xid, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ageKey := writeFile("age.txt", "# age key\n"+xid.String()+"\n")
+
+	// SSH Ed25519 key
+	sshPub, sshPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := ssh.NewPublicKey(sshPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(sshPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshKey := writeFile("id_ed25519", string(pem.EncodeToMemory(block)))
+
+	recipientsFile := writeFile("recipients.txt", "# team\n"+string(ssh.MarshalAuthorizedKey(pk))+"\n"+xid.Recipient().String()+"\n")
+
+	plaintext := []byte("streamed through qage encrypt and decrypt")
+
+	// Mixing post-quantum and classical recipients needs an explicit opt-in
+	if _, err := execute(t, plaintext, "encrypt", "-r", qageRecipient, "-R", recipientsFile); err == nil || !strings.Contains(err.Error(), "post-quantum") {
+		t.Fatalf("expected mixed recipients to be refused, got %v", err)
+	}
+
+	for _, armored := range []bool{false, true} {
+		args := []string{"encrypt", "--allow-classical", "-r", qageRecipient, "-R", recipientsFile}
+		if armored {
+			args = append(args, "--armor")
+		}
+		ciphertext, err := execute(t, plaintext, args...)
+		if err != nil {
+			t.Fatalf("encrypt: %v", err)
+		}
+		if armored != bytes.HasPrefix(ciphertext, []byte("-----BEGIN AGE ENCRYPTED FILE-----")) {
+			t.Fatalf("unexpected armor state in output")
+		}
+
+		for _, key := range []string{qageKey, ageKey, sshKey} {
+			out, err := execute(t, ciphertext, "decrypt", "-i", key)
+			if err != nil {
+				t.Fatalf("decrypt with %s: %v", filepath.Base(key), err)
+			}
+			if !bytes.Equal(out, plaintext) {
+				t.Fatalf("decrypt with %s: got %q", filepath.Base(key), out)
+			}
+		}
+	}
+
+	// Files as input and output
+	in := writeFile("plain.txt", string(plaintext))
+	enc := filepath.Join(dir, "plain.txt.age")
+	dec := filepath.Join(dir, "plain.out")
+	if _, err := execute(t, nil, "encrypt", "-r", qageRecipient, "-o", enc, in); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := execute(t, nil, "decrypt", "-i", qageKey, "-o", dec, enc); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if got, _ := os.ReadFile(dec); !bytes.Equal(got, plaintext) {
+		t.Fatalf("decrypted file mismatch: %q", got)
+	}
+
+	// An identity that is not a recipient fails
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := writeFile("other.txt", other.String()+"\n")
+	ciphertext, err := execute(t, plaintext, "encrypt", "-r", qageRecipient)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := execute(t, ciphertext, "decrypt", "-i", otherKey); err == nil {
+		t.Fatal("expected decryption with the wrong identity to fail")
+	}
+
+	// Invalid inputs
+	if _, err := execute(t, plaintext, "encrypt"); err == nil {
+		t.Fatal("expected error without recipients")
+	}
+	if _, err := execute(t, plaintext, "encrypt", "-r", "bogus"); err == nil {
+		t.Fatal("expected error for an unknown recipient type")
+	}
+	badRecipients := writeFile("bad-recipients.txt", "# comment\nage1bogus\n")
+	if _, err := execute(t, plaintext, "encrypt", "-R", badRecipients); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected a line-numbered error, got %v", err)
+	}
+	badKey := writeFile("bad.txt", "# comment\nNOT-A-KEY\n")
+	if _, err := execute(t, ciphertext, "decrypt", "-i", badKey); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected a line-numbered error, got %v", err)
+	}
+}
+
+func TestEncryptDecryptPassphrase(t *testing.T) {
+	t.Setenv("QAGE_PASSPHRASE", "correct horse battery staple")
+	plaintext := []byte("passphrase-protected")
+
+	ciphertext, err := execute(t, plaintext, "encrypt", "--passphrase")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	out, err := execute(t, ciphertext, "decrypt")
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if !bytes.Equal(out, plaintext) {
+		t.Fatalf("decrypt: got %q", out)
+	}
+
+	t.Setenv("QAGE_PASSPHRASE", "wrong")
+	if _, err := execute(t, ciphertext, "decrypt"); err == nil {
+		t.Fatal("expected decryption with the wrong passphrase to fail")
+	}
+
+	id, err := qage.NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := id.Recipient().String()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files without a passphrase stanza need -i, rather than a passphrase
+	encrypted, err := execute(t, plaintext, "encrypt", "-r", r)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := execute(t, encrypted, "decrypt"); err == nil || !strings.Contains(err.Error(), "use -i") {
+		t.Fatalf("expected decrypt without -i to require an identity, got %v", err)
+	}
+	if _, err := execute(t, plaintext, "encrypt", "--passphrase", "-r", r); err == nil {
+		t.Fatal("expected error when combining --passphrase with recipients")
+	}
+}
+
+func TestPubMatchesKeygen(t *testing.T) {
+	id, err := qage.NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := id.FormatFile("pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := id.Recipient().String()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := execute(t, []byte(line+"\n"), "pub")
+	if err != nil {
+		t.Fatalf("pub: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != want {
+		t.Fatalf("pub printed %s..., want %s...", got[:20], want[:20])
+	}
+}
+
+func TestPassphraseProtectedIdentity(t *testing.T) {
+	t.Setenv("QAGE_PASSPHRASE", "hunter2")
+	dir := t.TempDir()
+	plaintext := []byte("protected at rest")
+
+	for _, armored := range []bool{false, true} {
+		keyFile := filepath.Join(dir, fmt.Sprintf("key-%v", armored))
+		args := []string{"keygen", "--passphrase", "-o", keyFile}
+		if armored {
+			args = append(args, "--armor")
+		}
+		if _, err := execute(t, nil, args...); err != nil {
+			t.Fatalf("keygen: %v", err)
+		}
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("QAGE-SECRET-KEY-1")) {
+			t.Fatal("identity file is not encrypted")
+		}
+		if armored != bytes.HasPrefix(data, []byte("-----BEGIN AGE ENCRYPTED FILE-----")) {
+			t.Fatal("unexpected armor state in identity file")
+		}
+
+		recipient, err := execute(t, nil, "pub", "-i", keyFile)
+		if err != nil {
+			t.Fatalf("pub: %v", err)
+		}
+		ciphertext, err := execute(t, plaintext, "encrypt", "-r", strings.TrimSpace(string(recipient)))
+		if err != nil {
+			t.Fatalf("encrypt: %v", err)
+		}
+		out, err := execute(t, ciphertext, "decrypt", "-i", keyFile)
+		if err != nil {
+			t.Fatalf("decrypt: %v", err)
+		}
+		if !bytes.Equal(out, plaintext) {
+			t.Fatalf("decrypt: got %q", out)
+		}
+		if armored {
+			if _, err := execute(t, data, "inspect"); err != nil {
+				t.Fatalf("inspect: %v", err)
+			}
+		}
+	}
+
+	t.Setenv("QAGE_PASSPHRASE", "wrong")
+	if _, err := execute(t, nil, "pub", "-i", filepath.Join(dir, "key-false")); err == nil {
+		t.Fatal("expected pub with the wrong passphrase to fail")
+	}
+
+	if _, err := execute(t, nil, "keygen", "--armor"); err == nil {
+		t.Fatal("expected error for --armor without --passphrase")
+	}
+
+	// Passphrases can also come from a file descriptor, one per line
+	os.Unsetenv("QAGE_PASSPHRASE")
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	if _, err := pw.WriteString("from-fd\nfrom-fd\n"); err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+	t.Setenv("QAGE_PASSPHRASE_FD", fmt.Sprint(pr.Fd()))
+
+	keyFile := filepath.Join(dir, "key-fd")
+	if _, err := execute(t, nil, "keygen", "--passphrase", "-o", keyFile); err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	if _, err := execute(t, nil, "pub", "-i", keyFile); err != nil {
+		t.Fatalf("pub: %v", err)
+	}
+}
+
+func TestMultiIdentityFile(t *testing.T) {
+	var file strings.Builder
+	var want []string
+	for _, year := range []string{"2024", "2025"} {
+		id, err := qage.NewIdentity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := id.FormatFile(year)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := id.Recipient().String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString("# " + year + "\n" + line + "\n")
+		want = append(want, r)
+	}
+	native, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(native.String() + "\n")
+	want = append(want, native.Recipient().String())
+
+	out, err := execute(t, []byte(file.String()), "pub")
+	if err != nil {
+		t.Fatalf("pub: %v", err)
+	}
+	if got := strings.Fields(string(out)); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("pub printed %d recipients, want %d matching ones", len(got), len(want))
+	}
+
+	out, err = execute(t, []byte(file.String()), "inspect")
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	for _, s := range []string{"Comment: 2024", "Comment: 2025", "Type: age X25519 identity", want[2]} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("inspect output is missing %q", s)
+		}
+	}
+}
+
+func TestHybridIdentities(t *testing.T) {
+	dir := t.TempDir()
+
+	qid, err := qage.NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	qidLine, err := qid.FormatFile("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hid, err := age.GenerateHybridIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := filepath.Join(dir, "keys.txt")
+	if err := os.WriteFile(keys, []byte(qidLine+"\n"+hid.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := execute(t, nil, "pub", "-i", keys)
+	if err != nil {
+		t.Fatalf("pub: %v", err)
+	}
+	recipients := strings.Fields(string(out))
+	if len(recipients) != 2 || recipients[1] != hid.Recipient().String() {
+		t.Fatalf("pub printed %q", recipients)
+	}
+
+	// qage and age1pq1 recipients mix without --allow-classical
+	plaintext := []byte("for both ecosystems")
+	ciphertext, err := execute(t, plaintext, "encrypt", "-r", recipients[0], "-r", recipients[1])
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	hybridKey := filepath.Join(dir, "hybrid.txt")
+	if err := os.WriteFile(hybridKey, []byte(hid.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out, err = execute(t, ciphertext, "decrypt", "-i", hybridKey)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if !bytes.Equal(out, plaintext) {
+		t.Fatalf("decrypt: got %q", out)
+	}
+
+	// age hybrid identities convert to themselves, compact qage ones to the
+	// age identity with the same seed
+	out, err = execute(t, nil, "convert", "-i", keys)
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if !strings.Contains(string(out), "# public key: "+recipients[1]+"\n"+hid.String()+"\n") {
+		t.Fatalf("unexpected convert output:\n%s", out)
+	}
+	converted, err := qage.ParseIdentities(bytes.NewReader(out))
+	if err != nil || len(converted) != 2 {
+		t.Fatalf("convert output has %d identities: %v", len(converted), err)
+	}
+	want, err := qid.HybridIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := converted[0].(*age.HybridIdentity); !ok || got.String() != want.String() {
+		t.Fatalf("unexpected converted identity %v", converted[0])
+	}
+
+	// Other identities explain why not
+	p384, err := qage.NewIdentityWithConfig(qage.Config{Suite: qage.HybridP384MLKEM1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Line, err := p384.FormatFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key := filepath.Join(dir, "p384.txt")
+	if err := os.WriteFile(p384Key, []byte(hid.String()+"\n"+p384Line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execute(t, nil, "convert", "-i", p384Key); err == nil || !strings.Contains(err.Error(), "identity 2") || !strings.Contains(err.Error(), "ML-KEM-768 with X25519") {
+		t.Fatalf("expected convert to explain the failure, got %v", err)
+	}
+}
+
+func TestKeyCompact(t *testing.T) {
+	dir := t.TempDir()
+
+	// An identity as written by releases before the compact format, with
+	// an expanded ML-KEM secret key
+	dh, err := crypto.Circl().DH(crypto.X25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519Secret, _, err := dh.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kem, err := crypto.Circl().KEM(crypto.MLKEM768)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := make([]byte, kem.SeedSize())
+	if _, err := rand.Read(seed); err != nil {
+		t.Fatal(err)
+	}
+	sk, err := kem.NewPrivateKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mlkemSecret, err := sk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyLine, err := encoding.FormatIdentityFile(&encoding.Identity{
+		Suite:        encoding.HybridX25519MLKEM768,
+		X25519Secret: [32]byte(x25519Secret),
+		MLKEMSecret:  mlkemSecret,
+	}, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := filepath.Join(dir, "legacy.txt")
+	if err := os.WriteFile(legacy, []byte(legacyLine+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := execute(t, nil, "key", "compact", "-i", legacy); err == nil || !strings.Contains(err.Error(), "keygen") {
+		t.Fatalf("expected an error for a file without compact identities, got %v", err)
+	}
+
+	// Compact identities are kept, old ones copied with a warning
+	keygenOut, err := execute(t, nil, "keygen", "--comment", "new")
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	if len(keygenOut) > 150 {
+		t.Errorf("keygen wrote a %d-byte identity file", len(keygenOut))
+	}
+	mixed := filepath.Join(dir, "mixed.txt")
+	if err := os.WriteFile(mixed, []byte("# keys\n"+legacyLine+"\n"+string(keygenOut)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := execute(t, nil, "key", "compact", "-i", mixed, "--plugin-identity")
+	if err != nil {
+		t.Fatalf("key compact: %v", err)
+	}
+	ids, err := qage.ParseIdentities(bytes.NewReader(out))
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("key compact output has %d identities: %v", len(ids), err)
+	}
+	if ids[0].(*qage.Identity).Compact() || !ids[1].(*qage.Identity).Compact() {
+		t.Error("unexpected identity formats after key compact")
+	}
+	if !strings.Contains(string(out), "# new\n# public key: age1qage1") {
+		t.Errorf("comment not preserved:\n%s", out)
+	}
+}
+
+func TestMnemonicRestore(t *testing.T) {
+	t.Setenv("QAGE_PASSPHRASE", "extra words")
+
+	for _, suite := range []string{"x25519-mlkem768", "p384-mlkem1024"} {
+		for _, withPass := range []bool{false, true} {
+			args := []string{"keygen", "--mnemonic", "--suite", suite, "--comment", "paper"}
+			restoreArgs := []string{"restore", "--suite", suite, "--comment", "paper"}
+			if withPass {
+				args = append(args, "--mnemonic-passphrase")
+				restoreArgs = append(restoreArgs, "--mnemonic-passphrase")
+			}
+			keyLine, stderr, err := executeStderr(t, nil, args...)
+			if err != nil {
+				t.Fatalf("keygen --mnemonic: %v", err)
+			}
+
+			// Pick the words out of the numbered grid
+			words := make([]string, 24)
+			fields := strings.Fields(string(stderr))
+			for i := 0; i+1 < len(fields); i++ {
+				n, err := strconv.Atoi(strings.TrimSuffix(fields[i], "."))
+				if err == nil && strings.HasSuffix(fields[i], ".") && n >= 1 && n <= 24 {
+					words[n-1] = fields[i+1]
+				}
+			}
+			if slices.Contains(words, "") {
+				t.Fatalf("missing words in:\n%s", stderr)
+			}
+			var fingerprint string
+			if i := slices.Index(fields, "Fingerprint:"); i >= 0 && i+1 < len(fields) {
+				fingerprint = fields[i+1]
+			}
+			if !strings.HasPrefix(fingerprint, "qagefp:") {
+				t.Fatalf("no fingerprint in:\n%s", stderr)
+			}
+
+			// The words, spread over lines, rebuild the exact identity line
+			phrase := strings.Join(words[:10], " ") + "\n" + strings.Join(words[10:], "  ") + "\n"
+			out, restoreErr, err := executeStderr(t, []byte(phrase), restoreArgs...)
+			if err != nil {
+				t.Fatalf("restore: %v", err)
+			}
+			if !bytes.Equal(out, keyLine) {
+				t.Fatalf("restored identity doesn't match:\n%s\n%s", out, keyLine)
+			}
+			if !strings.Contains(string(restoreErr), "Fingerprint: "+fingerprint) {
+				t.Errorf("restore printed %q", restoreErr)
+			}
+		}
+	}
+
+	// A misordered phrase fails the checksum
+	if _, err := execute(t, []byte("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art abandon"), "restore"); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+	if _, err := execute(t, []byte("abandon abandon"), "restore"); err == nil || !strings.Contains(err.Error(), "2 words") {
+		t.Errorf("expected a length error, got %v", err)
+	}
+	if _, err := execute(t, nil, "keygen", "--mnemonic-passphrase"); err == nil {
+		t.Error("expected --mnemonic-passphrase to require --mnemonic")
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.txt")
+	keyLine, err := execute(t, nil, "keygen", "--comment", "recovery")
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	if err := os.WriteFile(keyFile, keyLine, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := execute(t, nil, "split", "-k", "3", "-n", "5", "-i", keyFile)
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	var shares []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "qagshare1") {
+			shares = append(shares, line)
+		}
+	}
+	if len(shares) != 5 || !strings.Contains(string(out), "# share 5 of 5, 3 needed to rebuild qagefp:") {
+		t.Fatalf("unexpected split output:\n%s", out)
+	}
+
+	// Three shares, from files or stdin, rebuild the identity
+	var files []string
+	for i, s := range shares[1:4] {
+		f := filepath.Join(dir, fmt.Sprintf("share%d", i))
+		if err := os.WriteFile(f, []byte("# a share\n"+s+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	rebuilt, stderr, err := executeStderr(t, nil, append([]string{"combine", "-c", "recovery"}, files...)...)
+	if err != nil {
+		t.Fatalf("combine: %v", err)
+	}
+	if !bytes.Equal(rebuilt, keyLine) {
+		t.Errorf("combined identity doesn't match:\n%s\n%s", rebuilt, keyLine)
+	}
+	if !strings.Contains(string(stderr), "Fingerprint: qagefp:") {
+		t.Errorf("combine printed %q", stderr)
+	}
+	rebuilt, err = execute(t, []byte(shares[4]+"\n\n"+shares[0]+"\n"+shares[2]+"\n"), "combine", "-c", "recovery")
+	if err != nil || !bytes.Equal(rebuilt, keyLine) {
+		t.Errorf("combine from stdin: %v", err)
+	}
+
+	if _, err := execute(t, []byte(shares[0]+"\n"+shares[1]+"\n"), "combine"); err == nil || !strings.Contains(err.Error(), "3 shares are needed") {
+		t.Errorf("expected an error about missing shares, got %v", err)
+	}
+	if _, err := execute(t, nil, "split", "-k", "4", "-n", "3", "-i", keyFile); err == nil {
+		t.Error("expected error for a threshold above the number of shares")
+	}
+}
+
+func TestEncryptThreshold(t *testing.T) {
+	dir := t.TempDir()
+	var keys, recipients []string
+	for _, name := range []string{"alice", "bob", "carol"} {
+		keyFile := filepath.Join(dir, name)
+		if _, err := execute(t, nil, "keygen", "-o", keyFile); err != nil {
+			t.Fatalf("keygen: %v", err)
+		}
+		pub, err := execute(t, nil, "pub", "-i", keyFile)
+		if err != nil {
+			t.Fatalf("pub: %v", err)
+		}
+		keys = append(keys, keyFile)
+		recipients = append(recipients, "-r", strings.TrimSpace(string(pub)))
+	}
+
+	plaintext := []byte("two of three")
+	encrypted := filepath.Join(dir, "secret.age")
+	args := append([]string{"encrypt", "--threshold", "2", "-o", encrypted}, recipients...)
+	if _, err := execute(t, plaintext, args...); err != nil {
+		t.Fatalf("encrypt --threshold: %v", err)
+	}
+
+	out, err := execute(t, nil, "decrypt", "-i", keys[2], "-i", keys[0], encrypted)
+	if err != nil {
+		t.Fatalf("decrypt with two keys: %v", err)
+	}
+	if !bytes.Equal(out, plaintext) {
+		t.Errorf("decrypted %q", out)
+	}
+	if _, err := execute(t, nil, "decrypt", "-i", keys[1], encrypted); err == nil || !strings.Contains(err.Error(), "found 1 of the 2 threshold shares") {
+		t.Errorf("expected an error counting shares, got %v", err)
+	}
+
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := append([]string{"encrypt", "--threshold", "2", "--allow-classical", "-r", x25519.Recipient().String()}, recipients...)
+	if _, err := execute(t, plaintext, bad...); err == nil || !strings.Contains(err.Error(), "only supports qage recipients") {
+		t.Errorf("expected an error for a classical recipient, got %v", err)
+	}
+	if _, err := execute(t, plaintext, append([]string{"encrypt", "--threshold", "4"}, recipients...)...); err == nil {
+		t.Error("expected error for a threshold above the number of recipients")
+	}
+}
+
+func TestRekey(t *testing.T) {
+	dir := t.TempDir()
+	var keys, recipients []string
+	for _, name := range []string{"alice", "bob", "carol"} {
+		keyFile := filepath.Join(dir, name)
+		if _, err := execute(t, nil, "keygen", "-o", keyFile); err != nil {
+			t.Fatalf("keygen: %v", err)
+		}
+		pub, err := execute(t, nil, "pub", "-i", keyFile)
+		if err != nil {
+			t.Fatalf("pub: %v", err)
+		}
+		keys = append(keys, keyFile)
+		recipients = append(recipients, strings.TrimSpace(string(pub)))
+	}
+
+	plaintext := []byte("archive contents")
+	encrypted := filepath.Join(dir, "archive.age")
+	if _, err := execute(t, plaintext, "encrypt", "--armor", "-r", recipients[0], "-o", encrypted); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	// Add bob, keeping the armor
+	added := filepath.Join(dir, "added.age")
+	if _, err := execute(t, nil, "rekey", "-i", keys[0], "-r", recipients[1], "-o", added, encrypted); err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if data, _ := os.ReadFile(added); !bytes.HasPrefix(data, []byte("-----BEGIN AGE ENCRYPTED FILE-----")) {
+		t.Error("rekeyed file is not armored")
+	}
+	for _, key := range keys[:2] {
+		if out, err := execute(t, nil, "decrypt", "-i", key, added); err != nil || !bytes.Equal(out, plaintext) {
+			t.Errorf("decrypt with %s: %v", filepath.Base(key), err)
+		}
+	}
+
+	// Remove alice and add carol
+	removed := filepath.Join(dir, "removed.age")
+	_, stderr, err := executeStderr(t, nil, "rekey", "-i", keys[1], "--remove", "1", "-r", recipients[2], "-o", removed, added)
+	if err != nil {
+		t.Fatalf("rekey --remove: %v", err)
+	}
+	if len(stderr) != 0 {
+		t.Errorf("unexpected warning %q", stderr)
+	}
+	if _, err := execute(t, nil, "decrypt", "-i", keys[0], removed); err == nil {
+		t.Error("removed recipient can still decrypt")
+	}
+	for _, key := range keys[1:] {
+		if out, err := execute(t, nil, "decrypt", "-i", key, removed); err != nil || !bytes.Equal(out, plaintext) {
+			t.Errorf("decrypt with %s: %v", filepath.Base(key), err)
+		}
+	}
+
+	// Replace everyone with alice
+	replaced := filepath.Join(dir, "replaced.age")
+	if _, err := execute(t, nil, "rekey", "-i", keys[2], "--replace", "-r", recipients[0], "-o", replaced, removed); err != nil {
+		t.Fatalf("rekey --replace: %v", err)
+	}
+	if _, err := execute(t, nil, "decrypt", "-i", keys[1], replaced); err == nil {
+		t.Error("replaced recipient can still decrypt")
+	}
+
+	// Add a classical recipient to the post-quantum file
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execute(t, nil, "rekey", "-i", keys[0], "-r", x25519.Recipient().String(), replaced); err == nil {
+		t.Error("expected error adding a classical recipient without --allow-classical")
+	}
+	classical := filepath.Join(dir, "classical.age")
+	if _, err := execute(t, nil, "rekey", "-i", keys[0], "--allow-classical", "-r", x25519.Recipient().String(), "-o", classical, replaced); err != nil {
+		t.Fatalf("rekey --allow-classical: %v", err)
+	}
+	x25519Key := filepath.Join(dir, "x25519")
+	if err := os.WriteFile(x25519Key, []byte(x25519.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{keys[0], x25519Key} {
+		if out, err := execute(t, nil, "decrypt", "-i", key, classical); err != nil || !bytes.Equal(out, plaintext) {
+			t.Errorf("decrypt with %s: %v", filepath.Base(key), err)
+		}
+	}
+
+	// Failures leave no output file, and never touch the input
+	failed := filepath.Join(dir, "failed.age")
+	if _, err := execute(t, nil, "rekey", "-i", keys[1], "-r", recipients[1], "-o", failed, replaced); err == nil {
+		t.Error("expected error rekeying with an identity that can't decrypt")
+	}
+	if _, err := execute(t, nil, "rekey", "-i", keys[0], "--remove", "2", "-o", failed, replaced); err == nil || !strings.Contains(err.Error(), "numbered from 1 to 1") {
+		t.Errorf("expected error removing a stanza that doesn't exist, got %v", err)
+	}
+	if _, err := os.Stat(failed); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("failed rekey left an output file: %v", err)
+	}
+	if _, err := execute(t, nil, "rekey", "-i", keys[0], "-r", recipients[1], "-o", replaced, replaced); err == nil {
+		t.Error("expected error writing over the input file")
+	}
+	if out, err := execute(t, nil, "decrypt", "-i", keys[0], replaced); err != nil || !bytes.Equal(out, plaintext) {
+		t.Errorf("input file damaged: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); slices.ContainsFunc(entries, func(e os.DirEntry) bool { return strings.HasSuffix(e.Name(), ".tmp") }) {
+		t.Error("failed rekey left a temporary file")
+	}
+
+	if _, err := execute(t, nil, "rekey", "-i", keys[0], replaced); err == nil {
+		t.Error("expected error with nothing to do")
+	}
+}
+
+func TestInspectFile(t *testing.T) {
+	dir := t.TempDir()
+	keys := make([]string, 2)
+	var recipients []string
+	for i := range keys {
+		keys[i] = filepath.Join(dir, fmt.Sprintf("key%d", i))
+		if _, err := execute(t, nil, "keygen", "-o", keys[i]); err != nil {
+			t.Fatalf("keygen: %v", err)
+		}
+		pub, err := execute(t, nil, "pub", "-i", keys[i])
+		if err != nil {
+			t.Fatalf("pub: %v", err)
+		}
+		recipients = append(recipients, "-r", strings.TrimSpace(string(pub)))
+	}
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted := filepath.Join(dir, "secret.age")
+	args := append([]string{"encrypt", "--armor", "--allow-classical", "-r", x25519.Recipient().String(), "-o", encrypted}, recipients...)
+	if _, err := execute(t, []byte("hello"), args...); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	out, err := execute(t, nil, "inspect-file", "-i", keys[1], encrypted)
+	if err != nil {
+		t.Fatalf("inspect-file: %v", err)
+	}
+	for _, want := range []string{
+		"Armored: yes",
+		"3 recipient stanzas",
+		"(5 bytes of plaintext)",
+		"Post-quantum: partially",
+		"Stanza 1: X25519 ",
+		"Stanza 3: qage x25519-mlkem768 c2\n  Recipient: qage X25519+ML-KEM-768, transcript combiner\n  Body: 1152 bytes\n  Matched by: " + keys[1],
+		"Matched by: none",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out)
+		}
+	}
+
+	out, err = execute(t, nil, "inspect-file", "--format", "json", "-i", keys[0], encrypted)
+	if err != nil {
+		t.Fatalf("inspect-file --format json: %v", err)
+	}
+	if alias, err := execute(t, nil, "inspect-file", "--json", "-i", keys[0], encrypted); err != nil || !bytes.Equal(alias, out) {
+		t.Errorf("inspect-file --json differs from --format json: %v\n%s", err, alias)
+	}
+	var result struct {
+		Armored    bool     `json:"armored"`
+		Identities []string `json:"identities"`
+		Stanzas    []struct {
+			Type        string `json:"type"`
+			PostQuantum bool   `json:"post_quantum"`
+			MatchedBy   []int  `json:"matched_by"`
+		} `json:"stanzas"`
+		PlaintextSize int64 `json:"plaintext_size"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if !result.Armored || len(result.Stanzas) != 3 || result.PlaintextSize != 5 ||
+		result.Stanzas[0].PostQuantum || !result.Stanzas[1].PostQuantum ||
+		!slices.Equal(result.Stanzas[1].MatchedBy, []int{0}) || result.Identities[0] != keys[0] {
+		t.Errorf("unexpected JSON output:\n%s", out)
+	}
+
+	if _, err := execute(t, []byte("not an age file\n"), "inspect-file"); err == nil {
+		t.Error("expected error for a file that isn't an age file")
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key")
+	out, err := execute(t, nil, "--format", "json", "keygen", "--suite", "p384-mlkem1024", "-c", "ci", "-o", key)
+	if err != nil {
+		t.Fatalf("keygen --format json: %v", err)
+	}
+	var keygen struct {
+		SchemaVersion int    `json:"schema_version"`
+		Source        string `json:"source"`
+		Created       string `json:"created"`
+		File          string `json:"file"`
+		IdentityFile  string `json:"identity_file"`
+		Identity      struct {
+			Type        string `json:"type"`
+			Suite       string `json:"suite"`
+			SuiteID     int    `json:"suite_id"`
+			Comment     string `json:"comment"`
+			Format      string `json:"format"`
+			Recipient   string `json:"recipient"`
+			Fingerprint string `json:"fingerprint"`
+			Sizes       struct {
+				ECPublicKey    int `json:"ec_public_key"`
+				MLKEMPublicKey int `json:"mlkem_public_key"`
+			} `json:"sizes"`
+		} `json:"identity"`
+	}
+	if err := json.Unmarshal(out, &keygen); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	id := keygen.Identity
+	if keygen.SchemaVersion != 1 || keygen.Source != "random" || keygen.Created == "" || keygen.File != key || keygen.IdentityFile != "" {
+		t.Errorf("unexpected keygen output:\n%s", out)
+	}
+	if id.Type != "qage" || id.Suite != "p384-mlkem1024" || id.SuiteID != 3 || id.Comment != "ci" || id.Format != "compact" {
+		t.Errorf("unexpected identity description:\n%s", out)
+	}
+	if id.Sizes.ECPublicKey != 97 || id.Sizes.MLKEMPublicKey != 1568 {
+		t.Errorf("unexpected key sizes:\n%s", out)
+	}
+
+	pub, err := execute(t, nil, "pub", "-i", key)
+	if err != nil {
+		t.Fatalf("pub: %v", err)
+	}
+	if id.Recipient != strings.TrimSpace(string(pub)) {
+		t.Errorf("keygen reported recipient %q, pub printed %q", id.Recipient, pub)
+	}
+
+	for _, c := range []struct {
+		command, field string
+	}{
+		{"pub", "recipients"},
+		{"inspect", "identities"},
+	} {
+		out, err := execute(t, nil, "--format", "json", c.command, "-i", key)
+		if err != nil {
+			t.Fatalf("%s --format json: %v", c.command, err)
+		}
+		var result map[string]json.RawMessage
+		if err := json.Unmarshal(out, &result); err != nil {
+			t.Fatalf("%s: invalid JSON: %v\n%s", c.command, err, out)
+		}
+		var keys []struct {
+			Recipient   string `json:"recipient"`
+			Fingerprint string `json:"fingerprint"`
+		}
+		if err := json.Unmarshal(result[c.field], &keys); err != nil || len(keys) != 1 {
+			t.Fatalf("%s: unexpected %s: %v\n%s", c.command, c.field, err, out)
+		}
+		if keys[0].Recipient != id.Recipient || keys[0].Fingerprint != id.Fingerprint {
+			t.Errorf("%s: key doesn't match keygen:\n%s", c.command, out)
+		}
+	}
+
+	// Without -o, the identity file is part of the JSON output
+	out, err = execute(t, nil, "--format", "json", "keygen")
+	if err != nil {
+		t.Fatalf("keygen --format json: %v", err)
+	}
+	if err := json.Unmarshal(out, &keygen); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if _, err := qage.ParseIdentities(strings.NewReader(keygen.IdentityFile)); err != nil {
+		t.Errorf("invalid identity_file: %v\n%s", err, out)
+	}
+
+	// Errors are JSON objects too
+	root := cmd.NewRootCmd()
+	root.SilenceErrors = true
+	errOut := &bytes.Buffer{}
+	root.SetIn(strings.NewReader("not a key"))
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(errOut)
+	root.SetArgs([]string{"--format", "json", "inspect"})
+	err = root.Execute()
+	if err == nil {
+		t.Fatal("expected error for an invalid identity")
+	}
+	cmd.PrintError(root, err)
+	var jsonErr struct {
+		SchemaVersion int `json:"schema_version"`
+		Error         struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(errOut.Bytes(), &jsonErr); err != nil || jsonErr.Error.Message == "" {
+		t.Errorf("expected a JSON error, got %v:\n%s", err, errOut)
+	}
+
+	if _, err := execute(t, nil, "--format", "yaml", "pub", "-i", key); err == nil {
+		t.Error("expected error for an unknown --format")
+	}
+}
+
+func TestFingerprintCommand(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key")
+	_, stderr, err := executeStderr(t, nil, "keygen", "-o", key)
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	if !strings.HasPrefix(string(stderr), "Fingerprint: qagefp:") || !strings.Contains(string(stderr), "Verification words: ") || !strings.Contains(string(stderr), "+----[qagefp]-----+") {
+		t.Fatalf("keygen printed %q", stderr)
+	}
+
+	verification, err := execute(t, nil, "pub", "--fingerprint", "-i", key)
+	if err != nil {
+		t.Fatalf("pub --fingerprint: %v", err)
+	}
+	if !bytes.Equal(verification, stderr) {
+		t.Errorf("pub --fingerprint doesn't match keygen:\n%s\n%s", verification, stderr)
+	}
+	inspect, err := execute(t, nil, "inspect", "-i", key)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if !bytes.HasSuffix(inspect, verification) {
+		t.Errorf("inspect doesn't show the fingerprint:\n%s", inspect)
+	}
+
+	// The recipient, in either encoding, has the same fingerprint
+	for _, plugin := range []bool{false, true} {
+		args := []string{"pub", "-i", key}
+		if plugin {
+			args = append(args, "--plugin")
+		}
+		recipient, err := execute(t, nil, args...)
+		if err != nil {
+			t.Fatalf("pub: %v", err)
+		}
+		out, err := execute(t, nil, "fingerprint", strings.TrimSpace(string(recipient)))
+		if err != nil {
+			t.Fatalf("fingerprint: %v", err)
+		}
+		if !bytes.Equal(out, verification) {
+			t.Errorf("fingerprint doesn't match pub --fingerprint:\n%s\n%s", out, verification)
+		}
+
+		out, err = execute(t, recipient, "--format", "json", "fingerprint")
+		if err != nil {
+			t.Fatalf("fingerprint --format json: %v", err)
+		}
+		var result struct {
+			Recipients []struct {
+				VerificationWords string `json:"verification_words"`
+				Randomart         string `json:"randomart"`
+			} `json:"recipients"`
+		}
+		if err := json.Unmarshal(out, &result); err != nil || len(result.Recipients) != 1 {
+			t.Fatalf("invalid JSON: %v\n%s", err, out)
+		}
+		if r := result.Recipients[0]; !strings.Contains(string(verification), r.VerificationWords) || !strings.HasSuffix(string(verification), r.Randomart) {
+			t.Errorf("JSON doesn't match text output:\n%s", out)
+		}
+	}
+
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execute(t, nil, "fingerprint", x25519.Recipient().String()); err == nil {
+		t.Error("expected error for an age recipient")
+	}
+}
+
+func TestEncryptKeyHint(t *testing.T) {
+	dir := t.TempDir()
+	var keys, recipients []string
+	for _, name := range []string{"alice", "bob"} {
+		keyFile := filepath.Join(dir, name)
+		if _, err := execute(t, nil, "keygen", "-o", keyFile); err != nil {
+			t.Fatalf("keygen: %v", err)
+		}
+		pub, err := execute(t, nil, "pub", "-i", keyFile)
+		if err != nil {
+			t.Fatalf("pub: %v", err)
+		}
+		keys = append(keys, keyFile)
+		recipients = append(recipients, "-r", strings.TrimSpace(string(pub)))
+	}
+
+	plaintext := []byte("hinted")
+	encrypted := filepath.Join(dir, "secret.age")
+	if _, err := execute(t, plaintext, append([]string{"encrypt", "--key-hint", "-o", encrypted}, recipients...)...); err != nil {
+		t.Fatalf("encrypt --key-hint: %v", err)
+	}
+
+	out, err := execute(t, nil, "inspect-file", encrypted)
+	if err != nil {
+		t.Fatalf("inspect-file: %v", err)
+	}
+	hints := regexp.MustCompile(`Stanza \d: qage x25519-mlkem768 c2 (\S+)\n`).FindAllStringSubmatch(string(out), -1)
+	if len(hints) != 2 || hints[0][1] == hints[1][1] {
+		t.Errorf("expected two different key hints in inspect-file output:\n%s", out)
+	}
+
+	for _, key := range keys {
+		out, err := execute(t, nil, "decrypt", "-i", key, encrypted)
+		if err != nil {
+			t.Fatalf("decrypt: %v", err)
+		}
+		if !bytes.Equal(out, plaintext) {
+			t.Errorf("decrypted %q", out)
+		}
+	}
+}
+
+func TestVersionBackend(t *testing.T) {
+	out, err := execute(t, nil, "version")
+	if err != nil {
+		t.Fatalf("version: %v", err)
+	}
+	if !strings.Contains(string(out), "Backend: circl\n") || !strings.Contains(string(out), "FIPS 140-3 mode: off\n") {
+		t.Errorf("unexpected version output:\n%s", out)
+	}
+
+	out, err = execute(t, nil, "--format", "json", "version")
+	if err != nil {
+		t.Fatalf("version --format json: %v", err)
+	}
+	var result struct {
+		SchemaVersion int    `json:"schema_version"`
+		Version       string `json:"version"`
+		Backend       string `json:"backend"`
+		FIPS140       bool   `json:"fips140"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if result.SchemaVersion != 1 || result.Version == "" || result.Backend != "circl" || result.FIPS140 {
+		t.Errorf("unexpected version output:\n%s", out)
+	}
+}
+
+func TestSelftestVectors(t *testing.T) {
+	out, errOut, err := executeStderr(t, nil, "selftest", "--vectors")
+	if err != nil {
+		t.Fatalf("selftest --vectors: %v\n%s", err, errOut)
+	}
+	if len(out) != 0 || len(errOut) != 0 {
+		t.Errorf("unexpected output:\n%s%s", out, errOut)
+	}
+}
+
+func TestSelftestVerbose(t *testing.T) {
+	out, err := execute(t, nil, "selftest", "-v")
+	if err != nil {
+		t.Fatalf("selftest -v: %v", err)
+	}
+	for _, want := range []string{
+		"PASS  ML-KEM-768 keyGen (ACVP tcId 26)\n",
+		"PASS  ML-KEM-1024 decapsulation, implicitly rejected ciphertext (ACVP tcId 97)\n",
+		"PASS  ML-KEM-768 decapsulation from seed, rejected ciphertext (ACVP keyGen tcId 27)\n",
+		"PASS  X25519 key agreement (RFC 7748 section 6.1)\n",
+		"PASS  HKDF-SHA-256 (RFC 5869 test case 3)\n",
+		"PASS  age integration\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "FAIL") || strings.Contains(string(out), "SKIP") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	out, err = execute(t, nil, "--format", "json", "selftest", "--vectors")
+	if err != nil {
+		t.Fatalf("selftest --format json: %v", err)
+	}
+	var result struct {
+		SchemaVersion int    `json:"schema_version"`
+		Backend       string `json:"backend"`
+		Passed        bool   `json:"passed"`
+		Tests         []struct {
+			Name   string `json:"name"`
+			Result string `json:"result"`
+		} `json:"tests"`
+		Vectors *struct {
+			Checked int `json:"checked"`
+			Skipped int `json:"skipped"`
+		} `json:"vectors"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if result.SchemaVersion != 1 || result.Backend != "circl" || !result.Passed || len(result.Tests) < 4 ||
+		result.Vectors == nil || result.Vectors.Checked == 0 || result.Vectors.Skipped != 0 {
+		t.Errorf("unexpected selftest output:\n%s", out)
+	}
+	for _, test := range result.Tests {
+		if test.Result != "pass" {
+			t.Errorf("%s: %s", test.Name, test.Result)
+		}
+	}
+}
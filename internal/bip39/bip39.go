@@ -0,0 +1,116 @@
+// Package bip39 implements BIP-39 mnemonic phrases with the English word
+// list: encoding entropy as words with a checksum, and stretching a phrase
+// and optional passphrase into a seed.
+package bip39
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+//go:embed english.txt
+var english string
+
+var (
+	wordlist  = strings.Fields(english)
+	wordIndex = func() map[string]int {
+		m := make(map[string]int, len(wordlist))
+		for i, w := range wordlist {
+			m[w] = i
+		}
+		return m
+	}()
+)
+
+// SeedSize is the size of the seed returned by Seed.
+const SeedSize = 64
+
+// ErrChecksum is returned by EntropyFromMnemonic when the checksum of a
+// phrase doesn't match, usually because a word is wrong or out of order.
+var ErrChecksum = errors.New("bip39: invalid mnemonic checksum")
+
+// NewMnemonic encodes entropy of 16 to 32 bytes, in multiples of 4, as a
+// phrase of 12 to 24 words.
+func NewMnemonic(entropy []byte) (string, error) {
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return "", fmt.Errorf("bip39: invalid entropy length %d", len(entropy))
+	}
+
+	// The entropy is followed by the first ENT/32 bits of its SHA-256, and
+	// each 11 bits select a word.
+	h := sha256.Sum256(entropy)
+	bits := append(append([]byte(nil), entropy...), h[0])
+	n := (len(entropy)*8 + len(entropy)/4) / 11
+
+	words := make([]string, n)
+	for i := range words {
+		var idx int
+		for j := 0; j < 11; j++ {
+			idx = idx<<1 | bit(bits, i*11+j)
+		}
+		words[i] = wordlist[idx]
+	}
+	return strings.Join(words, " "), nil
+}
+
+// EntropyFromMnemonic decodes a phrase back to its entropy, checking that
+// every word is in the list and that the checksum matches.
+func EntropyFromMnemonic(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return nil, fmt.Errorf("bip39: invalid mnemonic length %d words", len(words))
+	}
+
+	bits := make([]byte, (len(words)*11+7)/8)
+	for i, w := range words {
+		idx, ok := wordIndex[strings.ToLower(w)]
+		if !ok {
+			return nil, fmt.Errorf("bip39: word %d (%q) is not in the word list", i+1, w)
+		}
+		for j := 0; j < 11; j++ {
+			if idx&(1<<(10-j)) != 0 {
+				pos := i*11 + j
+				bits[pos/8] |= 0x80 >> (pos % 8)
+			}
+		}
+	}
+
+	entropyLen := len(words) * 11 * 32 / 33 / 8
+	entropy := bits[:entropyLen]
+	h := sha256.Sum256(entropy)
+	checksumBits := entropyLen / 4
+	for j := 0; j < checksumBits; j++ {
+		if bit(bits, entropyLen*8+j) != bit(h[:], j) {
+			return nil, ErrChecksum
+		}
+	}
+
+	return append([]byte(nil), entropy...), nil
+}
+
+// Seed stretches a phrase and an optional passphrase into a SeedSize-byte
+// seed with PBKDF2-HMAC-SHA512, after NFKD normalization. It doesn't validate
+// the phrase.
+func Seed(mnemonic, passphrase string) ([]byte, error) {
+	m := norm.NFKD.String(strings.Join(strings.Fields(mnemonic), " "))
+	salt := norm.NFKD.String("mnemonic" + passphrase)
+	seed, err := pbkdf2.Key(sha512.New, m, []byte(salt), 2048, SeedSize)
+	if err != nil {
+		return nil, fmt.Errorf("bip39: %w", err)
+	}
+	return seed, nil
+}
+
+// bit returns the i-th most significant bit of b.
+func bit(b []byte, i int) int {
+	return int(b[i/8]>>(7-i%8)) & 1
+}
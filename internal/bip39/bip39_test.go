@@ -0,0 +1,105 @@
+package bip39
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Test vectors from the BIP-39 reference implementation, with the passphrase
+// "TREZOR".
+var vectors = []struct {
+	entropy  string
+	mnemonic string
+	seed     string
+}{
+	{
+		"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		"ffffffffffffffffffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo when",
+		"0cd6e5d827bb62eb8fc1e262254223817fd068a74b5b449cc2f667c3f1f985a76379b43348d952e2265b4cd129090758b3e3c2c49103b5051aac2eaeb890a528",
+	},
+	{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+		"bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+	},
+	{
+		"8080808080808080808080808080808080808080808080808080808080808080",
+		"letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic bless",
+		"c0c519bd0e91a2ed54357d9d1ebef6f5af218a153624cf4f2da911a0ed8f7a09e2ef61af0aca007096df430022f7a2b6fb91661a9589097069720d015e4e982f",
+	},
+	{
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+		"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	if len(wordlist) != 2048 {
+		t.Fatalf("word list has %d words", len(wordlist))
+	}
+
+	for _, v := range vectors {
+		entropy, _ := hex.DecodeString(v.entropy)
+		mnemonic, err := NewMnemonic(entropy)
+		if err != nil {
+			t.Fatalf("NewMnemonic failed: %v", err)
+		}
+		if mnemonic != v.mnemonic {
+			t.Errorf("NewMnemonic(%s) = %q, want %q", v.entropy, mnemonic, v.mnemonic)
+		}
+
+		got, err := EntropyFromMnemonic(v.mnemonic)
+		if err != nil {
+			t.Fatalf("EntropyFromMnemonic failed: %v", err)
+		}
+		if hex.EncodeToString(got) != v.entropy {
+			t.Errorf("EntropyFromMnemonic(%q) = %x", v.mnemonic, got)
+		}
+
+		seed, err := Seed(v.mnemonic, "TREZOR")
+		if err != nil {
+			t.Fatalf("Seed failed: %v", err)
+		}
+		if hex.EncodeToString(seed) != v.seed {
+			t.Errorf("Seed(%q) = %x", v.mnemonic, seed)
+		}
+	}
+}
+
+func TestEntropyFromMnemonicErrors(t *testing.T) {
+	valid := vectors[3].mnemonic
+	words := strings.Fields(valid)
+
+	// Swapping two words breaks the checksum
+	words[0], words[1] = words[1], words[0]
+	if _, err := EntropyFromMnemonic(strings.Join(words, " ")); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected ErrChecksum, got %v", err)
+	}
+
+	// Extra whitespace and uppercase are tolerated
+	if _, err := EntropyFromMnemonic("  " + strings.ToUpper(valid) + "\n"); err != nil {
+		t.Errorf("EntropyFromMnemonic failed: %v", err)
+	}
+
+	for _, bad := range []string{
+		"",
+		strings.Join(strings.Fields(valid)[:23], " "),
+		strings.Replace(valid, "letter", "lettre", 1),
+	} {
+		if _, err := EntropyFromMnemonic(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	if _, err := NewMnemonic(make([]byte, 20+1)); err == nil {
+		t.Error("expected error for invalid entropy length")
+	}
+}
@@ -0,0 +1,175 @@
+// Package format reads and writes the header of age v1 files, which age
+// itself keeps internal, so that the header can be rewritten while the
+// payload is copied through untouched.
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	intro        = "age-encryption.org/v1\n"
+	stanzaPrefix = "->"
+	footerPrefix = "---"
+
+	// columnsPerLine is the width of wrapped stanza bodies, and bytesPerLine
+	// the number of body bytes on a full line.
+	columnsPerLine = 64
+	bytesPerLine   = columnsPerLine / 4 * 3
+
+	// macSize is the size of the header MAC, an HMAC-SHA-256.
+	macSize = 32
+)
+
+var b64 = base64.RawStdEncoding.Strict()
+
+// Header is the header of an age file: the recipient stanzas and the MAC.
+type Header struct {
+	Stanzas []*age.Stanza
+	MAC     []byte
+}
+
+// Parse reads the header of an age file from r, and returns it with a reader
+// for the rest of the file, starting at the payload nonce.
+func Parse(r io.Reader) (*Header, io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if line != intro {
+		return nil, nil, fmt.Errorf("not an age v1 file: unexpected intro %q", strings.TrimSuffix(line, "\n"))
+	}
+
+	h := &Header{}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		prefix, args := splitArgs(line)
+
+		if prefix == footerPrefix {
+			if len(args) != 1 {
+				return nil, nil, fmt.Errorf("malformed closing line %q", line)
+			}
+			if h.MAC, err = decodeString(args[0]); err != nil || len(h.MAC) != macSize {
+				return nil, nil, fmt.Errorf("malformed closing line %q", line)
+			}
+			break
+		}
+
+		if prefix != stanzaPrefix || len(args) < 1 {
+			return nil, nil, fmt.Errorf("malformed stanza opening line %q", line)
+		}
+		for _, a := range args {
+			if !isValidString(a) {
+				return nil, nil, fmt.Errorf("malformed stanza opening line %q", line)
+			}
+		}
+		s := &age.Stanza{Type: args[0], Args: args[1:]}
+		if s.Body, err = readBody(br); err != nil {
+			return nil, nil, err
+		}
+		h.Stanzas = append(h.Stanzas, s)
+	}
+
+	return h, br, nil
+}
+
+// readBody reads a wrapped base64 stanza body, which always ends with a line
+// shorter than columnsPerLine, possibly empty.
+func readBody(br *bufio.Reader) ([]byte, error) {
+	var body []byte
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		b, err := decodeString(strings.TrimSuffix(line, "\n"))
+		if err != nil || len(b) > bytesPerLine {
+			return nil, fmt.Errorf("malformed stanza body line %q", line)
+		}
+		body = append(body, b...)
+		if len(b) < bytesPerLine {
+			return body, nil
+		}
+	}
+}
+
+// MarshalWithoutMAC writes the header up to and including the "---" that
+// precedes the MAC, which is the input of the MAC.
+func (h *Header) MarshalWithoutMAC(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString(intro)
+	for _, s := range h.Stanzas {
+		buf.WriteString(stanzaPrefix)
+		for _, a := range append([]string{s.Type}, s.Args...) {
+			if !isValidString(a) {
+				return fmt.Errorf("invalid stanza argument %q", a)
+			}
+			buf.WriteString(" " + a)
+		}
+		buf.WriteString("\n")
+
+		body := b64.EncodeToString(s.Body)
+		for len(body) >= columnsPerLine {
+			buf.WriteString(body[:columnsPerLine] + "\n")
+			body = body[columnsPerLine:]
+		}
+		buf.WriteString(body + "\n")
+	}
+	buf.WriteString(footerPrefix)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Marshal writes the complete header.
+func (h *Header) Marshal(w io.Writer) error {
+	if len(h.MAC) != macSize {
+		return errors.New("invalid header MAC length")
+	}
+	if err := h.MarshalWithoutMAC(w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, " "+b64.EncodeToString(h.MAC)+"\n")
+	return err
+}
+
+// decodeString decodes unpadded base64, rejecting the newlines that the
+// standard decoder would skip.
+func decodeString(s string) ([]byte, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return nil, errors.New("unexpected newline")
+	}
+	return b64.DecodeString(s)
+}
+
+func splitArgs(line string) (string, []string) {
+	parts := strings.Split(strings.TrimSuffix(line, "\n"), " ")
+	return parts[0], parts[1:]
+}
+
+// isValidString reports whether s is a valid stanza type or argument: a
+// non-empty string of printable ASCII characters other than space.
+func isValidString(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < 33 || c > 126 {
+			return false
+		}
+	}
+	return true
+}
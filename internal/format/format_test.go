@@ -0,0 +1,91 @@
+package format
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestParseMarshal(t *testing.T) {
+	// Bodies of 0, 48 and 100 bytes exercise empty, exactly full and
+	// wrapped last lines.
+	var stanzas []*age.Stanza
+	for _, n := range []int{0, bytesPerLine, 100} {
+		stanzas = append(stanzas, &age.Stanza{Type: "test", Args: []string{"a", "b"}, Body: bytes.Repeat([]byte{byte(n)}, n)})
+	}
+	h := &Header{Stanzas: stanzas, MAC: bytes.Repeat([]byte{1}, macSize)}
+
+	var buf bytes.Buffer
+	if err := h.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	encoded := buf.String()
+	buf.WriteString("payload")
+
+	parsed, payload, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var again bytes.Buffer
+	if err := parsed.Marshal(&again); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != encoded {
+		t.Errorf("header changed in a round trip:\n%s\n%s", again.String(), encoded)
+	}
+	if rest, _ := io.ReadAll(payload); string(rest) != "payload" {
+		t.Errorf("unexpected payload %q", rest)
+	}
+}
+
+func TestParseAgeFile(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file bytes.Buffer
+	w, err := age.Encrypt(&file, id.Recipient(), id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := age.ExtractHeader(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, _, err := Parse(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(h.Stanzas) != 2 || h.Stanzas[0].Type != "X25519" {
+		t.Fatalf("unexpected stanzas %+v", h.Stanzas)
+	}
+	var got bytes.Buffer
+	if err := h.Marshal(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("header doesn't match age's:\n%s\n%s", got.Bytes(), want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"age-encryption.org/v2\n--- AAAA\n",
+		"age-encryption.org/v1\n-> X25519\n",
+		"age-encryption.org/v1\n-> X25519 \nAAAA\n--- AAAA\n",
+		"age-encryption.org/v1\n-> X25519 arg\n" + strings.Repeat("A", 68) + "\n\n--- AAAA\n",
+		"age-encryption.org/v1\n--- AAAA\n",
+	} {
+		if _, _, err := Parse(strings.NewReader(s)); err == nil {
+			t.Errorf("Parse accepted %q", s)
+		}
+	}
+}
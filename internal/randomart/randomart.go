@@ -0,0 +1,75 @@
+// Package randomart draws fingerprints as OpenSSH-style randomart images,
+// which are easier to compare at a glance than strings of characters.
+package randomart
+
+import "strings"
+
+// Size of the field the bishop walks on.
+const (
+	width  = 17
+	height = 9
+)
+
+// symbols shows how often a square was visited, followed by the start and end
+// squares.
+const symbols = " .o+=*BOX@%&#/^SE"
+
+const (
+	start = len(symbols) - 2
+	end   = len(symbols) - 1
+)
+
+// Render draws the "drunken bishop" walk of OpenSSH over fp: starting in the
+// middle of the field, each pair of bits, from the least significant of each
+// byte, moves the bishop one square diagonally, and squares are marked with
+// how often they were visited. title and footer are centered in the top and
+// bottom borders, and truncated to fit.
+func Render(fp []byte, title, footer string) string {
+	var field [width][height]int
+	x, y := width/2, height/2
+	for _, b := range fp {
+		for i := 0; i < 4; i++ {
+			if b&1 != 0 {
+				x = min(x+1, width-1)
+			} else {
+				x = max(x-1, 0)
+			}
+			if b&2 != 0 {
+				y = min(y+1, height-1)
+			} else {
+				y = max(y-1, 0)
+			}
+			if field[x][y] < start-1 {
+				field[x][y]++
+			}
+			b >>= 2
+		}
+	}
+	field[width/2][height/2] = start
+	field[x][y] = end
+
+	var sb strings.Builder
+	border(&sb, title)
+	for y := 0; y < height; y++ {
+		sb.WriteByte('|')
+		for x := 0; x < width; x++ {
+			sb.WriteByte(symbols[field[x][y]])
+		}
+		sb.WriteString("|\n")
+	}
+	border(&sb, footer)
+	return sb.String()
+}
+
+// border writes a horizontal border with a centered label.
+func border(sb *strings.Builder, label string) {
+	if label != "" {
+		label = "[" + label[:min(len(label), width-2)] + "]"
+	}
+	pad := (width - len(label)) / 2
+	sb.WriteByte('+')
+	sb.WriteString(strings.Repeat("-", pad))
+	sb.WriteString(label)
+	sb.WriteString(strings.Repeat("-", width-pad-len(label)))
+	sb.WriteString("+\n")
+}
@@ -0,0 +1,47 @@
+package randomart
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	// A zero byte moves the bishop up and left four times
+	want := `+-----[title]-----+
+|    E            |
+|     .           |
+|      .          |
+|       .         |
+|        S        |
+|                 |
+|                 |
+|                 |
+|                 |
++-----------------+
+`
+	if got := Render([]byte{0}, "title", ""); got != want {
+		t.Errorf("unexpected randomart:\n%s\nexpected:\n%s", got, want)
+	}
+
+	// The bishop stays in the field and marks repeated visits
+	art := Render([]byte{0xff, 0xff, 0xff, 0xff, 0x00, 0x00}, "a very long title", "footer")
+	lines := strings.Split(strings.TrimSuffix(art, "\n"), "\n")
+	if len(lines) != height+2 {
+		t.Fatalf("expected %d lines, got %d:\n%s", height+2, len(lines), art)
+	}
+	for _, l := range lines {
+		if len(l) != width+2 {
+			t.Errorf("line %q is not %d characters wide", l, width+2)
+		}
+	}
+	if !strings.Contains(lines[0], "[a very long tit]") || !strings.Contains(lines[height+1], "[footer]") {
+		t.Errorf("unexpected borders:\n%s", art)
+	}
+	if !strings.Contains(art, "S") || !strings.Contains(art, "E") || !strings.ContainsAny(art, "o+=*") {
+		t.Errorf("unexpected walk:\n%s", art)
+	}
+
+	if Render([]byte{1, 2, 3}, "", "") == Render([]byte{3, 2, 1}, "", "") {
+		t.Error("different fingerprints have the same randomart")
+	}
+}
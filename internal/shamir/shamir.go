@@ -0,0 +1,122 @@
+// Package shamir implements Shamir's secret sharing over GF(256), splitting
+// each byte of a secret independently with the AES field polynomial.
+package shamir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxShares is the largest number of shares, since each share is identified
+// by a distinct non-zero field element.
+const MaxShares = 255
+
+// Share is one share of a secret: the value of the random polynomials at
+// Index, which is never zero.
+type Share struct {
+	Index byte
+	Value []byte
+}
+
+// Split splits secret into n shares, any threshold of which recover it with
+// Combine, and fewer of which reveal nothing about it. The shares have
+// indexes 1 to n. The polynomial coefficients are read from rand.
+func Split(secret []byte, threshold, n int, rand io.Reader) ([]Share, error) {
+	if threshold < 2 || threshold > n {
+		return nil, fmt.Errorf("shamir: invalid threshold %d of %d shares", threshold, n)
+	}
+	if n > MaxShares {
+		return nil, fmt.Errorf("shamir: at most %d shares are supported", MaxShares)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("shamir: empty secret")
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{Index: byte(i + 1), Value: make([]byte, len(secret))}
+	}
+
+	// Each byte of the secret is the constant term of its own polynomial of
+	// degree threshold-1, evaluated with Horner's method.
+	coeffs := make([]byte, threshold-1)
+	for j, s := range secret {
+		if _, err := io.ReadFull(rand, coeffs); err != nil {
+			return nil, fmt.Errorf("shamir: failed to read randomness: %w", err)
+		}
+		for i := range shares {
+			x := shares[i].Index
+			var y byte
+			for k := len(coeffs) - 1; k >= 0; k-- {
+				y = mul(y, x) ^ coeffs[k]
+			}
+			shares[i].Value[j] = mul(y, x) ^ s
+		}
+	}
+	clear(coeffs)
+
+	return shares, nil
+}
+
+// Combine recovers the secret from shares by Lagrange interpolation at zero.
+// The shares must have distinct non-zero indexes and values of equal length.
+// Combine can't tell whether enough shares were given: too few yield an
+// unrelated secret.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("shamir: no shares")
+	}
+	size := len(shares[0].Value)
+	seen := make(map[byte]bool, len(shares))
+	for _, s := range shares {
+		if s.Index == 0 {
+			return nil, errors.New("shamir: invalid share index 0")
+		}
+		if seen[s.Index] {
+			return nil, fmt.Errorf("shamir: duplicate share index %d", s.Index)
+		}
+		seen[s.Index] = true
+		if len(s.Value) != size {
+			return nil, errors.New("shamir: shares have different lengths")
+		}
+	}
+
+	secret := make([]byte, size)
+	for i, si := range shares {
+		// The Lagrange basis polynomial of share i at zero is the product of
+		// x_j / (x_j - x_i) over the other shares; subtraction is XOR.
+		basis := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				basis = mul(basis, mul(sj.Index, inv(sj.Index^si.Index)))
+			}
+		}
+		for k, v := range si.Value {
+			secret[k] ^= mul(basis, v)
+		}
+	}
+	return secret, nil
+}
+
+// mul multiplies in GF(256) modulo x^8 + x^4 + x^3 + x + 1, without
+// secret-dependent branches or table lookups.
+func mul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= a & -(b & 1)
+		a = a<<1 ^ 0x1b&-(a>>7)
+		b >>= 1
+	}
+	return p
+}
+
+// inv returns the multiplicative inverse of a non-zero element, a^254.
+func inv(a byte) byte {
+	r := a
+	for range 6 {
+		a = mul(a, a)
+		r = mul(r, a)
+	}
+	return mul(r, r)
+}
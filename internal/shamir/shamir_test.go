@@ -0,0 +1,75 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestField(t *testing.T) {
+	// FIPS 197, section 4.2
+	if got := mul(0x57, 0x83); got != 0xc1 {
+		t.Errorf("mul(0x57, 0x83) = %#x, expected 0xc1", got)
+	}
+	for a := 1; a < 256; a++ {
+		if got := mul(byte(a), inv(byte(a))); got != 1 {
+			t.Fatalf("%#x * inv(%#x) = %#x", a, a, got)
+		}
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("a secret worth sharing")
+	shares, err := Split(secret, 3, 5, rand.Reader)
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("expected 5 shares, got %d", len(shares))
+	}
+
+	// Every subset of at least three shares recovers the secret
+	for mask := 0; mask < 1<<5; mask++ {
+		var subset []Share
+		for i := range shares {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, shares[i])
+			}
+		}
+		if len(subset) < 3 {
+			continue
+		}
+		got, err := Combine(subset)
+		if err != nil {
+			t.Fatalf("Combine failed: %v", err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Errorf("shares %05b recovered %q", mask, got)
+		}
+	}
+
+	// Two shares don't
+	if got, _ := Combine(shares[:2]); bytes.Equal(got, secret) {
+		t.Error("two shares recovered the secret")
+	}
+}
+
+func TestSplitCombineErrors(t *testing.T) {
+	for _, c := range []struct{ k, n int }{{1, 3}, {4, 3}, {2, 256}} {
+		if _, err := Split([]byte{1}, c.k, c.n, rand.Reader); err == nil {
+			t.Errorf("Split with %d of %d shares succeeded", c.k, c.n)
+		}
+	}
+
+	shares, err := Split([]byte{1, 2, 3}, 2, 3, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Combine([]Share{shares[0], shares[0]}); err == nil {
+		t.Error("Combine accepted duplicate shares")
+	}
+	short := Share{Index: shares[1].Index, Value: shares[1].Value[:2]}
+	if _, err := Combine([]Share{shares[0], short}); err == nil {
+		t.Error("Combine accepted shares of different lengths")
+	}
+}
@@ -0,0 +1,159 @@
+package crypto
+
+import (
+	"crypto/fips140"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KEMID identifies a key encapsulation mechanism.
+type KEMID uint8
+
+const (
+	// Kyber768 is the pre-standard round-3 Kyber768.
+	Kyber768 KEMID = 1
+	// MLKEM768 is FIPS 203 ML-KEM-768.
+	MLKEM768 KEMID = 2
+	// MLKEM1024 is FIPS 203 ML-KEM-1024.
+	MLKEM1024 KEMID = 3
+)
+
+// String returns the name of the KEM.
+func (id KEMID) String() string {
+	switch id {
+	case Kyber768:
+		return "Kyber768"
+	case MLKEM768:
+		return "ML-KEM-768"
+	case MLKEM1024:
+		return "ML-KEM-1024"
+	default:
+		return fmt.Sprintf("KEM(%d)", id)
+	}
+}
+
+// DHID identifies an elliptic curve Diffie-Hellman function.
+type DHID uint8
+
+const (
+	// X25519 is the RFC 7748 X25519 function.
+	X25519 DHID = 1
+	// P384 is ECDH over the NIST P-384 curve, with uncompressed points.
+	P384 DHID = 2
+)
+
+// String returns the name of the DH function.
+func (id DHID) String() string {
+	switch id {
+	case X25519:
+		return "X25519"
+	case P384:
+		return "P-384"
+	default:
+		return fmt.Sprintf("DH(%d)", id)
+	}
+}
+
+// ErrUnsupported is returned by backends for primitives and key formats they
+// don't implement.
+var ErrUnsupported = errors.New("crypto: not supported by this backend")
+
+// ErrNotApproved is returned in FIPS 140-3 mode for primitives that are not
+// approved, or not provided by the Go Cryptographic Module.
+var ErrNotApproved = errors.New("crypto: not approved in FIPS 140-3 mode")
+
+// KEM is a key encapsulation mechanism whose key pairs are derived from a
+// seed, as specified by FIPS 203 for ML-KEM.
+type KEM interface {
+	// SeedSize, PublicKeySize, PrivateKeySize and CiphertextSize are the
+	// sizes of the key pair seed, the encapsulation key, the expanded
+	// decapsulation key and the ciphertext.
+	SeedSize() int
+	PublicKeySize() int
+	PrivateKeySize() int
+	CiphertextSize() int
+
+	// NewPrivateKey derives a decapsulation key from a SeedSize seed.
+	NewPrivateKey(seed []byte) (KEMPrivateKey, error)
+
+	// ParsePrivateKey parses an expanded decapsulation key.
+	ParsePrivateKey(b []byte) (KEMPrivateKey, error)
+
+	// CheckPublicKey returns an error if publicKey is not a valid
+	// encapsulation key, including the FIPS 203 modulus check.
+	CheckPublicKey(publicKey []byte) error
+
+	// Encapsulate generates a shared key for the encapsulation key
+	// publicKey, returning it with the ciphertext that carries it. If rand
+	// is not nil, the 32-byte ML-KEM message m is read from it, which makes
+	// the result deterministic.
+	Encapsulate(publicKey []byte, rand io.Reader) (ciphertext, sharedKey []byte, err error)
+}
+
+// KEMPrivateKey is a decapsulation key.
+type KEMPrivateKey interface {
+	// PublicKey returns the encoded encapsulation key.
+	PublicKey() []byte
+
+	// Bytes returns the expanded encoding of the decapsulation key, or an
+	// error wrapping ErrUnsupported if the backend only keeps seeds.
+	Bytes() ([]byte, error)
+
+	// Decapsulate recovers the shared key from a ciphertext.
+	Decapsulate(ciphertext []byte) ([]byte, error)
+}
+
+// DH is an elliptic curve Diffie-Hellman function over encoded keys.
+type DH interface {
+	// PrivateKeySize and PublicKeySize are the sizes of encoded scalars
+	// and points.
+	PrivateKeySize() int
+	PublicKeySize() int
+
+	// GenerateKey generates a random key pair. If rand is not nil, the
+	// private key is read from it, PrivateKeySize bytes at a time until
+	// they are a valid scalar.
+	GenerateKey(rand io.Reader) (privateKey, publicKey []byte, err error)
+
+	// CheckPublicKey returns an error if publicKey is not a valid encoded
+	// point.
+	CheckPublicKey(publicKey []byte) error
+
+	// PublicKey returns the public key of privateKey, or an error if it
+	// isn't a valid scalar.
+	PublicKey(privateKey []byte) ([]byte, error)
+
+	// ECDH returns the shared secret of privateKey and publicKey.
+	ECDH(privateKey, publicKey []byte) ([]byte, error)
+}
+
+// Backend provides the primitives qage is built on.
+type Backend interface {
+	// Name identifies the backend, as reported by qage version.
+	Name() string
+
+	// KEM and DH return the implementation of a primitive, or an error
+	// wrapping ErrUnsupported or ErrNotApproved.
+	KEM(id KEMID) (KEM, error)
+	DH(id DHID) (DH, error)
+
+	// HKDF derives length bytes with HKDF-SHA-256.
+	HKDF(secret, salt []byte, info string, length int) ([]byte, error)
+}
+
+// FIPSMode reports whether Go's FIPS 140-3 mode is enabled, with
+// GODEBUG=fips140=on or a binary built with GOFIPS140.
+func FIPSMode() bool {
+	return fips140.Enabled()
+}
+
+// DefaultBackend returns the backend used when none is configured: Stdlib in
+// FIPS 140-3 mode, and Circl otherwise, which also supports Kyber768 and
+// expanded ML-KEM keys.
+func DefaultBackend() Backend {
+	if FIPSMode() {
+		return Stdlib()
+	}
+	return Circl()
+}
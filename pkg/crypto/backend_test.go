@@ -0,0 +1,181 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/zlobste/qage/internal/hkdf"
+)
+
+func TestBackendsAgree(t *testing.T) {
+	circl, stdlib := Circl(), Stdlib()
+
+	for _, id := range []KEMID{MLKEM768, MLKEM1024} {
+		a, err := circl.KEM(id)
+		if err != nil {
+			t.Fatalf("circl %s: %v", id, err)
+		}
+		b, err := stdlib.KEM(id)
+		if err != nil {
+			t.Fatalf("stdlib %s: %v", id, err)
+		}
+		if a.SeedSize() != b.SeedSize() || a.PublicKeySize() != b.PublicKeySize() ||
+			a.PrivateKeySize() != b.PrivateKeySize() || a.CiphertextSize() != b.CiphertextSize() {
+			t.Errorf("%s: backends disagree on sizes", id)
+		}
+
+		// The same seed gives the same key pair
+		seed := bytes.Repeat([]byte{byte(id)}, a.SeedSize())
+		skA, err := a.NewPrivateKey(seed)
+		if err != nil {
+			t.Fatalf("circl %s: NewPrivateKey failed: %v", id, err)
+		}
+		skB, err := b.NewPrivateKey(seed)
+		if err != nil {
+			t.Fatalf("stdlib %s: NewPrivateKey failed: %v", id, err)
+		}
+		if !bytes.Equal(skA.PublicKey(), skB.PublicKey()) {
+			t.Fatalf("%s: backends derive different public keys", id)
+		}
+
+		// Each decapsulates what the other encapsulates
+		for _, pair := range []struct {
+			enc KEM
+			dec KEMPrivateKey
+		}{{a, skB}, {b, skA}} {
+			ct, ss, err := pair.enc.Encapsulate(skA.PublicKey(), nil)
+			if err != nil {
+				t.Fatalf("%s: Encapsulate failed: %v", id, err)
+			}
+			if len(ct) != a.CiphertextSize() {
+				t.Errorf("%s: ciphertext is %d bytes", id, len(ct))
+			}
+			got, err := pair.dec.Decapsulate(ct)
+			if err != nil {
+				t.Fatalf("%s: Decapsulate failed: %v", id, err)
+			}
+			if !bytes.Equal(got, ss) {
+				t.Errorf("%s: shared keys don't match", id)
+			}
+		}
+
+		// Only circl handles expanded keys
+		expanded, err := skA.Bytes()
+		if err != nil || len(expanded) != a.PrivateKeySize() {
+			t.Fatalf("circl %s: Bytes failed: %v", id, err)
+		}
+		if parsed, err := a.ParsePrivateKey(expanded); err != nil || !bytes.Equal(parsed.PublicKey(), skA.PublicKey()) {
+			t.Errorf("circl %s: ParsePrivateKey failed: %v", id, err)
+		}
+		if _, err := skB.Bytes(); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("stdlib %s: expected ErrUnsupported from Bytes, got %v", id, err)
+		}
+		if _, err := b.ParsePrivateKey(expanded); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("stdlib %s: expected ErrUnsupported from ParsePrivateKey, got %v", id, err)
+		}
+	}
+
+	if _, err := stdlib.KEM(Kyber768); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for stdlib Kyber768, got %v", err)
+	}
+
+	secret, salt := []byte("input keying material"), []byte("salt")
+	want := hkdf.Derive(salt, secret, []byte("info"), 42)
+	for _, b := range []Backend{circl, stdlib} {
+		got, err := b.HKDF(secret, salt, "info", 42)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: HKDF doesn't match internal/hkdf: %v", b.Name(), err)
+		}
+	}
+}
+
+func TestDH(t *testing.T) {
+	for _, id := range []DHID{X25519, P384} {
+		dh, err := Stdlib().DH(id)
+		if err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		privA, pubA, err := dh.GenerateKey(nil)
+		if err != nil {
+			t.Fatalf("%s: GenerateKey failed: %v", id, err)
+		}
+		privB, pubB, err := dh.GenerateKey(nil)
+		if err != nil {
+			t.Fatalf("%s: GenerateKey failed: %v", id, err)
+		}
+		if len(privA) != dh.PrivateKeySize() || len(pubA) != dh.PublicKeySize() {
+			t.Errorf("%s: unexpected key sizes %d and %d", id, len(privA), len(pubA))
+		}
+		if pub, err := dh.PublicKey(privA); err != nil || !bytes.Equal(pub, pubA) {
+			t.Errorf("%s: PublicKey doesn't match GenerateKey: %v", id, err)
+		}
+
+		ab, err := dh.ECDH(privA, pubB)
+		if err != nil {
+			t.Fatalf("%s: ECDH failed: %v", id, err)
+		}
+		ba, err := dh.ECDH(privB, pubA)
+		if err != nil {
+			t.Fatalf("%s: ECDH failed: %v", id, err)
+		}
+		if !bytes.Equal(ab, ba) {
+			t.Errorf("%s: shared secrets don't match", id)
+		}
+		if _, err := dh.ECDH(privA, pubA[:len(pubA)-1]); err == nil {
+			t.Errorf("%s: expected an error for a truncated public key", id)
+		}
+	}
+}
+
+func TestDeterministicRand(t *testing.T) {
+	kem, err := Circl().KEM(MLKEM768)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, err := kem.NewPrivateKey(bytes.Repeat([]byte{1}, kem.SeedSize()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := bytes.Repeat([]byte{2}, 32)
+	ct1, ss1, err := kem.Encapsulate(sk.PublicKey(), bytes.NewReader(m))
+	if err != nil {
+		t.Fatalf("Encapsulate failed: %v", err)
+	}
+	ct2, ss2, err := kem.Encapsulate(sk.PublicKey(), bytes.NewReader(m))
+	if err != nil {
+		t.Fatalf("Encapsulate failed: %v", err)
+	}
+	if !bytes.Equal(ct1, ct2) || !bytes.Equal(ss1, ss2) {
+		t.Error("encapsulations with the same randomness differ")
+	}
+	if _, _, err := kem.Encapsulate(sk.PublicKey(), bytes.NewReader(m[:31])); err == nil {
+		t.Error("expected an error for short randomness")
+	}
+
+	stdlibKEM, err := Stdlib().KEM(MLKEM768)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := stdlibKEM.Encapsulate(sk.PublicKey(), bytes.NewReader(m)); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("stdlib: expected ErrUnsupported, got %v", err)
+	}
+
+	for _, id := range []DHID{X25519, P384} {
+		dh, err := Stdlib().DH(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		random := bytes.Repeat([]byte{3}, dh.PrivateKeySize())
+		priv, pub, err := dh.GenerateKey(bytes.NewReader(random))
+		if err != nil {
+			t.Fatalf("%s: GenerateKey failed: %v", id, err)
+		}
+		if !bytes.Equal(priv, random) {
+			t.Errorf("%s: private key isn't read from rand", id)
+		}
+		if want, err := dh.PublicKey(priv); err != nil || !bytes.Equal(pub, want) {
+			t.Errorf("%s: PublicKey doesn't match GenerateKey: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package crypto
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cloudflare/circl/kem"
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem1024"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
+
+	"github.com/zlobste/qage/internal/hkdf"
+)
+
+// circlBackend implements the KEMs with circl, and ECDH with crypto/ecdh.
+type circlBackend struct{}
+
+// Circl returns the backend built on github.com/cloudflare/circl. It is the
+// only one supporting the legacy Kyber768 and expanded ML-KEM secret keys.
+// Its KEMs are not approved in FIPS 140-3 mode.
+func Circl() Backend {
+	return circlBackend{}
+}
+
+func (circlBackend) Name() string { return "circl" }
+
+func (circlBackend) KEM(id KEMID) (KEM, error) {
+	var scheme kem.Scheme
+	switch id {
+	case Kyber768:
+		scheme = kyber768.Scheme()
+	case MLKEM768:
+		scheme = mlkem768.Scheme()
+	case MLKEM1024:
+		scheme = mlkem1024.Scheme()
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, id)
+	}
+	if FIPSMode() {
+		return nil, fmt.Errorf("%w: circl %s", ErrNotApproved, id)
+	}
+	return circlKEM{scheme}, nil
+}
+
+func (circlBackend) DH(id DHID) (DH, error) {
+	return newECDH(id)
+}
+
+func (circlBackend) HKDF(secret, salt []byte, info string, length int) ([]byte, error) {
+	return hkdf.Derive(salt, secret, []byte(info), length), nil
+}
+
+// circlKEM adapts a circl KEM scheme to KEM.
+type circlKEM struct {
+	scheme kem.Scheme
+}
+
+func (k circlKEM) SeedSize() int       { return k.scheme.SeedSize() }
+func (k circlKEM) PublicKeySize() int  { return k.scheme.PublicKeySize() }
+func (k circlKEM) PrivateKeySize() int { return k.scheme.PrivateKeySize() }
+func (k circlKEM) CiphertextSize() int { return k.scheme.CiphertextSize() }
+
+func (k circlKEM) NewPrivateKey(seed []byte) (KEMPrivateKey, error) {
+	if len(seed) != k.scheme.SeedSize() {
+		return nil, fmt.Errorf("crypto: invalid %s seed length %d", k.scheme.Name(), len(seed))
+	}
+	pk, sk := k.scheme.DeriveKeyPair(seed)
+	return newCirclPrivateKey(k.scheme, pk, sk)
+}
+
+func (k circlKEM) ParsePrivateKey(b []byte) (KEMPrivateKey, error) {
+	sk, err := k.scheme.UnmarshalBinaryPrivateKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return newCirclPrivateKey(k.scheme, sk.Public(), sk)
+}
+
+func (k circlKEM) CheckPublicKey(publicKey []byte) error {
+	_, err := k.scheme.UnmarshalBinaryPublicKey(publicKey)
+	return err
+}
+
+func (k circlKEM) Encapsulate(publicKey []byte, random io.Reader) ([]byte, []byte, error) {
+	pk, err := k.scheme.UnmarshalBinaryPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if random == nil {
+		return k.scheme.Encapsulate(pk)
+	}
+	m := make([]byte, k.scheme.EncapsulationSeedSize())
+	if _, err := io.ReadFull(random, m); err != nil {
+		return nil, nil, err
+	}
+	return k.scheme.EncapsulateDeterministically(pk, m)
+}
+
+// circlPrivateKey is a circl decapsulation key with its encoded public key.
+type circlPrivateKey struct {
+	scheme kem.Scheme
+	sk     kem.PrivateKey
+	pub    []byte
+}
+
+func newCirclPrivateKey(scheme kem.Scheme, pk kem.PublicKey, sk kem.PrivateKey) (*circlPrivateKey, error) {
+	pub, err := pk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &circlPrivateKey{scheme: scheme, sk: sk, pub: pub}, nil
+}
+
+func (k *circlPrivateKey) PublicKey() []byte {
+	return k.pub
+}
+
+func (k *circlPrivateKey) Bytes() ([]byte, error) {
+	return k.sk.MarshalBinary()
+}
+
+func (k *circlPrivateKey) Decapsulate(ciphertext []byte) ([]byte, error) {
+	return k.scheme.Decapsulate(k.sk, ciphertext)
+}
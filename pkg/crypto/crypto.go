@@ -2,37 +2,63 @@
 package crypto
 
 import (
-	"crypto/ecdh"
-	"crypto/rand"
+	"io"
 
-	kyber768 "github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem1024"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
 )
 
-// GenerateX25519 generates a new X25519 keypair.
-func GenerateX25519() (privateKey [32]byte, publicKey [32]byte, err error) {
-	curve := ecdh.X25519()
-	priv, err := curve.GenerateKey(rand.Reader)
+// GenerateX25519 generates a new X25519 keypair from rand, or from
+// crypto/rand.Reader if rand is nil.
+func GenerateX25519(rand io.Reader) (privateKey [32]byte, publicKey [32]byte, err error) {
+	priv, pub, err := dhX25519.GenerateKey(rand)
 	if err != nil {
 		return privateKey, publicKey, err
 	}
 
-	pub := priv.PublicKey().Bytes()
-	copy(privateKey[:], priv.Bytes())
+	copy(privateKey[:], priv)
 	copy(publicKey[:], pub)
 
 	return privateKey, publicKey, nil
 }
 
-// GenerateMLKEM768 generates a new ML-KEM-768 keypair.
-func GenerateMLKEM768() (publicKey []byte, privateKey []byte, err error) {
-	pk, sk, err := kyber768.GenerateKeyPair(rand.Reader)
+// GenerateP384 generates a new P-384 keypair from rand, or from
+// crypto/rand.Reader if rand is nil. The public key is returned in
+// uncompressed form.
+func GenerateP384(rand io.Reader) (privateKey []byte, publicKey []byte, err error) {
+	return dhP384.GenerateKey(rand)
+}
+
+// GenerateMLKEM768 generates a new FIPS 203 ML-KEM-768 keypair from rand, or
+// from crypto/rand.Reader if rand is nil. The private key is returned in its
+// expanded encoding.
+func GenerateMLKEM768(rand io.Reader) (publicKey []byte, privateKey []byte, err error) {
+	pk, sk, err := mlkem768.GenerateKeyPair(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Pack keys into byte slices
+	pkBytes := make([]byte, mlkem768.PublicKeySize)
+	skBytes := make([]byte, mlkem768.PrivateKeySize)
+	pk.Pack(pkBytes)
+	sk.Pack(skBytes)
+
+	return pkBytes, skBytes, nil
+}
+
+// GenerateMLKEM1024 generates a new FIPS 203 ML-KEM-1024 keypair from rand, or
+// from crypto/rand.Reader if rand is nil. The private key is returned in its
+// expanded encoding.
+func GenerateMLKEM1024(rand io.Reader) (publicKey []byte, privateKey []byte, err error) {
+	pk, sk, err := mlkem1024.GenerateKeyPair(rand)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// Pack keys into byte slices
-	pkBytes := make([]byte, kyber768.PublicKeySize)
-	skBytes := make([]byte, kyber768.PrivateKeySize)
+	pkBytes := make([]byte, mlkem1024.PublicKeySize)
+	skBytes := make([]byte, mlkem1024.PrivateKeySize)
 	pk.Pack(pkBytes)
 	sk.Pack(skBytes)
 
@@ -2,16 +2,17 @@ package crypto
 
 import (
 	"bytes"
+	"io"
 	"testing"
 )
 
 func TestGenerateX25519(t *testing.T) {
-	priv1, pub1, err := GenerateX25519()
+	priv1, pub1, err := GenerateX25519(nil)
 	if err != nil {
 		t.Fatalf("GenerateX25519 failed: %v", err)
 	}
 
-	priv2, pub2, err := GenerateX25519()
+	priv2, pub2, err := GenerateX25519(nil)
 	if err != nil {
 		t.Fatalf("GenerateX25519 failed on second call: %v", err)
 	}
@@ -36,12 +37,12 @@ func TestGenerateX25519(t *testing.T) {
 }
 
 func TestGenerateMLKEM768(t *testing.T) {
-	pub1, priv1, err := GenerateMLKEM768()
+	pub1, priv1, err := GenerateMLKEM768(nil)
 	if err != nil {
 		t.Fatalf("GenerateMLKEM768 failed: %v", err)
 	}
 
-	pub2, priv2, err := GenerateMLKEM768()
+	pub2, priv2, err := GenerateMLKEM768(nil)
 	if err != nil {
 		t.Fatalf("GenerateMLKEM768 failed on second call: %v", err)
 	}
@@ -67,3 +68,62 @@ func TestGenerateMLKEM768(t *testing.T) {
 		t.Errorf("expected private key length %d, got %d", expectedPrivLen, len(priv1))
 	}
 }
+
+func TestGenerateP384(t *testing.T) {
+	priv, pub, err := GenerateP384(nil)
+	if err != nil {
+		t.Fatalf("GenerateP384 failed: %v", err)
+	}
+
+	if len(priv) != 48 {
+		t.Errorf("expected private key length 48, got %d", len(priv))
+	}
+
+	if len(pub) != 97 {
+		t.Errorf("expected public key length 97, got %d", len(pub))
+	}
+}
+
+func TestGenerateMLKEM1024(t *testing.T) {
+	pub, priv, err := GenerateMLKEM1024(nil)
+	if err != nil {
+		t.Fatalf("GenerateMLKEM1024 failed: %v", err)
+	}
+
+	// Check expected lengths
+	expectedPubLen := 1568  // ML-KEM-1024 public key size
+	expectedPrivLen := 3168 // ML-KEM-1024 private key size
+
+	if len(pub) != expectedPubLen {
+		t.Errorf("expected public key length %d, got %d", expectedPubLen, len(pub))
+	}
+
+	if len(priv) != expectedPrivLen {
+		t.Errorf("expected private key length %d, got %d", expectedPrivLen, len(priv))
+	}
+}
+
+func TestGenerateWithReader(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x42}, 256)
+	for name, generate := range map[string]func(io.Reader) ([]byte, []byte, error){
+		"X25519": func(r io.Reader) ([]byte, []byte, error) {
+			priv, pub, err := GenerateX25519(r)
+			return priv[:], pub[:], err
+		},
+		"P-384":       GenerateP384,
+		"ML-KEM-768":  GenerateMLKEM768,
+		"ML-KEM-1024": GenerateMLKEM1024,
+	} {
+		a1, b1, err := generate(bytes.NewReader(seed))
+		if err != nil {
+			t.Fatalf("%s: generate failed: %v", name, err)
+		}
+		a2, b2, err := generate(bytes.NewReader(seed))
+		if err != nil {
+			t.Fatalf("%s: generate failed: %v", name, err)
+		}
+		if !bytes.Equal(a1, a2) || !bytes.Equal(b1, b2) {
+			t.Errorf("%s: keys from the same reader differ", name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// ecdhDH implements DH with crypto/ecdh, which is part of the Go
+// Cryptographic Module. Both backends use it: circl has no P-384 ECDH.
+type ecdhDH struct {
+	curve      ecdh.Curve
+	scalarSize int
+	pointSize  int
+}
+
+var (
+	dhX25519 = &ecdhDH{curve: ecdh.X25519(), scalarSize: 32, pointSize: 32}
+	dhP384   = &ecdhDH{curve: ecdh.P384(), scalarSize: 48, pointSize: 97}
+)
+
+// newECDH returns the crypto/ecdh implementation of a DH function. X25519 is
+// not approved in FIPS 140-3 mode.
+func newECDH(id DHID) (DH, error) {
+	switch id {
+	case X25519:
+		if FIPSMode() {
+			return nil, fmt.Errorf("%w: %s", ErrNotApproved, id)
+		}
+		return dhX25519, nil
+	case P384:
+		return dhP384, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, id)
+	}
+}
+
+func (d *ecdhDH) PrivateKeySize() int { return d.scalarSize }
+func (d *ecdhDH) PublicKeySize() int  { return d.pointSize }
+
+func (d *ecdhDH) GenerateKey(random io.Reader) ([]byte, []byte, error) {
+	if random == nil {
+		priv, err := d.curve.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return priv.Bytes(), priv.PublicKey().Bytes(), nil
+	}
+
+	// crypto/ecdh doesn't specify how GenerateKey uses its reader, so
+	// sample the scalar explicitly for a reproducible result.
+	scalar := make([]byte, d.scalarSize)
+	for {
+		if _, err := io.ReadFull(random, scalar); err != nil {
+			return nil, nil, err
+		}
+		if priv, err := d.curve.NewPrivateKey(scalar); err == nil {
+			return scalar, priv.PublicKey().Bytes(), nil
+		}
+	}
+}
+
+func (d *ecdhDH) CheckPublicKey(publicKey []byte) error {
+	_, err := d.curve.NewPublicKey(publicKey)
+	return err
+}
+
+func (d *ecdhDH) PublicKey(privateKey []byte) ([]byte, error) {
+	priv, err := d.curve.NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return priv.PublicKey().Bytes(), nil
+}
+
+func (d *ecdhDH) ECDH(privateKey, publicKey []byte) ([]byte, error) {
+	priv, err := d.curve.NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := d.curve.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return priv.ECDH(pub)
+}
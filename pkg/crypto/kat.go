@@ -0,0 +1,374 @@
+package crypto
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// mlkemACVP holds ML-KEM vectors selected from the NIST ACVP-Server sample
+// vector sets. See its description field.
+//
+//go:embed testdata/acvp/ml-kem.json
+var mlkemACVP []byte
+
+// mlkemSeedVectors holds ML-KEM decapsulation vectors for keys in seed form,
+// derived from the ACVP keyGen vectors, which backends without expanded
+// decapsulation keys can run. See its description field.
+//
+//go:embed testdata/ml-kem-seed.json
+var mlkemSeedVectors []byte
+
+// KATResult is the result of a known-answer test.
+type KATResult struct {
+	// Name identifies the test and its vector, such as
+	// "ML-KEM-768 keyGen (ACVP tcId 26)".
+	Name string
+
+	// Skipped reports whether the backend doesn't provide the primitive or
+	// operation under test, in which case Err is the reason.
+	Skipped bool
+	Err     error
+}
+
+// KnownAnswerTests checks the primitives of b against published vectors: the
+// NIST ACVP vectors for ML-KEM-768 and ML-KEM-1024, with decapsulation
+// vectors for the keys of their keyGen vectors, RFC 7748 for X25519 and RFC
+// 5869 for HKDF-SHA-256. Tests of what b doesn't provide are skipped, such as
+// X25519 in FIPS 140-3 mode, or deterministic encapsulation and expanded keys
+// with the stdlib backend; in FIPS 140-3 mode the Go Cryptographic Module
+// runs its own self-tests of those.
+func KnownAnswerTests(b Backend) []KATResult {
+	var results []KATResult
+	add := func(name string, err error) {
+		skipped := errors.Is(err, ErrUnsupported) || errors.Is(err, ErrNotApproved)
+		results = append(results, KATResult{Name: name, Skipped: skipped, Err: err})
+	}
+
+	var acvp mlkemVectors
+	if err := json.Unmarshal(mlkemACVP, &acvp); err != nil {
+		add("ML-KEM ACVP vectors", err)
+	}
+	for _, v := range acvp.KeyGen {
+		add(fmt.Sprintf("%s keyGen (ACVP tcId %d)", v.ParameterSet, v.TcID), v.check(b))
+	}
+	for _, v := range acvp.Encapsulation {
+		add(fmt.Sprintf("%s encapsulation (ACVP tcId %d)", v.ParameterSet, v.TcID), v.check(b))
+	}
+	for _, v := range acvp.Decapsulation {
+		add(fmt.Sprintf("%s decapsulation, %s (ACVP tcId %d)", v.ParameterSet, v.Comment, v.TcID), v.check(b))
+	}
+	var seed mlkemSeedDecapVectors
+	if err := json.Unmarshal(mlkemSeedVectors, &seed); err != nil {
+		add("ML-KEM seed decapsulation vectors", err)
+	}
+	for _, v := range seed.Decapsulation {
+		add(fmt.Sprintf("%s decapsulation from seed, %s (ACVP keyGen tcId %d)", v.ParameterSet, v.Comment, v.KeyGenTcID), v.check(b))
+	}
+
+	for i, v := range x25519Vectors {
+		add(fmt.Sprintf("X25519 (RFC 7748 section 5.2, vector %d)", i+1), v.check(b))
+	}
+	add("X25519 key agreement (RFC 7748 section 6.1)", checkX25519Agreement(b))
+
+	for i, v := range hkdfVectors {
+		add(fmt.Sprintf("HKDF-SHA-256 (RFC 5869 test case %d)", i+1), v.check(b))
+	}
+	return results
+}
+
+// powerOnSelfTests holds the result of the known-answer tests of each backend,
+// by name, as a func() error.
+var powerOnSelfTests sync.Map
+
+// PowerOnSelfTest runs the known-answer tests of b the first time it is
+// called for a backend, and returns an error if any failed. Later calls
+// return the same result.
+func PowerOnSelfTest(b Backend) error {
+	test, _ := powerOnSelfTests.LoadOrStore(b.Name(), sync.OnceValue(func() error {
+		for _, r := range KnownAnswerTests(b) {
+			if r.Err != nil && !r.Skipped {
+				return fmt.Errorf("crypto: %s power-on self-test failed: %s: %w", b.Name(), r.Name, r.Err)
+			}
+		}
+		return nil
+	}))
+	return test.(func() error)()
+}
+
+// errMismatch is returned by known-answer tests whose output doesn't match.
+var errMismatch = errors.New("output doesn't match the expected value")
+
+// hexBytes is a byte string encoded in hex in JSON.
+type hexBytes []byte
+
+func (h *hexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	*h = b
+	return err
+}
+
+// mlkemVectors is the content of testdata/acvp/ml-kem.json.
+type mlkemVectors struct {
+	KeyGen        []mlkemKeyGenVector `json:"keyGen"`
+	Encapsulation []mlkemEncapVector  `json:"encapsulation"`
+	Decapsulation []mlkemDecapVector  `json:"decapsulation"`
+}
+
+type mlkemKeyGenVector struct {
+	TcID         int      `json:"tcId"`
+	ParameterSet string   `json:"parameterSet"`
+	D            hexBytes `json:"d"`
+	Z            hexBytes `json:"z"`
+	EK           hexBytes `json:"ek"`
+	DK           hexBytes `json:"dk"`
+}
+
+type mlkemEncapVector struct {
+	TcID         int      `json:"tcId"`
+	ParameterSet string   `json:"parameterSet"`
+	EK           hexBytes `json:"ek"`
+	M            hexBytes `json:"m"`
+	C            hexBytes `json:"c"`
+	K            hexBytes `json:"k"`
+}
+
+type mlkemDecapVector struct {
+	TcID         int      `json:"tcId"`
+	ParameterSet string   `json:"parameterSet"`
+	Comment      string   `json:"comment"`
+	DK           hexBytes `json:"dk"`
+	C            hexBytes `json:"c"`
+	K            hexBytes `json:"k"`
+}
+
+// mlkemSeedDecapVectors is the content of testdata/ml-kem-seed.json.
+type mlkemSeedDecapVectors struct {
+	Decapsulation []mlkemSeedDecapVector `json:"decapsulation"`
+}
+
+type mlkemSeedDecapVector struct {
+	KeyGenTcID   int      `json:"keyGenTcId"`
+	ParameterSet string   `json:"parameterSet"`
+	Comment      string   `json:"comment"`
+	D            hexBytes `json:"d"`
+	Z            hexBytes `json:"z"`
+	C            hexBytes `json:"c"`
+	K            hexBytes `json:"k"`
+}
+
+// acvpKEM returns the KEM of b for an ACVP parameter set.
+func acvpKEM(b Backend, parameterSet string) (KEM, error) {
+	for _, id := range []KEMID{MLKEM768, MLKEM1024} {
+		if id.String() == parameterSet {
+			return b.KEM(id)
+		}
+	}
+	return nil, fmt.Errorf("unknown parameter set %q", parameterSet)
+}
+
+// check derives the key pair from the seed d || z. The expanded
+// decapsulation key is only compared if b can encode it.
+func (v *mlkemKeyGenVector) check(b Backend) error {
+	k, err := acvpKEM(b, v.ParameterSet)
+	if err != nil {
+		return err
+	}
+	sk, err := k.NewPrivateKey(append(bytes.Clone(v.D), v.Z...))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sk.PublicKey(), v.EK) {
+		return fmt.Errorf("ek: %w", errMismatch)
+	}
+	dk, err := sk.Bytes()
+	if errors.Is(err, ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(dk, v.DK) {
+		return fmt.Errorf("dk: %w", errMismatch)
+	}
+	return nil
+}
+
+func (v *mlkemEncapVector) check(b Backend) error {
+	k, err := acvpKEM(b, v.ParameterSet)
+	if err != nil {
+		return err
+	}
+	c, key, err := k.Encapsulate(v.EK, bytes.NewReader(v.M))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(c, v.C) {
+		return fmt.Errorf("c: %w", errMismatch)
+	}
+	if !bytes.Equal(key, v.K) {
+		return fmt.Errorf("k: %w", errMismatch)
+	}
+	return nil
+}
+
+func (v *mlkemDecapVector) check(b Backend) error {
+	k, err := acvpKEM(b, v.ParameterSet)
+	if err != nil {
+		return err
+	}
+	sk, err := k.ParsePrivateKey(v.DK)
+	if err != nil {
+		return err
+	}
+	key, err := sk.Decapsulate(v.C)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(key, v.K) {
+		return fmt.Errorf("k: %w", errMismatch)
+	}
+	return nil
+}
+
+// check derives the key pair from the seed d || z, and decapsulates c.
+func (v *mlkemSeedDecapVector) check(b Backend) error {
+	k, err := acvpKEM(b, v.ParameterSet)
+	if err != nil {
+		return err
+	}
+	sk, err := k.NewPrivateKey(append(bytes.Clone(v.D), v.Z...))
+	if err != nil {
+		return err
+	}
+	key, err := sk.Decapsulate(v.C)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(key, v.K) {
+		return fmt.Errorf("k: %w", errMismatch)
+	}
+	return nil
+}
+
+// x25519Vector is an X25519 function test vector.
+type x25519Vector struct {
+	scalar, u, output string
+}
+
+// x25519Vectors are the test vectors of RFC 7748, section 5.2. The second u
+// has its most significant bit set, which X25519 must ignore.
+var x25519Vectors = []x25519Vector{
+	{
+		scalar: "a546e36bf0527c9d3b16154b82465edd62144c0ac1fc5a18506a2244ba449ac4",
+		u:      "e6db6867583030db3594c1a424b15f7c726624ec26b3353b10a903a6d0ab1c4c",
+		output: "c3da55379de9c6908e94ea4df28d084f32eccf03491c71f754b4075577a28552",
+	},
+	{
+		scalar: "4b66e9d4d1b4673c5ad22691957d6af5c11b6421e0ea01d42ca4169e7918ba0d",
+		u:      "e5210f12786811d3f4b7959d0538ae2c31dbe7106fc03c3efc4cd549c715a493",
+		output: "95cbde9476e8907d7aade45cb4b873f88b595a68799fa152e6f8f7647aac7957",
+	},
+}
+
+func (v *x25519Vector) check(b Backend) error {
+	dh, err := b.DH(X25519)
+	if err != nil {
+		return err
+	}
+	out, err := dh.ECDH(mustHex(v.scalar), mustHex(v.u))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(out, mustHex(v.output)) {
+		return errMismatch
+	}
+	return nil
+}
+
+// checkX25519Agreement checks the Diffie-Hellman example of RFC 7748,
+// section 6.1.
+func checkX25519Agreement(b Backend) error {
+	dh, err := b.DH(X25519)
+	if err != nil {
+		return err
+	}
+	alice := mustHex("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	alicePub := mustHex("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+	bob := mustHex("5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb")
+	bobPub := mustHex("de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f")
+	shared := mustHex("4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742")
+
+	for _, pair := range [][2][]byte{{alice, alicePub}, {bob, bobPub}} {
+		pub, err := dh.PublicKey(pair[0])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(pub, pair[1]) {
+			return fmt.Errorf("public key: %w", errMismatch)
+		}
+	}
+	for _, pair := range [][2][]byte{{alice, bobPub}, {bob, alicePub}} {
+		out, err := dh.ECDH(pair[0], pair[1])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(out, shared) {
+			return fmt.Errorf("shared secret: %w", errMismatch)
+		}
+	}
+	return nil
+}
+
+// hkdfVector is an HKDF-SHA-256 test vector.
+type hkdfVector struct {
+	ikm, salt, info, okm string
+}
+
+// hkdfVectors are the HKDF-SHA-256 test cases of RFC 5869, appendix A.
+var hkdfVectors = []hkdfVector{
+	{
+		ikm:  "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+		salt: "000102030405060708090a0b0c",
+		info: "f0f1f2f3f4f5f6f7f8f9",
+		okm:  "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+	},
+	{
+		ikm:  "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f404142434445464748494a4b4c4d4e4f",
+		salt: "606162636465666768696a6b6c6d6e6f707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9fa0a1a2a3a4a5a6a7a8a9aaabacadaeaf",
+		info: "b0b1b2b3b4b5b6b7b8b9babbbcbdbebfc0c1c2c3c4c5c6c7c8c9cacbcccdcecfd0d1d2d3d4d5d6d7d8d9dadbdcdddedfe0e1e2e3e4e5e6e7e8e9eaebecedeeeff0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		okm:  "b11e398dc80327a1c8e7f78c596a49344f012eda2d4efad8a050cc4c19afa97c59045a99cac7827271cb41c65e590e09da3275600c2f09b8367793a9aca3db71cc30c58179ec3e87c14c01d5c1f3434f1d87",
+	},
+	{
+		ikm: "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+		okm: "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+	},
+}
+
+func (v *hkdfVector) check(b Backend) error {
+	want := mustHex(v.okm)
+	out, err := b.HKDF(mustHex(v.ikm), mustHex(v.salt), string(mustHex(v.info)), len(want))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(out, want) {
+		return errMismatch
+	}
+	return nil
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,170 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateKAT = flag.Bool("update-kat", false, "regenerate testdata/ml-kem-seed.json")
+
+// mlkemSeedDescription is the description of testdata/ml-kem-seed.json.
+const mlkemSeedDescription = `Decapsulation tests for ML-KEM-768 and ML-KEM-1024 keys in seed form, for backends without expanded decapsulation keys, which can't run the ACVP decapsulation vectors. The key is derived from (d, z) of the keyGen vector keyGenTcId of acvp/ml-kem.json. The valid ciphertext encapsulates the m of the first ACVP encapsulation vector of the same parameter set to its ek, and the rejected one is the valid ciphertext with the last bit flipped, so that k is J(z || c). c and k were computed with circl, which passes the ACVP vectors, and match Go's crypto/mlkem. Binary fields are hex.`
+
+func TestKnownAnswerTests(t *testing.T) {
+	for _, b := range []Backend{Circl(), Stdlib()} {
+		results := KnownAnswerTests(b)
+		if len(results) == 0 {
+			t.Fatalf("%s: no known-answer tests", b.Name())
+		}
+		skipped, seedDecaps := 0, 0
+		names := make(map[string]bool)
+		for _, r := range results {
+			if names[r.Name] {
+				t.Errorf("%s: duplicate test %q", b.Name(), r.Name)
+			}
+			names[r.Name] = true
+			if strings.Contains(r.Name, "decapsulation from seed") && !r.Skipped {
+				seedDecaps++
+			}
+			if r.Skipped {
+				skipped++
+			} else if r.Err != nil {
+				t.Errorf("%s: %s: %v", b.Name(), r.Name, r.Err)
+			}
+		}
+		// Only the stdlib backend lacks deterministic encapsulation and
+		// expanded keys, but both decapsulate seed-form keys
+		if seedDecaps == 0 {
+			t.Errorf("%s: ran no seed decapsulation tests", b.Name())
+		}
+		if b.Name() == "circl" && skipped != 0 {
+			t.Errorf("circl: skipped %d tests", skipped)
+		}
+		if b.Name() == "stdlib" && (skipped == 0 || skipped == len(results)) {
+			t.Errorf("stdlib: skipped %d of %d tests", skipped, len(results))
+		}
+		if err := PowerOnSelfTest(b); err != nil {
+			t.Errorf("%s: PowerOnSelfTest failed: %v", b.Name(), err)
+		}
+	}
+}
+
+// brokenBackend is a backend whose HKDF output is wrong.
+type brokenBackend struct {
+	Backend
+}
+
+func (brokenBackend) Name() string { return "broken" }
+
+func (b brokenBackend) HKDF(secret, salt []byte, info string, length int) ([]byte, error) {
+	out, err := b.Backend.HKDF(secret, salt, info, length)
+	out[len(out)-1] ^= 1
+	return out, err
+}
+
+func TestKnownAnswerTestsFailure(t *testing.T) {
+	b := brokenBackend{Circl()}
+	failed := 0
+	for _, r := range KnownAnswerTests(b) {
+		if r.Err == nil {
+			continue
+		}
+		failed++
+		if r.Skipped || !strings.HasPrefix(r.Name, "HKDF-SHA-256") || !errors.Is(r.Err, errMismatch) {
+			t.Errorf("unexpected failure of %s: %v", r.Name, r.Err)
+		}
+	}
+	if failed != len(hkdfVectors) {
+		t.Errorf("%d tests failed, expected %d", failed, len(hkdfVectors))
+	}
+
+	err := PowerOnSelfTest(b)
+	if err == nil || !strings.Contains(err.Error(), "HKDF-SHA-256 (RFC 5869 test case 1)") {
+		t.Errorf("expected PowerOnSelfTest to fail, got %v", err)
+	}
+	if again := PowerOnSelfTest(b); again != err {
+		t.Errorf("PowerOnSelfTest ran again: %v", again)
+	}
+}
+
+// TestMLKEMSeedVectors regenerates testdata/ml-kem-seed.json with
+// -update-kat. KnownAnswerTests checks it.
+func TestMLKEMSeedVectors(t *testing.T) {
+	if !*updateKAT {
+		t.Skip("use -update-kat to regenerate")
+	}
+	var acvp mlkemVectors
+	if err := json.Unmarshal(mlkemACVP, &acvp); err != nil {
+		t.Fatal(err)
+	}
+	type vector struct {
+		KeyGenTcID   int    `json:"keyGenTcId"`
+		ParameterSet string `json:"parameterSet"`
+		Comment      string `json:"comment"`
+		D            string `json:"d"`
+		Z            string `json:"z"`
+		C            string `json:"c"`
+		K            string `json:"k"`
+	}
+	out := struct {
+		Description   string   `json:"description"`
+		Decapsulation []vector `json:"decapsulation"`
+	}{Description: mlkemSeedDescription, Decapsulation: []vector{}}
+
+	for _, kg := range acvp.KeyGen {
+		var m []byte
+		for _, e := range acvp.Encapsulation {
+			if e.ParameterSet == kg.ParameterSet {
+				m = e.M
+				break
+			}
+		}
+		k, err := acvpKEM(Circl(), kg.ParameterSet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sk, err := k.NewPrivateKey(append(bytes.Clone(kg.D), kg.Z...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, key, err := k.Encapsulate(sk.PublicKey(), bytes.NewReader(m))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rejected := bytes.Clone(c)
+		rejected[len(rejected)-1] ^= 0x80
+		rejectedKey, err := sk.Decapsulate(rejected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []struct {
+			comment string
+			c, k    []byte
+		}{{"valid ciphertext", c, key}, {"rejected ciphertext", rejected, rejectedKey}} {
+			out.Decapsulation = append(out.Decapsulation, vector{
+				KeyGenTcID:   kg.TcID,
+				ParameterSet: kg.ParameterSet,
+				Comment:      v.comment,
+				D:            hex.EncodeToString(kg.D),
+				Z:            hex.EncodeToString(kg.Z),
+				C:            hex.EncodeToString(v.c),
+				K:            hex.EncodeToString(v.k),
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("testdata", "ml-kem-seed.json"), append(data, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,154 @@
+package crypto
+
+import (
+	"crypto/hkdf"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+// stdlibBackend implements every primitive with the Go standard library,
+// whose crypto/mlkem, crypto/ecdh and crypto/hkdf are part of the Go
+// Cryptographic Module.
+type stdlibBackend struct{}
+
+// Stdlib returns the backend built on crypto/mlkem, crypto/ecdh and
+// crypto/hkdf, the only one usable in FIPS 140-3 mode. It doesn't support
+// Kyber768, only handles ML-KEM secret keys in their seed form, and can't
+// encapsulate with caller-provided randomness.
+func Stdlib() Backend {
+	return stdlibBackend{}
+}
+
+func (stdlibBackend) Name() string { return "stdlib" }
+
+func (stdlibBackend) KEM(id KEMID) (KEM, error) {
+	switch id {
+	case MLKEM768:
+		return stdlibMLKEM768, nil
+	case MLKEM1024:
+		return stdlibMLKEM1024, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, id)
+	}
+}
+
+func (stdlibBackend) DH(id DHID) (DH, error) {
+	return newECDH(id)
+}
+
+func (stdlibBackend) HKDF(secret, salt []byte, info string, length int) ([]byte, error) {
+	return hkdf.Key(sha256.New, secret, salt, info, length)
+}
+
+// stdlibKEM adapts one of the crypto/mlkem parameter sets to KEM.
+type stdlibKEM struct {
+	id             KEMID
+	publicKeySize  int
+	privateKeySize int
+	ciphertextSize int
+	newPrivateKey  func(seed []byte) (KEMPrivateKey, error)
+	checkPublicKey func(publicKey []byte) error
+	encapsulate    func(publicKey []byte) (ciphertext, sharedKey []byte, err error)
+}
+
+var (
+	stdlibMLKEM768 = &stdlibKEM{
+		id:             MLKEM768,
+		publicKeySize:  mlkem.EncapsulationKeySize768,
+		privateKeySize: 2400,
+		ciphertextSize: mlkem.CiphertextSize768,
+		newPrivateKey: func(seed []byte) (KEMPrivateKey, error) {
+			dk, err := mlkem.NewDecapsulationKey768(seed)
+			if err != nil {
+				return nil, err
+			}
+			return &stdlibPrivateKey{pub: dk.EncapsulationKey().Bytes(), decapsulate: dk.Decapsulate}, nil
+		},
+		checkPublicKey: func(publicKey []byte) error {
+			_, err := mlkem.NewEncapsulationKey768(publicKey)
+			return err
+		},
+		encapsulate: func(publicKey []byte) ([]byte, []byte, error) {
+			ek, err := mlkem.NewEncapsulationKey768(publicKey)
+			if err != nil {
+				return nil, nil, err
+			}
+			sharedKey, ciphertext := ek.Encapsulate()
+			return ciphertext, sharedKey, nil
+		},
+	}
+	stdlibMLKEM1024 = &stdlibKEM{
+		id:             MLKEM1024,
+		publicKeySize:  mlkem.EncapsulationKeySize1024,
+		privateKeySize: 3168,
+		ciphertextSize: mlkem.CiphertextSize1024,
+		newPrivateKey: func(seed []byte) (KEMPrivateKey, error) {
+			dk, err := mlkem.NewDecapsulationKey1024(seed)
+			if err != nil {
+				return nil, err
+			}
+			return &stdlibPrivateKey{pub: dk.EncapsulationKey().Bytes(), decapsulate: dk.Decapsulate}, nil
+		},
+		checkPublicKey: func(publicKey []byte) error {
+			_, err := mlkem.NewEncapsulationKey1024(publicKey)
+			return err
+		},
+		encapsulate: func(publicKey []byte) ([]byte, []byte, error) {
+			ek, err := mlkem.NewEncapsulationKey1024(publicKey)
+			if err != nil {
+				return nil, nil, err
+			}
+			sharedKey, ciphertext := ek.Encapsulate()
+			return ciphertext, sharedKey, nil
+		},
+	}
+)
+
+func (k *stdlibKEM) SeedSize() int       { return mlkem.SeedSize }
+func (k *stdlibKEM) PublicKeySize() int  { return k.publicKeySize }
+func (k *stdlibKEM) PrivateKeySize() int { return k.privateKeySize }
+func (k *stdlibKEM) CiphertextSize() int { return k.ciphertextSize }
+
+func (k *stdlibKEM) NewPrivateKey(seed []byte) (KEMPrivateKey, error) {
+	return k.newPrivateKey(seed)
+}
+
+func (k *stdlibKEM) CheckPublicKey(publicKey []byte) error {
+	return k.checkPublicKey(publicKey)
+}
+
+// Encapsulate fails if rand is set: crypto/mlkem always uses its own
+// randomness.
+func (k *stdlibKEM) Encapsulate(publicKey []byte, random io.Reader) ([]byte, []byte, error) {
+	if random != nil && random != rand.Reader {
+		return nil, nil, fmt.Errorf("%w: deterministic %s encapsulation", ErrUnsupported, k.id)
+	}
+	return k.encapsulate(publicKey)
+}
+
+// ParsePrivateKey always fails: crypto/mlkem only accepts seeds.
+func (k *stdlibKEM) ParsePrivateKey(b []byte) (KEMPrivateKey, error) {
+	return nil, fmt.Errorf("%w: expanded %s secret keys", ErrUnsupported, k.id)
+}
+
+// stdlibPrivateKey is a crypto/mlkem decapsulation key.
+type stdlibPrivateKey struct {
+	pub         []byte
+	decapsulate func(ciphertext []byte) ([]byte, error)
+}
+
+func (k *stdlibPrivateKey) PublicKey() []byte {
+	return k.pub
+}
+
+// Bytes always fails: crypto/mlkem doesn't expose the expanded encoding.
+func (k *stdlibPrivateKey) Bytes() ([]byte, error) {
+	return nil, fmt.Errorf("%w: expanded ML-KEM secret keys", ErrUnsupported)
+}
+
+func (k *stdlibPrivateKey) Decapsulate(ciphertext []byte) ([]byte, error) {
+	return k.decapsulate(ciphertext)
+}
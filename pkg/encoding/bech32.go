@@ -127,17 +127,25 @@ func Encode(hrp string, raw []byte) (string, error) {
 	return sb.String(), nil
 }
 
-// Decode decodes string into hrp and 8-bit data.
+// Decode decodes string into hrp and 8-bit data. The returned hrp is always
+// lowercase.
 func Decode(s string) (string, []byte, error) {
 	if len(s) < 8 || len(s) > 6000 {
 		return "", nil, errors.New("bech32: invalid length")
 	}
-	// Lowercase only
+	// Either all lowercase or all uppercase, as used by age plugin identities
+	var lower, upper bool
 	for _, c := range s {
-		if c < 33 || c > 126 || (c >= 'A' && c <= 'Z') {
-			return "", nil, errors.New("bech32: mixed or invalid case")
+		if c < 33 || c > 126 {
+			return "", nil, errors.New("bech32: invalid character")
 		}
+		lower = lower || (c >= 'a' && c <= 'z')
+		upper = upper || (c >= 'A' && c <= 'Z')
+	}
+	if lower && upper {
+		return "", nil, errors.New("bech32: mixed case")
 	}
+	s = strings.ToLower(s)
 	pos := strings.LastIndexByte(s, '1')
 	if pos < 1 || pos+7 > len(s) {
 		return "", nil, errors.New("bech32: invalid separator position")
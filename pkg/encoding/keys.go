@@ -11,40 +11,80 @@ import (
 const (
 	HRPPublic = "qage"
 	HRPSecret = "qagseck"
+
+	// HRPPluginRecipient and HRPPluginIdentity are the HRPs of the age plugin
+	// encodings (age1qage1... and AGE-PLUGIN-QAGE-1...), which make age and
+	// other clients invoke age-plugin-qage. Plugin identities are written in
+	// uppercase.
+	HRPPluginRecipient = "age1qage"
+	HRPPluginIdentity  = "age-plugin-qage-"
+)
+
+// Identity line prefixes: IdentityFilePrefix precedes the bech32 identity in
+// the qage file format, PluginIdentityPrefix starts plugin-encoded identities.
+const (
+	IdentityFilePrefix   = "QAGE-SECRET-KEY-1"
+	PluginIdentityPrefix = "AGE-PLUGIN-QAGE-1"
 )
 
 // Suite identifies the cryptographic suite.
 type Suite uint8
 
 const (
-	HybridX25519MLKEM768 Suite = 1
+	HybridX25519Kyber768 Suite = 1
+	HybridX25519MLKEM768 Suite = 2
+	HybridP384MLKEM1024  Suite = 3
 )
 
-// Recipient represents a qage recipient.
+// Recipient represents a qage recipient. Only the ECDH field matching the
+// suite is used.
 type Recipient struct {
 	Suite     Suite
 	X25519Pub [32]byte
+	P384Pub   []byte
 	MLKEMPub  []byte
 }
 
-// Identity represents a qage identity.
+// Seed sizes of compact identities. Compact identities store a master seed
+// from which both secret keys are expanded, instead of the keys themselves.
+const (
+	SeedSize     = 32
+	LongSeedSize = 64
+)
+
+// compactFlag is set in the suite byte of compact identity encodings, which
+// are followed by the seed instead of the secret keys.
+const compactFlag = 0x80
+
+// Identity represents a qage identity. Only the ECDH field matching the suite
+// is used. If Seed is set, the identity is compact and the key fields are
+// ignored.
 type Identity struct {
 	Suite        Suite
 	X25519Secret [32]byte
+	P384Secret   []byte
 	MLKEMSecret  []byte
+	Seed         []byte
 }
 
-// ParseRecipient parses a qage recipient from its bech32 encoding.
+// ParseRecipient parses a qage recipient from its bech32 encoding, in either
+// the native (qage1...) or the plugin (age1qage1...) form.
 func ParseRecipient(recipientStr string) (*Recipient, error) {
 	hrp, data, err := Decode(recipientStr)
 	if err != nil {
 		return nil, fmt.Errorf("qage: invalid recipient encoding: %w", err)
 	}
 
-	if hrp != HRPPublic {
-		return nil, fmt.Errorf("qage: invalid recipient HRP %q, expected %q", hrp, HRPPublic)
+	if hrp != HRPPublic && hrp != HRPPluginRecipient {
+		return nil, fmt.Errorf("qage: invalid recipient HRP %q, expected %q or %q", hrp, HRPPublic, HRPPluginRecipient)
 	}
 
+	return ParseRecipientData(data)
+}
+
+// ParseRecipientData parses the payload of a recipient encoding: the suite
+// byte followed by the public keys.
+func ParseRecipientData(data []byte) (*Recipient, error) {
 	if len(data) == 0 {
 		return nil, errors.New("qage: empty recipient data")
 	}
@@ -54,20 +94,24 @@ func ParseRecipient(recipientStr string) (*Recipient, error) {
 	data = data[1:]
 
 	switch suite {
-	case HybridX25519MLKEM768:
-		return parseHybridX25519MLKEM768Recipient(data)
+	case HybridX25519Kyber768, HybridX25519MLKEM768:
+		return parseHybridX25519MLKEM768Recipient(suite, data)
+	case HybridP384MLKEM1024:
+		return parseHybridP384MLKEM1024Recipient(data)
 	default:
 		return nil, fmt.Errorf("qage: unsupported suite %d", suite)
 	}
 }
 
-func parseHybridX25519MLKEM768Recipient(data []byte) (*Recipient, error) {
+// parseHybridX25519MLKEM768Recipient parses the keys of a recipient of either
+// X25519 hybrid suite. Kyber768 and ML-KEM-768 share the same key sizes.
+func parseHybridX25519MLKEM768Recipient(suite Suite, data []byte) (*Recipient, error) {
 	const expectedLen = 32 + 1184 // X25519 pub + ML-KEM-768 pub
 	if len(data) != expectedLen {
 		return nil, fmt.Errorf("qage: invalid hybrid recipient length %d, expected %d", len(data), expectedLen)
 	}
 
-	r := &Recipient{Suite: HybridX25519MLKEM768}
+	r := &Recipient{Suite: suite}
 	copy(r.X25519Pub[:], data[:32])
 	r.MLKEMPub = make([]byte, 1184)
 	copy(r.MLKEMPub, data[32:])
@@ -75,17 +119,39 @@ func parseHybridX25519MLKEM768Recipient(data []byte) (*Recipient, error) {
 	return r, nil
 }
 
-// ParseIdentity parses a qage identity from its bech32 encoding.
+func parseHybridP384MLKEM1024Recipient(data []byte) (*Recipient, error) {
+	const expectedLen = 97 + 1568 // uncompressed P-384 pub + ML-KEM-1024 pub
+	if len(data) != expectedLen {
+		return nil, fmt.Errorf("qage: invalid hybrid recipient length %d, expected %d", len(data), expectedLen)
+	}
+
+	r := &Recipient{Suite: HybridP384MLKEM1024}
+	r.P384Pub = make([]byte, 97)
+	copy(r.P384Pub, data[:97])
+	r.MLKEMPub = make([]byte, 1568)
+	copy(r.MLKEMPub, data[97:])
+
+	return r, nil
+}
+
+// ParseIdentity parses a qage identity from its bech32 encoding, in either the
+// native (qagseck1...) or the plugin (AGE-PLUGIN-QAGE-1...) form.
 func ParseIdentity(identityStr string) (*Identity, error) {
 	hrp, data, err := Decode(identityStr)
 	if err != nil {
 		return nil, fmt.Errorf("qage: invalid identity encoding: %w", err)
 	}
 
-	if hrp != HRPSecret {
-		return nil, fmt.Errorf("qage: invalid identity HRP %q, expected %q", hrp, HRPSecret)
+	if hrp != HRPSecret && hrp != HRPPluginIdentity {
+		return nil, fmt.Errorf("qage: invalid identity HRP %q, expected %q or %q", hrp, HRPSecret, strings.ToUpper(HRPPluginIdentity))
 	}
 
+	return ParseIdentityData(data)
+}
+
+// ParseIdentityData parses the payload of an identity encoding: the suite
+// byte followed by the secret keys or, for compact identities, by the seed.
+func ParseIdentityData(data []byte) (*Identity, error) {
 	if len(data) == 0 {
 		return nil, errors.New("qage: empty identity data")
 	}
@@ -94,21 +160,29 @@ func ParseIdentity(identityStr string) (*Identity, error) {
 	suite := Suite(data[0])
 	data = data[1:]
 
+	if suite&compactFlag != 0 {
+		return parseCompactIdentity(suite&^compactFlag, data)
+	}
+
 	switch suite {
-	case HybridX25519MLKEM768:
-		return parseHybridX25519MLKEM768Identity(data)
+	case HybridX25519Kyber768, HybridX25519MLKEM768:
+		return parseHybridX25519MLKEM768Identity(suite, data)
+	case HybridP384MLKEM1024:
+		return parseHybridP384MLKEM1024Identity(data)
 	default:
 		return nil, fmt.Errorf("qage: unsupported suite %d", suite)
 	}
 }
 
-func parseHybridX25519MLKEM768Identity(data []byte) (*Identity, error) {
+// parseHybridX25519MLKEM768Identity parses the keys of an identity of either
+// X25519 hybrid suite.
+func parseHybridX25519MLKEM768Identity(suite Suite, data []byte) (*Identity, error) {
 	const expectedLen = 32 + 2400 // X25519 priv + ML-KEM-768 priv
 	if len(data) != expectedLen {
 		return nil, fmt.Errorf("qage: invalid hybrid identity length %d, expected %d", len(data), expectedLen)
 	}
 
-	id := &Identity{Suite: HybridX25519MLKEM768}
+	id := &Identity{Suite: suite}
 	copy(id.X25519Secret[:], data[:32])
 	id.MLKEMSecret = make([]byte, 2400)
 	copy(id.MLKEMSecret, data[32:])
@@ -116,57 +190,188 @@ func parseHybridX25519MLKEM768Identity(data []byte) (*Identity, error) {
 	return id, nil
 }
 
+// parseCompactIdentity parses the seed of a compact identity. The legacy
+// Kyber768 suite has no compact form.
+func parseCompactIdentity(suite Suite, data []byte) (*Identity, error) {
+	switch suite {
+	case HybridX25519MLKEM768, HybridP384MLKEM1024:
+	default:
+		return nil, fmt.Errorf("qage: unsupported compact identity suite %d", suite)
+	}
+	if len(data) != SeedSize && len(data) != LongSeedSize {
+		return nil, fmt.Errorf("qage: invalid identity seed length %d, expected %d or %d", len(data), SeedSize, LongSeedSize)
+	}
+
+	return &Identity{Suite: suite, Seed: append([]byte(nil), data...)}, nil
+}
+
+func parseHybridP384MLKEM1024Identity(data []byte) (*Identity, error) {
+	const expectedLen = 48 + 3168 // P-384 priv + ML-KEM-1024 priv
+	if len(data) != expectedLen {
+		return nil, fmt.Errorf("qage: invalid hybrid identity length %d, expected %d", len(data), expectedLen)
+	}
+
+	id := &Identity{Suite: HybridP384MLKEM1024}
+	id.P384Secret = make([]byte, 48)
+	copy(id.P384Secret, data[:48])
+	id.MLKEMSecret = make([]byte, 3168)
+	copy(id.MLKEMSecret, data[48:])
+
+	return id, nil
+}
+
 // EncodeRecipient encodes a recipient to its bech32 representation.
 func EncodeRecipient(r *Recipient) (string, error) {
+	data, err := recipientData(r)
+	if err != nil {
+		return "", err
+	}
+	return Encode(HRPPublic, data)
+}
+
+// EncodePluginRecipient encodes a recipient to its age plugin representation,
+// age1qage1...
+func EncodePluginRecipient(r *Recipient) (string, error) {
+	data, err := recipientData(r)
+	if err != nil {
+		return "", err
+	}
+	return Encode(HRPPluginRecipient, data)
+}
+
+// recipientData returns the payload of a recipient encoding.
+func recipientData(r *Recipient) ([]byte, error) {
 	switch r.Suite {
-	case HybridX25519MLKEM768:
-		return encodeHybridX25519MLKEM768Recipient(r)
+	case HybridX25519Kyber768, HybridX25519MLKEM768:
+		return hybridX25519MLKEM768RecipientData(r), nil
+	case HybridP384MLKEM1024:
+		return hybridP384MLKEM1024RecipientData(r)
 	default:
-		return "", fmt.Errorf("qage: unsupported suite %d", r.Suite)
+		return nil, fmt.Errorf("qage: unsupported suite %d", r.Suite)
 	}
 }
 
-func encodeHybridX25519MLKEM768Recipient(r *Recipient) (string, error) {
+func hybridX25519MLKEM768RecipientData(r *Recipient) []byte {
 	var buf bytes.Buffer
 	buf.WriteByte(byte(r.Suite))
 	buf.Write(r.X25519Pub[:])
 	buf.Write(r.MLKEMPub)
 
-	return Encode(HRPPublic, buf.Bytes())
+	return buf.Bytes()
+}
+
+func hybridP384MLKEM1024RecipientData(r *Recipient) ([]byte, error) {
+	if len(r.P384Pub) != 97 || len(r.MLKEMPub) != 1568 {
+		return nil, errors.New("qage: invalid P-384+ML-KEM-1024 recipient key length")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(byte(r.Suite))
+	buf.Write(r.P384Pub)
+	buf.Write(r.MLKEMPub)
+
+	return buf.Bytes(), nil
 }
 
 // EncodeIdentity encodes an identity to its bech32 representation.
 func EncodeIdentity(id *Identity) (string, error) {
+	data, err := IdentityData(id)
+	if err != nil {
+		return "", err
+	}
+	return Encode(HRPSecret, data)
+}
+
+// EncodePluginIdentity encodes an identity to its age plugin representation,
+// AGE-PLUGIN-QAGE-1...
+func EncodePluginIdentity(id *Identity) (string, error) {
+	data, err := IdentityData(id)
+	if err != nil {
+		return "", err
+	}
+	s, err := Encode(HRPPluginIdentity, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(s), nil
+}
+
+// IdentityData returns the payload of an identity encoding, as parsed by
+// ParseIdentityData.
+func IdentityData(id *Identity) ([]byte, error) {
+	if id.Seed != nil {
+		return compactIdentityData(id)
+	}
+
 	switch id.Suite {
-	case HybridX25519MLKEM768:
-		return encodeHybridX25519MLKEM768Identity(id)
+	case HybridX25519Kyber768, HybridX25519MLKEM768:
+		return hybridX25519MLKEM768IdentityData(id), nil
+	case HybridP384MLKEM1024:
+		return hybridP384MLKEM1024IdentityData(id)
 	default:
-		return "", fmt.Errorf("qage: unsupported suite %d", id.Suite)
+		return nil, fmt.Errorf("qage: unsupported suite %d", id.Suite)
 	}
 }
 
-func encodeHybridX25519MLKEM768Identity(id *Identity) (string, error) {
+func hybridX25519MLKEM768IdentityData(id *Identity) []byte {
 	var buf bytes.Buffer
 	buf.WriteByte(byte(id.Suite))
 	buf.Write(id.X25519Secret[:])
 	buf.Write(id.MLKEMSecret)
 
-	return Encode(HRPSecret, buf.Bytes())
+	return buf.Bytes()
+}
+
+func compactIdentityData(id *Identity) ([]byte, error) {
+	if id.Suite != HybridX25519MLKEM768 && id.Suite != HybridP384MLKEM1024 {
+		return nil, fmt.Errorf("qage: unsupported compact identity suite %d", id.Suite)
+	}
+	if len(id.Seed) != SeedSize && len(id.Seed) != LongSeedSize {
+		return nil, fmt.Errorf("qage: invalid identity seed length %d", len(id.Seed))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(byte(id.Suite) | compactFlag)
+	buf.Write(id.Seed)
+
+	return buf.Bytes(), nil
+}
+
+func hybridP384MLKEM1024IdentityData(id *Identity) ([]byte, error) {
+	if len(id.P384Secret) != 48 || len(id.MLKEMSecret) != 3168 {
+		return nil, errors.New("qage: invalid P-384+ML-KEM-1024 identity key length")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(byte(id.Suite))
+	buf.Write(id.P384Secret)
+	buf.Write(id.MLKEMSecret)
+
+	return buf.Bytes(), nil
 }
 
-// ParseIdentityFile parses an identity from the "QAGE-SECRET-KEY-1 <bech32> # comment" format.
+// ParseIdentityFile parses an identity from the "QAGE-SECRET-KEY-1 <bech32> # comment" format,
+// or a bare AGE-PLUGIN-QAGE-1... line as written to age identity files.
 func ParseIdentityFile(line string) (*Identity, string, error) {
 	line = strings.TrimSpace(line)
 	if line == "" || strings.HasPrefix(line, "#") {
 		return nil, "", errors.New("qage: empty or comment line")
 	}
 
-	if !strings.HasPrefix(line, "QAGE-SECRET-KEY-1 ") {
+	if strings.HasPrefix(line, PluginIdentityPrefix) {
+		id, err := ParseIdentity(line)
+		if err != nil {
+			return nil, "", err
+		}
+		return id, "", nil
+	}
+
+	if !strings.HasPrefix(line, IdentityFilePrefix+" ") {
 		return nil, "", errors.New("qage: invalid identity line format")
 	}
 
 	// Remove prefix
-	line = strings.TrimPrefix(line, "QAGE-SECRET-KEY-1 ")
+	line = strings.TrimPrefix(line, IdentityFilePrefix+" ")
 
 	// Split on first whitespace to separate key from comment
 	parts := strings.SplitN(line, " ", 2)
@@ -196,7 +401,7 @@ func FormatIdentityFile(id *Identity, comment string) (string, error) {
 	}
 
 	if comment != "" {
-		return fmt.Sprintf("QAGE-SECRET-KEY-1 %s # %s", encoded, comment), nil
+		return fmt.Sprintf("%s %s # %s", IdentityFilePrefix, encoded, comment), nil
 	}
-	return fmt.Sprintf("QAGE-SECRET-KEY-1 %s", encoded), nil
+	return fmt.Sprintf("%s %s", IdentityFilePrefix, encoded), nil
 }
@@ -3,6 +3,7 @@ package encoding
 import (
 	"bytes"
 	"crypto/rand"
+	"strings"
 	"testing"
 )
 
@@ -234,3 +235,210 @@ func TestParseIdentityFileErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeDecodeLegacySuite(t *testing.T) {
+	r := &Recipient{
+		Suite:    HybridX25519Kyber768,
+		MLKEMPub: make([]byte, 1184),
+	}
+
+	encoded, err := EncodeRecipient(r)
+	if err != nil {
+		t.Fatalf("EncodeRecipient failed: %v", err)
+	}
+
+	decoded, err := ParseRecipient(encoded)
+	if err != nil {
+		t.Fatalf("ParseRecipient failed: %v", err)
+	}
+
+	if decoded.Suite != HybridX25519Kyber768 {
+		t.Errorf("suite mismatch: expected %v, got %v", HybridX25519Kyber768, decoded.Suite)
+	}
+
+	// The suite byte distinguishes otherwise identical encodings
+	r.Suite = HybridX25519MLKEM768
+	encoded2, err := EncodeRecipient(r)
+	if err != nil {
+		t.Fatalf("EncodeRecipient failed: %v", err)
+	}
+	if encoded == encoded2 {
+		t.Error("expected different encodings for different suites")
+	}
+}
+
+func TestEncodeDecodeP384MLKEM1024(t *testing.T) {
+	r := &Recipient{
+		Suite:    HybridP384MLKEM1024,
+		P384Pub:  make([]byte, 97),
+		MLKEMPub: make([]byte, 1568),
+	}
+	if _, err := rand.Read(r.MLKEMPub); err != nil {
+		t.Fatalf("failed to generate random ML-KEM key: %v", err)
+	}
+
+	encoded, err := EncodeRecipient(r)
+	if err != nil {
+		t.Fatalf("EncodeRecipient failed: %v", err)
+	}
+	decoded, err := ParseRecipient(encoded)
+	if err != nil {
+		t.Fatalf("ParseRecipient failed: %v", err)
+	}
+	if decoded.Suite != HybridP384MLKEM1024 || !bytes.Equal(decoded.MLKEMPub, r.MLKEMPub) {
+		t.Errorf("recipient mismatch after parsing")
+	}
+
+	id := &Identity{
+		Suite:       HybridP384MLKEM1024,
+		P384Secret:  make([]byte, 48),
+		MLKEMSecret: make([]byte, 3168),
+	}
+	if _, err := rand.Read(id.P384Secret); err != nil {
+		t.Fatalf("failed to generate random P-384 key: %v", err)
+	}
+
+	encodedID, err := EncodeIdentity(id)
+	if err != nil {
+		t.Fatalf("EncodeIdentity failed: %v", err)
+	}
+	decodedID, err := ParseIdentity(encodedID)
+	if err != nil {
+		t.Fatalf("ParseIdentity failed: %v", err)
+	}
+	if !bytes.Equal(decodedID.P384Secret, id.P384Secret) {
+		t.Errorf("P-384 secret key mismatch")
+	}
+
+	// Keys of the wrong size are rejected
+	id.MLKEMSecret = make([]byte, 2400)
+	if _, err := EncodeIdentity(id); err == nil {
+		t.Error("expected error for wrong ML-KEM secret key length")
+	}
+}
+
+func TestEncodeDecodePlugin(t *testing.T) {
+	r := &Recipient{
+		Suite:    HybridX25519MLKEM768,
+		MLKEMPub: make([]byte, 1184),
+	}
+	if _, err := rand.Read(r.X25519Pub[:]); err != nil {
+		t.Fatalf("failed to generate random X25519 key: %v", err)
+	}
+
+	encoded, err := EncodePluginRecipient(r)
+	if err != nil {
+		t.Fatalf("EncodePluginRecipient failed: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "age1qage1") {
+		t.Errorf("unexpected plugin recipient prefix: %s", encoded[:12])
+	}
+	decoded, err := ParseRecipient(encoded)
+	if err != nil {
+		t.Fatalf("ParseRecipient failed: %v", err)
+	}
+	if decoded.X25519Pub != r.X25519Pub {
+		t.Errorf("X25519 public key mismatch")
+	}
+
+	id := &Identity{
+		Suite:       HybridX25519MLKEM768,
+		MLKEMSecret: make([]byte, 2400),
+	}
+	if _, err := rand.Read(id.X25519Secret[:]); err != nil {
+		t.Fatalf("failed to generate random X25519 key: %v", err)
+	}
+
+	encodedID, err := EncodePluginIdentity(id)
+	if err != nil {
+		t.Fatalf("EncodePluginIdentity failed: %v", err)
+	}
+	if !strings.HasPrefix(encodedID, PluginIdentityPrefix) || encodedID != strings.ToUpper(encodedID) {
+		t.Errorf("plugin identity is not an uppercase %s string", PluginIdentityPrefix)
+	}
+	decodedID, err := ParseIdentity(encodedID)
+	if err != nil {
+		t.Fatalf("ParseIdentity failed: %v", err)
+	}
+	if decodedID.X25519Secret != id.X25519Secret {
+		t.Errorf("X25519 secret key mismatch")
+	}
+
+	// Bare plugin identities are accepted in identity files
+	fileID, comment, err := ParseIdentityFile(encodedID)
+	if err != nil {
+		t.Fatalf("ParseIdentityFile failed: %v", err)
+	}
+	if fileID.X25519Secret != id.X25519Secret || comment != "" {
+		t.Errorf("identity file mismatch")
+	}
+
+	// Mixed case is not valid bech32
+	mixed := strings.ToLower(encodedID[:20]) + encodedID[20:]
+	if _, err := ParseIdentity(mixed); err == nil {
+		t.Error("expected error for mixed-case identity")
+	}
+
+	// A recipient is not an identity
+	if _, err := ParseIdentity(encoded); err == nil {
+		t.Error("expected error for recipient parsed as identity")
+	}
+}
+
+func TestEncodeDecodeCompactIdentity(t *testing.T) {
+	for _, suite := range []Suite{HybridX25519MLKEM768, HybridP384MLKEM1024} {
+		for _, size := range []int{SeedSize, LongSeedSize} {
+			id := &Identity{Suite: suite, Seed: make([]byte, size)}
+			if _, err := rand.Read(id.Seed); err != nil {
+				t.Fatalf("failed to generate random seed: %v", err)
+			}
+
+			line, err := FormatIdentityFile(id, "backup")
+			if err != nil {
+				t.Fatalf("FormatIdentityFile failed: %v", err)
+			}
+			if len(line) > 150 {
+				t.Errorf("compact identity line is %d characters long", len(line))
+			}
+			decoded, comment, err := ParseIdentityFile(line)
+			if err != nil {
+				t.Fatalf("ParseIdentityFile failed: %v", err)
+			}
+			if decoded.Suite != suite || !bytes.Equal(decoded.Seed, id.Seed) || comment != "backup" {
+				t.Errorf("compact identity mismatch for suite %d, %d-byte seed", suite, size)
+			}
+
+			plugin, err := EncodePluginIdentity(id)
+			if err != nil {
+				t.Fatalf("EncodePluginIdentity failed: %v", err)
+			}
+			if decoded, err := ParseIdentity(plugin); err != nil || !bytes.Equal(decoded.Seed, id.Seed) {
+				t.Errorf("plugin compact identity mismatch: %v", err)
+			}
+		}
+	}
+
+	// Expanded identities carry no seed
+	expanded := &Identity{Suite: HybridX25519MLKEM768, MLKEMSecret: make([]byte, 2400)}
+	encoded, err := EncodeIdentity(expanded)
+	if err != nil {
+		t.Fatalf("EncodeIdentity failed: %v", err)
+	}
+	if decoded, err := ParseIdentity(encoded); err != nil || decoded.Seed != nil {
+		t.Errorf("expanded identity decoded with seed %x: %v", decoded.Seed, err)
+	}
+
+	invalid := []*Identity{
+		{Suite: HybridX25519MLKEM768, Seed: make([]byte, 48)},
+		{Suite: HybridX25519Kyber768, Seed: make([]byte, SeedSize)},
+	}
+	for _, id := range invalid {
+		if _, err := EncodeIdentity(id); err == nil {
+			t.Errorf("expected error encoding suite %d with a %d-byte seed", id.Suite, len(id.Seed))
+		}
+		data := append([]byte{byte(id.Suite) | compactFlag}, id.Seed...)
+		if _, err := ParseIdentityData(data); err == nil {
+			t.Errorf("expected error parsing suite %d with a %d-byte seed", id.Suite, len(id.Seed))
+		}
+	}
+}
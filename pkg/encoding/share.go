@@ -0,0 +1,70 @@
+package encoding
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// HRPShare is the HRP of identity shares (qagshare1...).
+const HRPShare = "qagshare"
+
+// FingerprintSize is the size of the truncated recipient hash that identifies
+// the identity a share belongs to.
+const FingerprintSize = 16
+
+// shareVersion is the first byte of a share encoding.
+const shareVersion = 1
+
+// Share is one share of an identity split with Shamir's secret sharing. Value
+// is a share of the identity's encoding payload, as returned by IdentityData.
+type Share struct {
+	Index       byte
+	Threshold   byte
+	Fingerprint [FingerprintSize]byte
+	Value       []byte
+}
+
+// EncodeShare encodes a share to its bech32 representation.
+func EncodeShare(s *Share) (string, error) {
+	if s.Index == 0 || s.Threshold < 2 || len(s.Value) == 0 {
+		return "", errors.New("qage: invalid share")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(shareVersion)
+	buf.WriteByte(s.Index)
+	buf.WriteByte(s.Threshold)
+	buf.Write(s.Fingerprint[:])
+	buf.Write(s.Value)
+
+	return Encode(HRPShare, buf.Bytes())
+}
+
+// ParseShare parses a share from its bech32 encoding.
+func ParseShare(shareStr string) (*Share, error) {
+	hrp, data, err := Decode(shareStr)
+	if err != nil {
+		return nil, fmt.Errorf("qage: invalid share encoding: %w", err)
+	}
+	if hrp != HRPShare {
+		return nil, fmt.Errorf("qage: invalid share HRP %q, expected %q", hrp, HRPShare)
+	}
+
+	const headerLen = 3 + FingerprintSize
+	if len(data) <= headerLen {
+		return nil, fmt.Errorf("qage: invalid share length %d", len(data))
+	}
+	if data[0] != shareVersion {
+		return nil, fmt.Errorf("qage: unsupported share version %d", data[0])
+	}
+
+	s := &Share{Index: data[1], Threshold: data[2]}
+	if s.Index == 0 || s.Threshold < 2 {
+		return nil, fmt.Errorf("qage: invalid share %d with threshold %d", s.Index, s.Threshold)
+	}
+	copy(s.Fingerprint[:], data[3:headerLen])
+	s.Value = append([]byte(nil), data[headerLen:]...)
+
+	return s, nil
+}
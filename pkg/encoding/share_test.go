@@ -0,0 +1,47 @@
+package encoding
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecodeShare(t *testing.T) {
+	s := &Share{Index: 4, Threshold: 3, Value: bytes.Repeat([]byte{0xab}, 33)}
+	copy(s.Fingerprint[:], "0123456789abcdef")
+
+	encoded, err := EncodeShare(s)
+	if err != nil {
+		t.Fatalf("EncodeShare failed: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "qagshare1") {
+		t.Errorf("unexpected share encoding %q", encoded)
+	}
+	decoded, err := ParseShare(encoded)
+	if err != nil {
+		t.Fatalf("ParseShare failed: %v", err)
+	}
+	if decoded.Index != s.Index || decoded.Threshold != s.Threshold ||
+		decoded.Fingerprint != s.Fingerprint || !bytes.Equal(decoded.Value, s.Value) {
+		t.Errorf("share mismatch: %+v", decoded)
+	}
+
+	for _, invalid := range []*Share{
+		{Index: 0, Threshold: 2, Value: []byte{1}},
+		{Index: 1, Threshold: 1, Value: []byte{1}},
+		{Index: 1, Threshold: 2},
+	} {
+		if _, err := EncodeShare(invalid); err == nil {
+			t.Errorf("expected error encoding %+v", invalid)
+		}
+	}
+
+	// An identity is not a share
+	id, err := EncodeIdentity(&Identity{Suite: HybridX25519MLKEM768, Seed: make([]byte, SeedSize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseShare(id); err == nil {
+		t.Error("expected error for identity parsed as share")
+	}
+}
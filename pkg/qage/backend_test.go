@@ -0,0 +1,157 @@
+package qage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/zlobste/qage/pkg/crypto"
+	"github.com/zlobste/qage/pkg/encoding"
+)
+
+func TestStdlibBackend(t *testing.T) {
+	fileKey := bytes.Repeat([]byte{9}, 16)
+	for _, suite := range []Suite{HybridX25519MLKEM768, HybridP384MLKEM1024} {
+		seed := bytes.Repeat([]byte{byte(suite)}, SeedSize)
+		circl, err := NewIdentityFromSeed(seed, Config{Suite: suite, Backend: crypto.Circl()})
+		if err != nil {
+			t.Fatalf("%s: NewIdentityFromSeed failed: %v", suite, err)
+		}
+		stdlib, err := NewIdentityFromSeed(seed, Config{Suite: suite, Backend: crypto.Stdlib()})
+		if err != nil {
+			t.Fatalf("%s: NewIdentityFromSeed failed: %v", suite, err)
+		}
+		if mustString(t, circl.Recipient()) != mustString(t, stdlib.Recipient()) {
+			t.Fatalf("%s: backends derive different recipients", suite)
+		}
+
+		// Each backend unwraps what the other wraps
+		for _, pair := range [][2]*Identity{{circl, stdlib}, {stdlib, circl}} {
+			stanzas, err := pair[0].Recipient().Wrap(fileKey)
+			if err != nil {
+				t.Fatalf("%s: Wrap failed: %v", suite, err)
+			}
+			if got, err := pair[1].Unwrap(stanzas); err != nil || !bytes.Equal(got, fileKey) {
+				t.Errorf("%s: Unwrap failed: %v", suite, err)
+			}
+		}
+
+		s, err := stdlib.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseIdentityWithConfig(s, Config{Backend: crypto.Stdlib()})
+		if err != nil {
+			t.Fatalf("%s: ParseIdentityWithConfig failed: %v", suite, err)
+		}
+		if mustString(t, parsed.Recipient()) != mustString(t, circl.Recipient()) {
+			t.Errorf("%s: parsed identity doesn't match", suite)
+		}
+	}
+
+	// The standard library has no Kyber768, and only takes ML-KEM seeds
+	legacy, err := newLegacyIdentity(t).String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseIdentityWithConfig(legacy, Config{Backend: crypto.Stdlib()}); !errors.Is(err, crypto.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for a Kyber768 identity, got %v", err)
+	}
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expanded := &Identity{suite: id.suite, ecSecret: id.ecSecret, mlkemSecret: id.mlkemSecret}
+	s, err := expanded.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseIdentityWithConfig(s, Config{Backend: crypto.Stdlib()}); !errors.Is(err, crypto.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for an expanded identity, got %v", err)
+	}
+}
+
+// TestFIPSMode runs itself again with GODEBUG=fips140=on.
+func TestFIPSMode(t *testing.T) {
+	if !crypto.FIPSMode() {
+		if os.Getenv("QAGE_TEST_FIPS") != "" {
+			t.Skip("FIPS 140-3 mode is not available")
+		}
+		cmd := exec.Command(os.Args[0], "-test.run=^TestFIPSMode$", "-test.v")
+		cmd.Env = append(os.Environ(), "GODEBUG=fips140=on", "QAGE_TEST_FIPS=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil || !strings.Contains(string(out), "--- PASS: TestFIPSMode") {
+			t.Fatalf("FIPS 140-3 mode test failed: %v\n%s", err, out)
+		}
+		return
+	}
+
+	cfg := DefaultConfig()
+	if cfg.Suite != HybridP384MLKEM1024 || cfg.Backend.Name() != "stdlib" {
+		t.Errorf("unexpected default configuration %s with %s", cfg.Suite, cfg.Backend.Name())
+	}
+
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	fileKey := bytes.Repeat([]byte{5}, 16)
+	stanzas, err := id.Recipient().Wrap(fileKey)
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	if got, err := id.Unwrap(stanzas); err != nil || !bytes.Equal(got, fileKey) {
+		t.Fatalf("Unwrap failed: %v", err)
+	}
+
+	// X25519 suites and the circl KEMs are refused
+	if _, err := NewIdentityWithConfig(Config{Suite: HybridX25519MLKEM768}); !errors.Is(err, crypto.ErrNotApproved) {
+		t.Errorf("expected ErrNotApproved for X25519, got %v", err)
+	}
+	if _, err := NewIdentityWithConfig(Config{Backend: crypto.Circl()}); !errors.Is(err, crypto.ErrNotApproved) {
+		t.Errorf("expected ErrNotApproved for circl, got %v", err)
+	}
+	x25519, err := encoding.EncodeRecipient(&encoding.Recipient{
+		Suite:     encoding.Suite(HybridX25519MLKEM768),
+		X25519Pub: [32]byte{9},
+		MLKEMPub:  make([]byte, 1184),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseRecipient(x25519); !errors.Is(err, crypto.ErrNotApproved) {
+		t.Errorf("expected ErrNotApproved for an X25519 recipient, got %v", err)
+	}
+}
+
+// brokenBackend is a backend whose ML-KEM encapsulation keys are wrong.
+type brokenBackend struct {
+	crypto.Backend
+}
+
+func (brokenBackend) Name() string { return "broken-mlkem" }
+
+func (b brokenBackend) KEM(id crypto.KEMID) (crypto.KEM, error) {
+	k, err := b.Backend.KEM(id)
+	return brokenKEM{k}, err
+}
+
+type brokenKEM struct {
+	crypto.KEM
+}
+
+func (k brokenKEM) NewPrivateKey(seed []byte) (crypto.KEMPrivateKey, error) {
+	seed = bytes.Clone(seed)
+	seed[0] ^= 1
+	return k.KEM.NewPrivateKey(seed)
+}
+
+func TestPowerOnSelfTest(t *testing.T) {
+	_, err := NewIdentityWithConfig(Config{Backend: brokenBackend{crypto.Circl()}})
+	if err == nil || !strings.Contains(err.Error(), "power-on self-test failed") {
+		t.Errorf("expected a power-on self-test failure, got %v", err)
+	}
+}
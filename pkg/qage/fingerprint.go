@@ -0,0 +1,79 @@
+package qage
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+
+	"github.com/zlobste/qage/internal/bip39"
+	"github.com/zlobste/qage/internal/randomart"
+	"github.com/zlobste/qage/pkg/encoding"
+)
+
+// FingerprintPrefix starts every recipient fingerprint.
+const FingerprintPrefix = "qagefp:"
+
+// fingerprintSize is the number of SHA-256 bytes kept in a fingerprint.
+const fingerprintSize = encoding.FingerprintSize
+
+// Fingerprint returns a short, canonical fingerprint of the recipient:
+// FingerprintPrefix followed by the base32 of a truncated SHA-256 of its
+// encoded keys. It is the same for the qage1... and age1qage1... encodings
+// and for any combiner.
+func (r *Recipient) Fingerprint() string {
+	return formatFingerprint(r.fingerprint())
+}
+
+// fingerprint returns the raw fingerprint of the recipient.
+func (r *Recipient) fingerprint() [fingerprintSize]byte {
+	h := sha256.New()
+	h.Write([]byte{byte(r.suite)})
+	h.Write(r.ecPub)
+	h.Write(r.mlkemPub)
+	return [fingerprintSize]byte(h.Sum(nil))
+}
+
+// formatFingerprint formats a raw fingerprint as returned by Fingerprint.
+func formatFingerprint(fp [fingerprintSize]byte) string {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(fp[:])
+	return FingerprintPrefix + strings.ToLower(enc)
+}
+
+// VerificationWords returns the fingerprint of the recipient as 12 words of
+// the BIP-39 English word list, which are easier to read out over the phone.
+// They encode the same bits as Fingerprint, and are not a recovery phrase.
+func (r *Recipient) VerificationWords() string {
+	fp := r.fingerprint()
+	words, err := bip39.NewMnemonic(fp[:])
+	if err != nil {
+		panic("qage: internal error: " + err.Error())
+	}
+	return words
+}
+
+// Randomart returns an OpenSSH-style randomart image of the fingerprint of the
+// recipient, titled with its suite, for comparing keys at a glance.
+func (r *Recipient) Randomart() string {
+	title := "qage"
+	if p, err := r.suite.params(); err == nil && p.stanzaTag != "" {
+		title = p.stanzaTag
+	}
+	fp := r.fingerprint()
+	return randomart.Render(fp[:], title, strings.TrimSuffix(FingerprintPrefix, ":"))
+}
+
+// Fingerprint returns the fingerprint of the identity's recipient.
+func (id *Identity) Fingerprint() string {
+	return id.Recipient().Fingerprint()
+}
+
+// VerificationWords returns the verification words of the identity's
+// recipient.
+func (id *Identity) VerificationWords() string {
+	return id.Recipient().VerificationWords()
+}
+
+// Randomart returns the randomart image of the identity's recipient.
+func (id *Identity) Randomart() string {
+	return id.Recipient().Randomart()
+}
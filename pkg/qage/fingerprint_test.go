@@ -0,0 +1,47 @@
+package qage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	fp := id.Fingerprint()
+	if !strings.HasPrefix(fp, FingerprintPrefix) || len(fp) != len(FingerprintPrefix)+26 {
+		t.Fatalf("unexpected fingerprint %q", fp)
+	}
+
+	// The encoding and combiner don't change the fingerprint
+	s, err := id.Recipient().PluginString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseRecipientWithConfig(s, Config{Combiner: CombinerConcat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Fingerprint() != fp {
+		t.Error("fingerprint depends on the recipient encoding")
+	}
+	if r.VerificationWords() != id.VerificationWords() || r.Randomart() != id.Randomart() {
+		t.Error("verification words or randomart depend on the recipient encoding")
+	}
+	if words := strings.Fields(id.VerificationWords()); len(words) != 12 {
+		t.Errorf("expected 12 verification words, got %q", words)
+	}
+	if art := id.Randomart(); !strings.HasPrefix(art, "+[x25519-mlkem768]+\n") || !strings.HasSuffix(art, "+----[qagefp]-----+\n") {
+		t.Errorf("unexpected randomart:\n%s", art)
+	}
+
+	other, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Fingerprint() == fp || other.VerificationWords() == id.VerificationWords() || other.Randomart() == id.Randomart() {
+		t.Error("different identities have the same fingerprint")
+	}
+}
@@ -0,0 +1,212 @@
+package qage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/zlobste/qage/internal/format"
+)
+
+// Sizes of the age payload: a nonce followed by chunks of up to payloadChunkSize
+// bytes of plaintext, each sealed with a Poly1305 tag.
+const (
+	payloadNonceSize = 16
+	payloadChunkSize = 64 * 1024
+	payloadTagSize   = 16
+)
+
+// FileInfo describes an age file, as returned by InspectFile.
+type FileInfo struct {
+	Stanzas []StanzaInfo `json:"stanzas"`
+
+	// PostQuantum reports whether any stanza is post-quantum, and
+	// Classical whether any is known not to be.
+	PostQuantum bool `json:"post_quantum"`
+	Classical   bool `json:"classical"`
+
+	// HeaderSize and PayloadSize are the sizes of the two parts of the
+	// file, and PlaintextSize the size of the plaintext implied by the
+	// payload size, or -1 if the payload is truncated.
+	HeaderSize    int64 `json:"header_size"`
+	PayloadSize   int64 `json:"payload_size"`
+	PlaintextSize int64 `json:"plaintext_size"`
+}
+
+// StanzaInfo describes a recipient stanza of an age file.
+type StanzaInfo struct {
+	Type     string   `json:"type"`
+	Args     []string `json:"args"`
+	BodySize int      `json:"body_size"`
+
+	// Description says what kind of recipient the stanza is for, and
+	// Suite the qage suite of qage stanzas.
+	Description string `json:"description"`
+	Suite       string `json:"suite,omitempty"`
+	PostQuantum bool   `json:"post_quantum"`
+
+	// MatchedBy holds the indexes of the identities passed to InspectFile
+	// that unwrap the stanza.
+	MatchedBy []int `json:"matched_by,omitempty"`
+}
+
+// InspectFile reads the age file in r, which must not be armored, and
+// describes its header without decrypting anything. If identities are given,
+// each stanza lists the ones that unwrap it: the file key they unwrap must
+// verify the header MAC, and shares of threshold files must be authentic.
+// The payload is read to the end to measure it.
+func InspectFile(r io.Reader, identities ...age.Identity) (*FileInfo, error) {
+	hdr, payload, err := format.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("qage: failed to read header: %w", err)
+	}
+	var header bytes.Buffer
+	if err := hdr.Marshal(&header); err != nil {
+		return nil, fmt.Errorf("qage: failed to read header: %w", err)
+	}
+
+	info := &FileInfo{HeaderSize: int64(header.Len())}
+	for _, s := range hdr.Stanzas {
+		si := describeStanza(s)
+		if labels, known := stanzaLabels(s); known {
+			si.PostQuantum = slices.Contains(labels, postQuantumLabel)
+			info.PostQuantum = info.PostQuantum || si.PostQuantum
+			info.Classical = info.Classical || !si.PostQuantum
+		}
+		for i, id := range identities {
+			if stanzaMatches(header.Bytes(), s, id) {
+				si.MatchedBy = append(si.MatchedBy, i)
+			}
+		}
+		info.Stanzas = append(info.Stanzas, si)
+	}
+
+	if info.PayloadSize, err = io.Copy(io.Discard, payload); err != nil {
+		return nil, fmt.Errorf("qage: failed to read payload: %w", err)
+	}
+	info.PlaintextSize = plaintextSize(info.PayloadSize)
+
+	return info, nil
+}
+
+// describeStanza describes a stanza from its type and arguments.
+func describeStanza(s *age.Stanza) StanzaInfo {
+	si := StanzaInfo{Type: s.Type, Args: s.Args, BodySize: len(s.Body)}
+	if si.Args == nil {
+		si.Args = []string{}
+	}
+	arg := func(i int) string {
+		if i < len(s.Args) {
+			return s.Args[i]
+		}
+		return "?"
+	}
+
+	switch s.Type {
+	case stanzaType:
+		si.Description, si.Suite = describeQageStanza(s.Args)
+	case shareStanzaType:
+		desc, suite := describeQageStanza(s.Args[min(2, len(s.Args)):])
+		si.Description = fmt.Sprintf("qage threshold share %s of group %s, %s", arg(1), arg(0), desc)
+		si.Suite = suite
+	case thresholdStanzaType:
+		si.Description = fmt.Sprintf("qage threshold group %s: %s of %s shares needed", arg(0), arg(1), arg(2))
+	case hybridStanzaType:
+		si.Description = "age hybrid ML-KEM-768 + X25519"
+	case "X25519":
+		si.Description = "age X25519"
+	case "scrypt":
+		si.Description = fmt.Sprintf("passphrase (scrypt, work factor 2^%s)", arg(1))
+	case "ssh-ed25519":
+		si.Description = fmt.Sprintf("SSH Ed25519 key %s", arg(0))
+	case "ssh-rsa":
+		si.Description = fmt.Sprintf("SSH RSA key %s", arg(0))
+	default:
+		si.Description = "unknown, possibly an age plugin"
+	}
+	return si
+}
+
+// describeQageStanza describes the arguments of a qage stanza, returning the
+// suite if the version is known.
+func describeQageStanza(args []string) (desc, suite string) {
+	if len(args) == 0 {
+		return "malformed qage stanza", ""
+	}
+
+	var s Suite
+	switch args[0] {
+	case stanzaH1, stanzaH2:
+		s = HybridX25519Kyber768
+	case stanzaX25519MLKEM768:
+		s = HybridX25519MLKEM768
+	case stanzaP384MLKEM1024:
+		s = HybridP384MLKEM1024
+	default:
+		return fmt.Sprintf("qage stanza of unknown version %q", args[0]), ""
+	}
+
+	parts := []string{"qage " + s.String()}
+	if args[0] == stanzaH1 {
+		parts = append(parts, "unauthenticated")
+	}
+	if len(args) > 1 {
+		if args[1] == stanzaCombinerTranscript {
+			parts = append(parts, CombinerTranscript.String()+" combiner")
+		} else {
+			parts = append(parts, fmt.Sprintf("unknown combiner %q", args[1]))
+		}
+	}
+	if len(args) > 2 {
+		parts = append(parts, "key hint "+args[2])
+	}
+	return strings.Join(parts, ", "), s.String()
+}
+
+// stanzaMatches reports whether id unwraps the stanza s of header.
+func stanzaMatches(header []byte, s *age.Stanza, id age.Identity) bool {
+	if s.Type == shareStanzaType {
+		qid, ok := id.(*Identity)
+		if !ok || len(s.Args) < 3 {
+			return false
+		}
+		inner := &age.Stanza{Type: stanzaType, Args: s.Args[2:], Body: s.Body}
+		_, err := qid.unwrapStanza(inner)
+		return err == nil
+	}
+
+	_, err := age.DecryptHeader(header, stanzaIdentity{id, s})
+	return err == nil
+}
+
+// stanzaIdentity restricts an identity to a single stanza of a file.
+type stanzaIdentity struct {
+	age.Identity
+	stanza *age.Stanza
+}
+
+func (i stanzaIdentity) Unwrap([]*age.Stanza) ([]byte, error) {
+	fileKey, err := i.Identity.Unwrap([]*age.Stanza{i.stanza})
+	if err != nil && !errors.Is(err, age.ErrIncorrectIdentity) {
+		// A malformed stanza doesn't match either
+		return nil, fmt.Errorf("%w: %v", age.ErrIncorrectIdentity, err)
+	}
+	return fileKey, err
+}
+
+// plaintextSize returns the plaintext size of a payload of the given size, or
+// -1 if it is truncated. Even an empty plaintext has one chunk.
+func plaintextSize(payloadSize int64) int64 {
+	const sealedChunkSize = payloadChunkSize + payloadTagSize
+	sealed := payloadSize - payloadNonceSize
+	if last := sealed % sealedChunkSize; sealed < payloadTagSize || (last != 0 && last < payloadTagSize) {
+		return -1
+	}
+	chunks := (sealed + sealedChunkSize - 1) / sealedChunkSize
+	return sealed - chunks*payloadTagSize
+}
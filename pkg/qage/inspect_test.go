@@ -0,0 +1,111 @@
+package qage
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestInspectFile(t *testing.T) {
+	a, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	b, err := NewIdentityWithConfig(Config{Suite: HybridP384MLKEM1024, Combiner: CombinerConcat})
+	if err != nil {
+		t.Fatalf("NewIdentityWithConfig failed: %v", err)
+	}
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewThresholdRecipient(2, a.Recipient(), b.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1000, 64 * 1024, 64*1024 + 1, 200000} {
+		var encrypted bytes.Buffer
+		w, err := age.Encrypt(&encrypted, a.Recipient().AllowClassical(), b.Recipient().AllowClassical(), x25519.Recipient())
+		if err != nil {
+			t.Fatalf("age.Encrypt failed: %v", err)
+		}
+		if _, err := w.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		fileSize := int64(encrypted.Len())
+
+		info, err := InspectFile(&encrypted, b, x25519, a)
+		if err != nil {
+			t.Fatalf("InspectFile failed: %v", err)
+		}
+		if info.PlaintextSize != int64(size) || info.HeaderSize+info.PayloadSize != fileSize {
+			t.Errorf("size %d: got plaintext %d, header %d, payload %d", size, info.PlaintextSize, info.HeaderSize, info.PayloadSize)
+		}
+		if !info.PostQuantum || !info.Classical || len(info.Stanzas) != 3 {
+			t.Fatalf("unexpected file info %+v", info)
+		}
+
+		want := []struct {
+			desc  string
+			match []int
+		}{
+			{"qage X25519+ML-KEM-768, transcript combiner", []int{2}},
+			{"qage P-384+ML-KEM-1024", []int{0}},
+			{"age X25519", []int{1}},
+		}
+		for i, s := range info.Stanzas {
+			if s.Description != want[i].desc || !slices.Equal(s.MatchedBy, want[i].match) {
+				t.Errorf("stanza %d: got %q matched by %v", i, s.Description, s.MatchedBy)
+			}
+		}
+	}
+
+	// Threshold files list their group and shares
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := InspectFile(&encrypted, b)
+	if err != nil {
+		t.Fatalf("InspectFile failed: %v", err)
+	}
+	if len(info.Stanzas) != 3 || !info.PostQuantum || info.Classical {
+		t.Fatalf("unexpected file info %+v", info)
+	}
+	if !strings.Contains(info.Stanzas[0].Description, "2 of 2 shares needed") {
+		t.Errorf("unexpected threshold description %q", info.Stanzas[0].Description)
+	}
+	if s := info.Stanzas[2]; !strings.HasPrefix(s.Description, "qage threshold share 2 of group") || s.Suite != "P-384+ML-KEM-1024" || !slices.Equal(s.MatchedBy, []int{0}) {
+		t.Errorf("unexpected share %+v", s)
+	}
+	if len(info.Stanzas[1].MatchedBy) != 0 {
+		t.Errorf("share of another identity matched: %v", info.Stanzas[1].MatchedBy)
+	}
+}
+
+func TestPlaintextSize(t *testing.T) {
+	for payload, want := range map[int64]int64{
+		0:                 -1,
+		16 + 15:           -1,
+		16 + 16:           0,
+		16 + 65552:        65536,
+		16 + 65552 + 10:   -1,
+		16 + 65552 + 17:   65537,
+		16 + 2*65552 + 16: 2 * 65536,
+	} {
+		if got := plaintextSize(payload); got != want {
+			t.Errorf("plaintextSize(%d) = %d, expected %d", payload, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package qage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"filippo.io/age"
+)
+
+const (
+	// keyHintSize is the size of the key hint carried by stanzas of
+	// recipients returned by WithKeyHint. Hints only need to tell apart the
+	// identities of one holder, and a collision merely costs a
+	// decapsulation.
+	keyHintSize = 4
+
+	// keyHintLabel domain-separates the key hint derivation.
+	keyHintLabel = "qage/key-hint/v1"
+)
+
+// WithKeyHint returns a copy of the recipient whose stanzas carry a key hint:
+// a short tag of the stanza keyed by the recipient's public keys, written as
+// a third argument after the combiner. Identities skip stanzas whose hint
+// isn't theirs without performing the ECDH and ML-KEM decapsulation, which
+// makes decryption cheap for holders of many identities, especially through
+// an IdentityIndex, and for files with many recipients.
+//
+// Stanzas are anonymous by default. The hint covers the ephemeral share of
+// the stanza, so it differs from file to file and only tells which files are
+// encrypted to the recipient to those who have it. Releases before key hints
+// reject such stanzas as malformed. Key hints require CombinerTranscript.
+func (r *Recipient) WithKeyHint() *Recipient {
+	c := *r
+	c.keyHint = true
+	return &c
+}
+
+// stanzaKeyHint returns the key hint of a stanza of the recipient with the
+// ephemeral share ephPub.
+func (r *Recipient) stanzaKeyHint(ephPub []byte) string {
+	fp := r.fingerprint()
+	return keyHint(fp[:], ephPub)
+}
+
+// keyHint computes a key hint as HMAC-SHA-256 keyed by the fingerprint of
+// the recipient, which covers its public keys, over the ephemeral share.
+func keyHint(fingerprint, ephPub []byte) string {
+	h := hmac.New(sha256.New, fingerprint)
+	h.Write([]byte(keyHintLabel))
+	h.Write(ephPub)
+	return base64.RawStdEncoding.EncodeToString(h.Sum(nil)[:keyHintSize])
+}
+
+// parseKeyHint returns the key hint of a qage stanza, if it has one. It
+// doesn't check that the hint is well-formed.
+func parseKeyHint(s *age.Stanza) (string, bool) {
+	if s.Type != stanzaType || len(s.Args) != 3 {
+		return "", false
+	}
+	return s.Args[2], true
+}
+
+// validKeyHint reports whether hint is the encoding of a key hint.
+func validKeyHint(hint string) bool {
+	b, err := base64.RawStdEncoding.Strict().DecodeString(hint)
+	return err == nil && len(b) == keyHintSize
+}
+
+// IdentityIndex is an age.Identity holding many qage identities. Stanzas
+// with a key hint are only unwrapped with the identities whose hint matches,
+// which costs an HMAC per identity instead of an ECDH and a decapsulation,
+// so that a service holding many identities doesn't fully try each of them
+// on every stanza of a file. Stanzas without one are tried with every
+// identity, like separate identities would be.
+type IdentityIndex struct {
+	entries []indexEntry
+}
+
+// indexEntry is an identity of an IdentityIndex with what is needed to check
+// key hints.
+type indexEntry struct {
+	id          *Identity
+	fingerprint [fingerprintSize]byte
+	pointSize   int // 0 if the suite is unavailable
+}
+
+// Ensure IdentityIndex implements age.Identity
+var _ age.Identity = (*IdentityIndex)(nil)
+
+// NewIdentityIndex returns an identity that unwraps with any of the given
+// identities.
+func NewIdentityIndex(identities ...*Identity) *IdentityIndex {
+	x := &IdentityIndex{entries: make([]indexEntry, 0, len(identities))}
+	for _, id := range identities {
+		e := indexEntry{id: id, fingerprint: id.Recipient().fingerprint()}
+		if p, err := id.suite.primitives(id.backend); err == nil {
+			e.pointSize = p.dh.PublicKeySize()
+		}
+		x.entries = append(x.entries, e)
+	}
+	return x
+}
+
+// candidate reports whether the stanza s may be addressed to the identity
+// of e. Stanzas it can't tell about are left to Identity.unwrapStanza.
+func (e *indexEntry) candidate(s *age.Stanza) bool {
+	hint, ok := parseKeyHint(s)
+	if !ok || !validKeyHint(hint) || e.pointSize == 0 || len(s.Body) < e.pointSize {
+		return true
+	}
+	return hint == keyHint(e.fingerprint[:], s.Body[:e.pointSize])
+}
+
+// Unwrap implements age.Identity.
+//
+// As with Identity.Unwrap, stanzas that are not addressed to any of the
+// identities are skipped, and a qage stanza that cannot be parsed results in
+// an error wrapping ErrMalformedStanza.
+func (x *IdentityIndex) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	for _, s := range stanzas {
+		for i := range x.entries {
+			e := &x.entries[i]
+			if !e.candidate(s) {
+				continue
+			}
+			fileKey, err := e.id.unwrapStanza(s)
+			if errors.Is(err, age.ErrIncorrectIdentity) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return fileKey, nil
+		}
+	}
+	return nil, age.ErrIncorrectIdentity
+}
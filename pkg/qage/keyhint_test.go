@@ -0,0 +1,153 @@
+package qage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestKeyHint(t *testing.T) {
+	alice, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	bob, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	fileKey := bytes.Repeat([]byte{7}, 16)
+
+	// Stanzas are anonymous unless asked
+	stanzas, err := alice.Recipient().Wrap(fileKey)
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	if len(stanzas[0].Args) != 2 {
+		t.Errorf("expected an anonymous stanza, got args %q", stanzas[0].Args)
+	}
+
+	r := alice.Recipient().WithKeyHint()
+	stanzas, err = r.Wrap(fileKey)
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	s := stanzas[0]
+	ephPub := s.Body[:32]
+	if len(s.Args) != 3 || s.Args[2] != alice.Recipient().stanzaKeyHint(ephPub) || len(s.Args[2]) != 6 {
+		t.Fatalf("expected a key hint, got args %q", s.Args)
+	}
+	if bob.Recipient().stanzaKeyHint(ephPub) == s.Args[2] {
+		t.Fatal("different recipients have the same key hint")
+	}
+	if got, err := alice.Unwrap(stanzas); err != nil || !bytes.Equal(got, fileKey) {
+		t.Fatalf("Unwrap failed: %v", err)
+	}
+
+	// The hint differs from stanza to stanza, so it doesn't link the files
+	// encrypted to the same recipient
+	again, err := r.Wrap(fileKey)
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	if again[0].Args[2] == s.Args[2] {
+		t.Error("two stanzas of the same recipient have the same key hint")
+	}
+
+	// Another identity skips the stanza on the hint alone, even if the rest
+	// of the body is malformed, while its owner reports the damage
+	truncated := &age.Stanza{Type: s.Type, Args: s.Args, Body: s.Body[:40]}
+	if _, err := bob.UnwrapStanza(truncated); !errors.Is(err, age.ErrIncorrectIdentity) {
+		t.Errorf("expected ErrIncorrectIdentity for another hint, got %v", err)
+	}
+	if _, err := alice.UnwrapStanza(truncated); !errors.Is(err, ErrMalformedStanza) {
+		t.Errorf("expected ErrMalformedStanza, got %v", err)
+	}
+
+	invalid := &age.Stanza{Type: s.Type, Args: []string{s.Args[0], s.Args[1], "not a hint"}, Body: s.Body}
+	if _, err := bob.UnwrapStanza(invalid); !errors.Is(err, ErrMalformedStanza) {
+		t.Errorf("expected ErrMalformedStanza for an invalid hint, got %v", err)
+	}
+
+	concat, err := ParseRecipientWithConfig(mustString(t, alice.Recipient()), Config{Combiner: CombinerConcat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := concat.WithKeyHint().Wrap(fileKey); err == nil {
+		t.Error("expected an error for a key hint with the concat combiner")
+	}
+}
+
+func TestIdentityIndex(t *testing.T) {
+	ids := make([]*Identity, 5)
+	for i := range ids {
+		id, err := NewIdentity()
+		if err != nil {
+			t.Fatalf("NewIdentity failed: %v", err)
+		}
+		ids[i] = id
+	}
+	stranger, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := func(recipients ...age.Recipient) []byte {
+		var buf bytes.Buffer
+		w, err := age.Encrypt(&buf, recipients...)
+		if err != nil {
+			t.Fatalf("age.Encrypt failed: %v", err)
+		}
+		if _, err := io.WriteString(w, "indexed"); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	index := NewIdentityIndex(ids...)
+	for name, file := range map[string][]byte{
+		"hinted":    encrypt(stranger.Recipient().WithKeyHint(), ids[3].Recipient().WithKeyHint()),
+		"anonymous": encrypt(stranger.Recipient(), ids[4].Recipient()),
+		"threshold": encrypt(mustThreshold(t, 2, ids[0].Recipient().WithKeyHint(), ids[1].Recipient().WithKeyHint(), stranger.Recipient())),
+	} {
+		var id age.Identity = index
+		if name == "threshold" {
+			id = NewThresholdIdentity(ids...)
+		}
+		r, err := age.Decrypt(bytes.NewReader(file), id)
+		if err != nil {
+			t.Fatalf("%s: Decrypt failed: %v", name, err)
+		}
+		if got, _ := io.ReadAll(r); string(got) != "indexed" {
+			t.Errorf("%s: decrypted data doesn't match original", name)
+		}
+	}
+
+	file := encrypt(stranger.Recipient().WithKeyHint())
+	if _, err := age.Decrypt(bytes.NewReader(file), index); !errors.Is(err, age.ErrIncorrectIdentity) {
+		t.Errorf("expected ErrIncorrectIdentity, got %v", err)
+	}
+}
+
+func mustString(t *testing.T, r *Recipient) string {
+	t.Helper()
+	s, err := r.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func mustThreshold(t *testing.T, threshold int, recipients ...*Recipient) *ThresholdRecipient {
+	t.Helper()
+	tr, err := NewThresholdRecipient(threshold, recipients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
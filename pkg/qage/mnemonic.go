@@ -0,0 +1,49 @@
+package qage
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"github.com/zlobste/qage/internal/bip39"
+)
+
+// mnemonicWords is the length of the recovery phrases used for identities,
+// which encode 256 bits of entropy.
+const mnemonicWords = 24
+
+// NewMnemonic returns a random 24-word BIP-39 recovery phrase, for use with
+// NewIdentityFromMnemonic.
+func NewMnemonic() (string, error) {
+	entropy := make([]byte, 32)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", fmt.Errorf("qage: failed to generate entropy: %w", err)
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// NewIdentityFromMnemonic returns the identity of the suite in cfg derived
+// from a 24-word BIP-39 recovery phrase and an optional passphrase. The phrase
+// is stretched into a LongSeedSize seed as specified by BIP-39, so the same
+// words, passphrase and suite always yield the same identity. The phrase
+// doesn't record the suite, which must be given again when restoring.
+//
+// Words are matched case-insensitively and the checksum is verified, so a
+// mistyped or misordered word is reported rather than silently yielding a
+// different identity. A wrong passphrase can't be detected.
+func NewIdentityFromMnemonic(mnemonic, passphrase string, cfg Config) (*Identity, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	if len(words) != mnemonicWords {
+		return nil, fmt.Errorf("qage: recovery phrase has %d words, expected %d", len(words), mnemonicWords)
+	}
+	mnemonic = strings.Join(words, " ")
+	if _, err := bip39.EntropyFromMnemonic(mnemonic); err != nil {
+		return nil, fmt.Errorf("qage: invalid recovery phrase: %w", err)
+	}
+
+	seed, err := bip39.Seed(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("qage: failed to derive seed: %w", err)
+	}
+	return NewIdentityFromSeed(seed, cfg)
+}
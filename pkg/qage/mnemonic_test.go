@@ -0,0 +1,80 @@
+package qage
+
+import (
+	"strings"
+	"testing"
+)
+
+// testMnemonic is the 256-bit all-zero BIP-39 test vector.
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art"
+
+func TestNewIdentityFromMnemonic(t *testing.T) {
+	// Pinned, so that a phrase written down today restores the same key
+	// with any later release.
+	tests := []struct {
+		suite       Suite
+		fingerprint string
+	}{
+		{HybridX25519MLKEM768, "qagefp:emumx3tate7pbnda5s73wb6w6q"},
+		{HybridP384MLKEM1024, "qagefp:xio6zuar4bo7g426lglixfis2m"},
+	}
+	for _, tt := range tests {
+		id, err := NewIdentityFromMnemonic(testMnemonic, "", Config{Suite: tt.suite})
+		if err != nil {
+			t.Fatalf("NewIdentityFromMnemonic failed: %v", err)
+		}
+		if got := id.Fingerprint(); got != tt.fingerprint {
+			t.Errorf("%s: fingerprint %s, want %s", tt.suite, got, tt.fingerprint)
+		}
+		if !id.Compact() || id.Suite() != tt.suite {
+			t.Errorf("%s: unexpected identity", tt.suite)
+		}
+	}
+
+	// Case and whitespace don't matter, the passphrase does
+	id, err := NewIdentityFromMnemonic("  "+strings.ToUpper(testMnemonic)+"\n", "", Config{})
+	if err != nil {
+		t.Fatalf("NewIdentityFromMnemonic failed: %v", err)
+	}
+	if id.Fingerprint() != tests[0].fingerprint {
+		t.Error("normalized phrase gave a different identity")
+	}
+	withPass, err := NewIdentityFromMnemonic(testMnemonic, "correct horse", Config{})
+	if err != nil {
+		t.Fatalf("NewIdentityFromMnemonic failed: %v", err)
+	}
+	if withPass.Fingerprint() == id.Fingerprint() {
+		t.Error("passphrase didn't change the identity")
+	}
+
+	// Generated phrases restore to the same identity
+	m, err := NewMnemonic()
+	if err != nil {
+		t.Fatalf("NewMnemonic failed: %v", err)
+	}
+	a, err := NewIdentityFromMnemonic(m, "x", Config{})
+	if err != nil {
+		t.Fatalf("NewIdentityFromMnemonic failed: %v", err)
+	}
+	b, err := NewIdentityFromMnemonic(m, "x", Config{})
+	if err != nil {
+		t.Fatalf("NewIdentityFromMnemonic failed: %v", err)
+	}
+	sa, _ := a.String()
+	sb, _ := b.String()
+	if sa != sb || len(strings.Fields(m)) != 24 {
+		t.Error("generated phrase didn't restore deterministically")
+	}
+
+	words := strings.Fields(testMnemonic)
+	words[22], words[23] = words[23], words[22]
+	for _, bad := range []string{
+		strings.Join(words, " "),
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		strings.Replace(testMnemonic, "art", "arts", 1),
+	} {
+		if _, err := NewIdentityFromMnemonic(bad, "", Config{}); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
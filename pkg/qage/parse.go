@@ -0,0 +1,132 @@
+package qage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+
+	"github.com/zlobste/qage/pkg/encoding"
+)
+
+// IdentityFileSizeLimit bounds how much of an identity file ParseIdentities
+// reads. Callers that read identity files themselves should apply it too.
+const IdentityFileSizeLimit = 1 << 24 // 16 MiB
+
+// recipientFileSizeLimit bounds how much of a recipients file is read.
+const recipientFileSizeLimit = 1 << 24 // 16 MiB
+
+// ParseIdentities parses an identity file with one or more identities, one per
+// line. Empty lines and lines starting with "#" are ignored.
+//
+// Lines can hold qage identities, in the QAGE-SECRET-KEY-1 file format, as
+// bare bech32 or in the age plugin encoding (AGE-PLUGIN-QAGE-1...), and
+// native age X25519 and hybrid identities (AGE-SECRET-KEY-1... and
+// AGE-SECRET-KEY-PQ-1...), so that one file can hold every key.
+// The returned values are of type *Identity, *age.X25519Identity or
+// *age.HybridIdentity.
+func ParseIdentities(r io.Reader) ([]age.Identity, error) {
+	var ids []age.Identity
+	scanner := bufio.NewScanner(io.LimitReader(r, IdentityFileSizeLimit))
+	var n int
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !utf8.ValidString(line) {
+			return nil, errors.New("qage: identity file is not valid UTF-8")
+		}
+
+		id, err := parseIdentityLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("qage: error at line %d: %w", n, err)
+		}
+		ids = append(ids, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("qage: failed to read identity file: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("qage: no identities found")
+	}
+
+	return ids, nil
+}
+
+func parseIdentityLine(line string) (age.Identity, error) {
+	switch {
+	case strings.HasPrefix(line, encoding.IdentityFilePrefix), strings.HasPrefix(line, encoding.PluginIdentityPrefix):
+		id, _, err := ParseIdentityFile(line)
+		return id, err
+	case strings.HasPrefix(line, encoding.HRPSecret+"1"):
+		return ParseIdentity(line)
+	case strings.HasPrefix(line, "AGE-SECRET-KEY-PQ-1"):
+		return age.ParseHybridIdentity(line)
+	case strings.HasPrefix(line, "AGE-SECRET-KEY-1"):
+		return age.ParseX25519Identity(line)
+	default:
+		return nil, errors.New("unknown identity type")
+	}
+}
+
+// ParseRecipients parses a recipients file with one or more recipients, one
+// per line. Empty lines and lines starting with "#" are ignored.
+//
+// Lines can hold any recipient accepted by ParseRecipientLine, so that one
+// file can list every recipient of an environment.
+func ParseRecipients(r io.Reader) ([]age.Recipient, error) {
+	var recs []age.Recipient
+	scanner := bufio.NewScanner(io.LimitReader(r, recipientFileSizeLimit))
+	var n int
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !utf8.ValidString(line) {
+			return nil, errors.New("qage: recipients file is not valid UTF-8")
+		}
+
+		rec, err := ParseRecipientLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("qage: error at line %d: %w", n, err)
+		}
+		recs = append(recs, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("qage: failed to read recipients file: %w", err)
+	}
+	if len(recs) == 0 {
+		return nil, errors.New("qage: no recipients found")
+	}
+
+	return recs, nil
+}
+
+// ParseRecipientLine parses a single recipient of any type: a qage recipient
+// (qage1... or age1qage1...), a native age hybrid or X25519 recipient
+// (age1pq1... or age1...) or an SSH public key (ssh-ed25519 or ssh-rsa). The
+// returned value is of type *Recipient or the corresponding age and agessh
+// type.
+func ParseRecipientLine(line string) (age.Recipient, error) {
+	switch {
+	case strings.HasPrefix(line, encoding.HRPPublic+"1"), strings.HasPrefix(line, encoding.HRPPluginRecipient+"1"):
+		return ParseRecipient(line)
+	case strings.HasPrefix(line, "age1pq1"):
+		return age.ParseHybridRecipient(line)
+	case strings.HasPrefix(line, "age1"):
+		return age.ParseX25519Recipient(line)
+	case strings.HasPrefix(line, "ssh-"):
+		return agessh.ParseRecipient(line)
+	default:
+		return nil, errors.New("unknown recipient type")
+	}
+}
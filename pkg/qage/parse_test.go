@@ -0,0 +1,228 @@
+package qage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zlobste/qage/pkg/encoding"
+)
+
+func TestParseIdentities(t *testing.T) {
+	id1, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	id2, err := NewIdentityWithConfig(Config{Suite: HybridP384MLKEM1024})
+	if err != nil {
+		t.Fatalf("NewIdentityWithConfig failed: %v", err)
+	}
+	native, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity failed: %v", err)
+	}
+
+	line1, err := id1.FormatFile("2024")
+	if err != nil {
+		t.Fatalf("FormatFile failed: %v", err)
+	}
+	line2, err := id2.PluginString()
+	if err != nil {
+		t.Fatalf("PluginString failed: %v", err)
+	}
+	line3, err := id1.String()
+	if err != nil {
+		t.Fatalf("String failed: %v", err)
+	}
+
+	file := strings.Join([]string{
+		"# keys",
+		line1,
+		"",
+		line2,
+		native.String(),
+		"  " + line3 + "  ",
+	}, "\n")
+
+	ids, err := ParseIdentities(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("ParseIdentities failed: %v", err)
+	}
+	if len(ids) != 4 {
+		t.Fatalf("expected 4 identities, got %d", len(ids))
+	}
+
+	if got, ok := ids[0].(*Identity); !ok || got.Comment() != "2024" || got.Suite() != HybridX25519MLKEM768 {
+		t.Errorf("unexpected first identity %#v", ids[0])
+	}
+	if got, ok := ids[1].(*Identity); !ok || got.Suite() != HybridP384MLKEM1024 {
+		t.Errorf("unexpected second identity %#v", ids[1])
+	}
+	if got, ok := ids[2].(*age.X25519Identity); !ok || got.String() != native.String() {
+		t.Errorf("unexpected third identity %#v", ids[2])
+	}
+	if _, ok := ids[3].(*Identity); !ok {
+		t.Errorf("unexpected fourth identity %#v", ids[3])
+	}
+}
+
+func TestParseIdentitiesErrors(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	line, err := id.FormatFile("")
+	if err != nil {
+		t.Fatalf("FormatFile failed: %v", err)
+	}
+	// Flip the last checksum character
+	last := "x"
+	if strings.HasSuffix(line, last) {
+		last = "y"
+	}
+	corrupted := line[:len(line)-1] + last
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", "no identities found"},
+		{"only comments", "# nothing\n\n", "no identities found"},
+		{"unknown type", line + "\n# comment\nssh-ed25519 AAAA\n", "line 3: unknown identity type"},
+		{"corrupted key", "\n" + corrupted + "\n", "line 2:"},
+		{"bad native key", "AGE-SECRET-KEY-1XYZ\n", "line 1:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseIdentities(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseRecipients(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	qageRec, err := id.Recipient().String()
+	if err != nil {
+		t.Fatalf("String failed: %v", err)
+	}
+	pluginRec, err := id.Recipient().PluginString()
+	if err != nil {
+		t.Fatalf("PluginString failed: %v", err)
+	}
+	native, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity failed: %v", err)
+	}
+	sshPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey failed: %v", err)
+	}
+	sshKey, err := ssh.NewPublicKey(sshPub)
+	if err != nil {
+		t.Fatalf("ssh.NewPublicKey failed: %v", err)
+	}
+	sshRec := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshKey))) + " ci@example"
+
+	file := strings.Join([]string{
+		"# production",
+		native.Recipient().String(),
+		"",
+		qageRec,
+		"  # deploy key",
+		sshRec,
+		pluginRec,
+	}, "\n")
+
+	recs, err := ParseRecipients(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("ParseRecipients failed: %v", err)
+	}
+	if len(recs) != 4 {
+		t.Fatalf("expected 4 recipients, got %d", len(recs))
+	}
+	if _, ok := recs[0].(*age.X25519Recipient); !ok {
+		t.Errorf("expected an age X25519 recipient, got %T", recs[0])
+	}
+	if _, ok := recs[1].(*Recipient); !ok {
+		t.Errorf("expected a qage recipient, got %T", recs[1])
+	}
+	if _, ok := recs[3].(*Recipient); !ok {
+		t.Errorf("expected a qage recipient, got %T", recs[3])
+	}
+
+	// The parsed recipients encrypt to the matching identities
+	fileKey := make([]byte, 16)
+	stanzas, err := recs[3].Wrap(fileKey)
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	if _, err := id.Unwrap(stanzas); err != nil {
+		t.Errorf("Unwrap failed: %v", err)
+	}
+
+	// Flip the last checksum character
+	last := "q"
+	if strings.HasSuffix(qageRec, last) {
+		last = "p"
+	}
+	badRec := qageRec[:len(qageRec)-1] + last
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "\n# nothing\n", "no recipients found"},
+		{"unknown type", qageRec + "\n\nnot-a-recipient\n", "line 3: unknown recipient type"},
+		{"bad qage", "# x\n" + badRec + "\n", "line 2:"},
+		{"bad ssh", "ssh-ed25519 AAAA\n", "line 1:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRecipients(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseRecipientInvalidKeys(t *testing.T) {
+	id, err := NewIdentityWithConfig(Config{Suite: HybridP384MLKEM1024})
+	if err != nil {
+		t.Fatalf("NewIdentityWithConfig failed: %v", err)
+	}
+	r := id.Recipient()
+
+	// A point that isn't on the curve, and a coefficient of the ML-KEM key
+	// that isn't reduced modulo q
+	badPoint := bytes.Clone(r.ecPub)
+	badPoint[len(badPoint)-1] ^= 1
+	badKey := bytes.Clone(r.mlkemPub)
+	badKey[0], badKey[1] = 0xff, badKey[1]|0x0f
+
+	for name, rec := range map[string]*encoding.Recipient{
+		"P-384 public key":              {Suite: encoding.HybridP384MLKEM1024, P384Pub: badPoint, MLKEMPub: r.mlkemPub},
+		"ML-KEM-1024 encapsulation key": {Suite: encoding.HybridP384MLKEM1024, P384Pub: r.ecPub, MLKEMPub: badKey},
+	} {
+		s, err := encoding.EncodeRecipient(rec)
+		if err != nil {
+			t.Fatalf("%s: EncodeRecipient failed: %v", name, err)
+		}
+		if _, err := ParseRecipient(s); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: expected an invalid key error, got %v", name, err)
+		}
+	}
+}
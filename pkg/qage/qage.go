@@ -1,7 +1,7 @@
 // Package qage provides post-quantum hybrid encryption for age.
 //
 // This package implements a post-quantum secure key encapsulation mechanism (KEM)
-// using a hybrid approach combining X25519 ECDH and ML-KEM-768. It provides
+// using a hybrid approach combining X25519 ECDH and FIPS 203 ML-KEM-768. It provides
 // drop-in recipients and identities compatible with filippo.io/age.
 //
 // # Basic Usage
@@ -34,10 +34,20 @@
 //   - ML-KEM-768 (post-quantum security)
 //
 // Both components must be broken to compromise the encryption.
+//
+// The HybridP384MLKEM1024 suite pairs P-384 ECDH with ML-KEM-1024 for data
+// that needs category 5 security.
+//
+// Identities generated by earlier releases use the pre-standard Kyber768
+// (HybridX25519Kyber768). They can still decrypt, but new files are only
+// encrypted to FIPS 203 ML-KEM recipients.
 package qage
 
 import (
+	"crypto/rand"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/zlobste/qage/pkg/crypto"
 	"github.com/zlobste/qage/pkg/encoding"
@@ -47,28 +57,141 @@ import (
 type Suite uint8
 
 const (
-	// HybridX25519MLKEM768 combines X25519 ECDH with ML-KEM-768.
-	HybridX25519MLKEM768 Suite = 1
+	// HybridX25519Kyber768 combines X25519 ECDH with the pre-standard
+	// round-3 Kyber768. It is decrypt-only and kept for files written by
+	// earlier releases.
+	HybridX25519Kyber768 Suite = 1
+
+	// HybridX25519MLKEM768 combines X25519 ECDH with FIPS 203 ML-KEM-768.
+	HybridX25519MLKEM768 Suite = 2
+
+	// HybridP384MLKEM1024 combines P-384 ECDH with FIPS 203 ML-KEM-1024 for
+	// category 5 security, e.g. for long-term archives.
+	HybridP384MLKEM1024 Suite = 3
 )
 
 // String returns the string representation of the suite.
 func (s Suite) String() string {
 	switch s {
+	case HybridX25519Kyber768:
+		return "X25519+Kyber768 (legacy)"
 	case HybridX25519MLKEM768:
 		return "X25519+ML-KEM-768"
+	case HybridP384MLKEM1024:
+		return "P-384+ML-KEM-1024"
 	default:
 		return fmt.Sprintf("Suite(%d)", s)
 	}
 }
 
+// ParseSuite parses a suite name as accepted by the CLI, such as
+// "x25519-mlkem768" or "p384-mlkem1024". Decrypt-only suites are rejected.
+func ParseSuite(name string) (Suite, error) {
+	switch strings.ToLower(name) {
+	case stanzaX25519MLKEM768:
+		return HybridX25519MLKEM768, nil
+	case stanzaP384MLKEM1024:
+		return HybridP384MLKEM1024, nil
+	default:
+		return 0, fmt.Errorf("qage: unknown suite %q (supported: %s, %s)", name, stanzaX25519MLKEM768, stanzaP384MLKEM1024)
+	}
+}
+
+// Combiner identifies how the X25519 and ML-KEM shared secrets are combined
+// into the key that wraps the file key.
+type Combiner uint8
+
+const (
+	// CombinerConcat derives the wrap key from the concatenated shared secrets
+	// alone. It is kept for compatibility with earlier releases.
+	CombinerConcat Combiner = 1
+
+	// CombinerTranscript additionally binds the ephemeral X25519 share, the
+	// ML-KEM ciphertext and the recipient's public keys into the derivation.
+	CombinerTranscript Combiner = 2
+)
+
+// String returns the string representation of the combiner.
+func (c Combiner) String() string {
+	switch c {
+	case CombinerConcat:
+		return "concat"
+	case CombinerTranscript:
+		return "transcript"
+	default:
+		return fmt.Sprintf("Combiner(%d)", c)
+	}
+}
+
 // Config specifies the cryptographic configuration.
 type Config struct {
-	Suite Suite
+	Suite    Suite
+	Combiner Combiner
+
+	// Backend implements the primitives of the suite. It defaults to
+	// crypto.DefaultBackend, which only uses the standard library in FIPS
+	// 140-3 mode.
+	Backend crypto.Backend
+
+	// Rand is the source of randomness of new identities and of the
+	// stanzas wrapped by their recipients, and of recipients parsed with
+	// the configuration. It defaults to crypto/rand.Reader, and only exists
+	// for tests and test vectors: a predictable Rand makes keys and file
+	// keys predictable. The stdlib backend can't wrap with it.
+	Rand io.Reader
 }
 
-// DefaultConfig returns the default configuration using hybrid X25519+ML-KEM-768.
+// DefaultConfig returns the default configuration using hybrid X25519+ML-KEM-768
+// with the transcript-binding combiner. In FIPS 140-3 mode, where X25519 is
+// not approved, the default suite is HybridP384MLKEM1024.
 func DefaultConfig() Config {
-	return Config{Suite: HybridX25519MLKEM768}
+	cfg := Config{Suite: HybridX25519MLKEM768, Combiner: CombinerTranscript, Backend: crypto.DefaultBackend()}
+	if crypto.FIPSMode() {
+		cfg.Suite = HybridP384MLKEM1024
+	}
+	return cfg
+}
+
+// withDefaults fills in unset fields from DefaultConfig and validates the rest.
+func (cfg Config) withDefaults() (Config, error) {
+	def := DefaultConfig()
+	if cfg.Suite == 0 {
+		cfg.Suite = def.Suite
+	}
+	if cfg.Combiner == 0 {
+		cfg.Combiner = def.Combiner
+	}
+	if cfg.Backend == nil {
+		cfg.Backend = def.Backend
+	}
+
+	switch cfg.Combiner {
+	case CombinerConcat, CombinerTranscript:
+	default:
+		return cfg, fmt.Errorf("qage: unsupported combiner %d", cfg.Combiner)
+	}
+
+	// Refuse suites the backend can't provide, such as X25519 suites in
+	// FIPS 140-3 mode.
+	if _, err := cfg.Suite.primitives(cfg.Backend); err != nil {
+		return cfg, err
+	}
+
+	// Refuse backends that fail their known-answer tests, which run the
+	// first time a backend is used.
+	if err := crypto.PowerOnSelfTest(cfg.Backend); err != nil {
+		return cfg, fmt.Errorf("qage: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// randReader returns r, or crypto/rand.Reader if it is nil.
+func randReader(r io.Reader) io.Reader {
+	if r == nil {
+		return rand.Reader
+	}
+	return r
 }
 
 // NewIdentity generates a new identity with the default configuration.
@@ -76,74 +199,124 @@ func NewIdentity() (*Identity, error) {
 	return NewIdentityWithConfig(DefaultConfig())
 }
 
-// NewIdentityWithConfig generates a new identity with the specified configuration.
+// NewIdentityWithConfig generates a new identity with the specified
+// configuration. The identity is expanded from a random seed and encodes in
+// the compact form.
 func NewIdentityWithConfig(cfg Config) (*Identity, error) {
-	if cfg.Suite == 0 {
-		cfg = DefaultConfig()
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
 	}
 
 	switch cfg.Suite {
-	case HybridX25519MLKEM768:
-		return newHybridX25519MLKEM768Identity()
+	case HybridX25519MLKEM768, HybridP384MLKEM1024:
+		return newSeededIdentity(cfg)
+	case HybridX25519Kyber768:
+		return nil, fmt.Errorf("qage: suite %s is decrypt-only", cfg.Suite)
 	default:
 		return nil, fmt.Errorf("qage: unsupported suite %d", cfg.Suite)
 	}
 }
 
-func newHybridX25519MLKEM768Identity() (*Identity, error) {
-	// Generate X25519 keypair
-	x25519Priv, x25519Pub, err := crypto.GenerateX25519()
+// ParseRecipient parses a recipient string in either the native (qage1...) or
+// the age plugin (age1qage1...) encoding.
+func ParseRecipient(recipientStr string) (*Recipient, error) {
+	return ParseRecipientWithConfig(recipientStr, Config{})
+}
+
+// ParseRecipientWithConfig parses a recipient string and applies the combiner
+// from cfg to the stanzas it wraps. If cfg.Suite is set, it must match the
+// suite of the recipient.
+func ParseRecipientWithConfig(recipientStr string, cfg Config) (*Recipient, error) {
+	encRec, err := encoding.ParseRecipient(recipientStr)
 	if err != nil {
-		return nil, fmt.Errorf("qage: failed to generate X25519 key: %w", err)
+		return nil, err
 	}
 
-	// Generate ML-KEM-768 keypair
-	mlkemPub, mlkemPriv, err := crypto.GenerateMLKEM768()
+	return newRecipientFromEncoding(encRec, cfg)
+}
+
+// ParseRecipientData parses the raw payload of a recipient encoding, as
+// passed by the age plugin protocol.
+func ParseRecipientData(data []byte) (*Recipient, error) {
+	encRec, err := encoding.ParseRecipientData(data)
 	if err != nil {
-		return nil, fmt.Errorf("qage: failed to generate ML-KEM key: %w", err)
+		return nil, err
 	}
 
-	id := &Identity{
-		suite:        HybridX25519MLKEM768,
-		x25519Secret: x25519Priv,
-		mlkemSecret:  mlkemPriv,
-	}
+	return newRecipientFromEncoding(encRec, Config{})
+}
 
-	id.cachedRecipient = &Recipient{
-		suite:     HybridX25519MLKEM768,
-		x25519Pub: x25519Pub,
-		mlkemPub:  mlkemPub,
+func newRecipientFromEncoding(encRec *encoding.Recipient, cfg Config) (*Recipient, error) {
+	suite := Suite(encRec.Suite)
+	if cfg.Suite != 0 && cfg.Suite != suite {
+		return nil, fmt.Errorf("qage: recipient suite %s does not match configured suite %s", suite, cfg.Suite)
+	}
+	cfg.Suite = suite
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
 	}
 
-	return id, nil
-}
+	r := &Recipient{
+		suite:    suite,
+		combiner: cfg.Combiner,
+		backend:  cfg.Backend,
+		rand:     cfg.Rand,
+		mlkemPub: encRec.MLKEMPub,
+	}
+	if suite == HybridP384MLKEM1024 {
+		r.ecPub = encRec.P384Pub
+	} else {
+		r.ecPub = append([]byte(nil), encRec.X25519Pub[:]...)
+	}
 
-// ParseRecipient parses a recipient string.
-func ParseRecipient(recipientStr string) (*Recipient, error) {
-	encRec, err := encoding.ParseRecipient(recipientStr)
+	// Reject invalid keys now rather than in Wrap, in the middle of
+	// age.Encrypt.
+	p, err := suite.primitives(cfg.Backend)
 	if err != nil {
 		return nil, err
 	}
+	if err := p.dh.CheckPublicKey(r.ecPub); err != nil {
+		return nil, fmt.Errorf("qage: invalid %s recipient: %s public key: %w", suite, p.dhID, err)
+	}
+	if err := p.kem.CheckPublicKey(r.mlkemPub); err != nil {
+		return nil, fmt.Errorf("qage: invalid %s recipient: %s encapsulation key: %w", suite, p.kemID, err)
+	}
 
-	return &Recipient{
-		suite:     Suite(encRec.Suite),
-		x25519Pub: encRec.X25519Pub,
-		mlkemPub:  encRec.MLKEMPub,
-	}, nil
+	return r, nil
 }
 
-// ParseIdentity parses an identity from its bech32 representation.
+// ParseIdentity parses an identity from its bech32 representation, in either
+// the native (qagseck1...) or the age plugin (AGE-PLUGIN-QAGE-1...) encoding.
 func ParseIdentity(identityStr string) (*Identity, error) {
+	return ParseIdentityWithConfig(identityStr, Config{})
+}
+
+// ParseIdentityWithConfig parses an identity string and uses the backend and
+// combiner from cfg. If cfg.Suite is set, it must match the suite of the
+// identity.
+func ParseIdentityWithConfig(identityStr string, cfg Config) (*Identity, error) {
 	encId, err := encoding.ParseIdentity(identityStr)
 	if err != nil {
 		return nil, err
 	}
+	if suite := Suite(encId.Suite); cfg.Suite != 0 && cfg.Suite != suite {
+		return nil, fmt.Errorf("qage: identity suite %s does not match configured suite %s", suite, cfg.Suite)
+	}
 
-	return &Identity{
-		suite:        Suite(encId.Suite),
-		x25519Secret: encId.X25519Secret,
-		mlkemSecret:  encId.MLKEMSecret,
-	}, nil
+	return newIdentityFromEncoding(encId, cfg)
+}
+
+// ParseIdentityData parses the raw payload of an identity encoding, as passed
+// by the age plugin protocol.
+func ParseIdentityData(data []byte) (*Identity, error) {
+	encId, err := encoding.ParseIdentityData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return newIdentityFromEncoding(encId, Config{})
 }
 
 // ParseIdentityFile parses an identity from a file line.
@@ -153,11 +326,11 @@ func ParseIdentityFile(line string) (*Identity, string, error) {
 		return nil, "", err
 	}
 
-	id := &Identity{
-		suite:        Suite(encId.Suite),
-		x25519Secret: encId.X25519Secret,
-		mlkemSecret:  encId.MLKEMSecret,
+	id, err := newIdentityFromEncoding(encId, Config{})
+	if err != nil {
+		return nil, "", err
 	}
+	id.comment = comment
 
 	return id, comment, nil
 }
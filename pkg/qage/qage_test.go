@@ -2,12 +2,18 @@ package qage
 
 import (
 	"bytes"
+	"crypto/ecdh"
 	"crypto/rand"
+	"errors"
 	"io"
 	"strings"
 	"testing"
 
 	"filippo.io/age"
+	"filippo.io/age/plugin"
+	kyber768 "github.com/cloudflare/circl/kem/kyber/kyber768"
+
+	"github.com/zlobste/qage/pkg/crypto"
 )
 
 func TestNewIdentity(t *testing.T) {
@@ -88,8 +94,8 @@ func TestIdentityStringEncoding(t *testing.T) {
 		t.Errorf("suite mismatch after parsing")
 	}
 
-	if parsed.x25519Secret != id.x25519Secret {
-		t.Errorf("X25519 secret mismatch after parsing")
+	if !bytes.Equal(parsed.ecSecret, id.ecSecret) {
+		t.Errorf("ECDH secret mismatch after parsing")
 	}
 
 	if !bytes.Equal(parsed.mlkemSecret, id.mlkemSecret) {
@@ -167,8 +173,8 @@ func TestRecipientStringEncoding(t *testing.T) {
 		t.Errorf("suite mismatch after parsing")
 	}
 
-	if parsed.x25519Pub != r.x25519Pub {
-		t.Errorf("X25519 public mismatch after parsing")
+	if !bytes.Equal(parsed.ecPub, r.ecPub) {
+		t.Errorf("ECDH public mismatch after parsing")
 	}
 
 	if !bytes.Equal(parsed.mlkemPub, r.mlkemPub) {
@@ -223,6 +229,59 @@ func TestAgeIntegration(t *testing.T) {
 	}
 }
 
+func TestPostQuantumLabel(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	other, err := NewIdentityWithConfig(Config{Suite: HybridP384MLKEM1024})
+	if err != nil {
+		t.Fatalf("NewIdentityWithConfig failed: %v", err)
+	}
+	classical, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, labels, err := id.Recipient().WrapWithLabels(make([]byte, 16))
+	if err != nil {
+		t.Fatalf("WrapWithLabels failed: %v", err)
+	}
+	if len(labels) != 1 || labels[0] != "postquantum" {
+		t.Errorf("labels = %q, want [postquantum]", labels)
+	}
+
+	// qage recipients mix with each other but not with classical ones
+	if _, err := age.Encrypt(io.Discard, id.Recipient(), other.Recipient()); err != nil {
+		t.Errorf("encrypting to two qage recipients failed: %v", err)
+	}
+	if _, err := age.Encrypt(io.Discard, id.Recipient(), classical.Recipient()); err == nil {
+		t.Error("expected mixing with an X25519 recipient to fail")
+	}
+
+	// Unless explicitly allowed
+	r := id.Recipient().AllowClassical()
+	if r == id.Recipient() {
+		t.Error("AllowClassical modified the recipient in place")
+	}
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, r, classical.Recipient())
+	if err != nil {
+		t.Fatalf("age.Encrypt with AllowClassical failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []age.Identity{id, classical} {
+		if _, err := age.Decrypt(bytes.NewReader(encrypted.Bytes()), i); err != nil {
+			t.Errorf("age.Decrypt failed: %v", err)
+		}
+	}
+	if _, labels, _ := id.Recipient().WrapWithLabels(make([]byte, 16)); len(labels) != 1 {
+		t.Error("AllowClassical changed the labels of the original recipient")
+	}
+}
+
 func TestWrapUnwrap(t *testing.T) {
 	// Generate identity and recipient
 	id, err := NewIdentity()
@@ -253,8 +312,8 @@ func TestWrapUnwrap(t *testing.T) {
 		t.Errorf("expected stanza type 'qage', got '%s'", stanza.Type)
 	}
 
-	if len(stanza.Args) != 1 || stanza.Args[0] != "h1" {
-		t.Errorf("expected args ['h1'], got %v", stanza.Args)
+	if len(stanza.Args) != 2 || stanza.Args[0] != "x25519-mlkem768" || stanza.Args[1] != "c2" {
+		t.Errorf("expected args ['x25519-mlkem768' 'c2'], got %v", stanza.Args)
 	}
 
 	// Test unwrap
@@ -298,6 +357,94 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.Suite != HybridX25519MLKEM768 {
 		t.Errorf("expected default suite %v, got %v", HybridX25519MLKEM768, cfg.Suite)
 	}
+	if cfg.Combiner != CombinerTranscript {
+		t.Errorf("expected default combiner %v, got %v", CombinerTranscript, cfg.Combiner)
+	}
+}
+
+func TestCombiners(t *testing.T) {
+	tests := []struct {
+		combiner Combiner
+		args     []string
+	}{
+		{CombinerConcat, []string{"x25519-mlkem768"}},
+		{CombinerTranscript, []string{"x25519-mlkem768", "c2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.combiner.String(), func(t *testing.T) {
+			id, err := NewIdentityWithConfig(Config{Combiner: tt.combiner})
+			if err != nil {
+				t.Fatalf("NewIdentityWithConfig failed: %v", err)
+			}
+
+			fileKey := make([]byte, 16)
+			if _, err := rand.Read(fileKey); err != nil {
+				t.Fatalf("failed to generate file key: %v", err)
+			}
+
+			stanzas, err := id.Recipient().Wrap(fileKey)
+			if err != nil {
+				t.Fatalf("Wrap failed: %v", err)
+			}
+			if strings.Join(stanzas[0].Args, " ") != strings.Join(tt.args, " ") {
+				t.Errorf("expected args %v, got %v", tt.args, stanzas[0].Args)
+			}
+
+			// Parsed identities derive their public keys for the transcript
+			idStr, err := id.String()
+			if err != nil {
+				t.Fatalf("String() failed: %v", err)
+			}
+			parsed, err := ParseIdentity(idStr)
+			if err != nil {
+				t.Fatalf("ParseIdentity failed: %v", err)
+			}
+
+			unwrapped, err := parsed.Unwrap(stanzas)
+			if err != nil {
+				t.Fatalf("Unwrap failed: %v", err)
+			}
+			if !bytes.Equal(fileKey, unwrapped) {
+				t.Errorf("unwrapped key doesn't match original")
+			}
+		})
+	}
+
+	if _, err := NewIdentityWithConfig(Config{Combiner: Combiner(99)}); err == nil {
+		t.Error("expected error for unsupported combiner")
+	}
+}
+
+func TestParseRecipientWithConfig(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	rStr, err := id.Recipient().String()
+	if err != nil {
+		t.Fatalf("Recipient String() failed: %v", err)
+	}
+
+	r, err := ParseRecipientWithConfig(rStr, Config{Combiner: CombinerConcat})
+	if err != nil {
+		t.Fatalf("ParseRecipientWithConfig failed: %v", err)
+	}
+	if r.Combiner() != CombinerConcat {
+		t.Errorf("expected combiner %v, got %v", CombinerConcat, r.Combiner())
+	}
+
+	parsed, err := ParseRecipient(rStr)
+	if err != nil {
+		t.Fatalf("ParseRecipient failed: %v", err)
+	}
+	if parsed.Combiner() != CombinerTranscript {
+		t.Errorf("expected default combiner %v, got %v", CombinerTranscript, parsed.Combiner())
+	}
+
+	if _, err := ParseRecipientWithConfig(rStr, Config{Suite: Suite(99)}); err == nil {
+		t.Error("expected error for mismatched suite")
+	}
 }
 
 func TestInvalidStanza(t *testing.T) {
@@ -369,20 +516,418 @@ func TestRecipientCaching(t *testing.T) {
 		t.Error("recipient should be cached and return same instance")
 	}
 
-	// Test fallback case where cachedRecipient is nil
+	// Without a cached recipient, it is derived from the secret keys
 	id.cachedRecipient = nil
 	r4 := id.Recipient()
-	
-	// Should return a zero recipient
+
 	if r4.suite != id.suite {
-		t.Error("fallback recipient should have same suite")
+		t.Error("derived recipient should have same suite")
 	}
-	
-	if r4.x25519Pub != [32]byte{} {
-		t.Error("fallback recipient should have zero X25519 public key")
+
+	if !bytes.Equal(r4.ecPub, r1.ecPub) {
+		t.Error("derived recipient should have the same ECDH public key")
 	}
-	
-	if r4.mlkemPub != nil {
-		t.Error("fallback recipient should have nil ML-KEM public key")
+
+	if !bytes.Equal(r4.mlkemPub, r1.mlkemPub) {
+		t.Error("derived recipient should have the same ML-KEM public key")
+	}
+
+	if id.Recipient() != r4 {
+		t.Error("derived recipient should be cached")
+	}
+}
+
+// newLegacyIdentity generates an X25519+Kyber768 identity as created by
+// earlier releases.
+func newLegacyIdentity(t *testing.T) *Identity {
+	t.Helper()
+
+	curve := ecdh.X25519()
+	x25519Priv, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate X25519 key: %v", err)
+	}
+	pk, sk, err := kyber768.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Kyber768 key: %v", err)
+	}
+
+	id := &Identity{
+		suite:       HybridX25519Kyber768,
+		ecSecret:    x25519Priv.Bytes(),
+		mlkemSecret: make([]byte, kyber768.PrivateKeySize),
+	}
+	sk.Pack(id.mlkemSecret)
+
+	r := &Recipient{
+		suite:    HybridX25519Kyber768,
+		ecPub:    x25519Priv.PublicKey().Bytes(),
+		mlkemPub: make([]byte, kyber768.PublicKeySize),
+	}
+	pk.Pack(r.mlkemPub)
+	id.cachedRecipient = r
+
+	return id
+}
+
+// wrapLegacy produces an X25519+Kyber768 stanza as written by earlier
+// releases: an unauthenticated "h1" stanza or an authenticated "h2" one.
+func wrapLegacy(t *testing.T, r *Recipient, fileKey []byte, version string) *age.Stanza {
+	t.Helper()
+
+	curve := ecdh.X25519()
+	ephPriv, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ephemeral key: %v", err)
+	}
+	peerPub, err := curve.NewPublicKey(r.ecPub)
+	if err != nil {
+		t.Fatalf("invalid X25519 public key: %v", err)
+	}
+	z1, err := ephPriv.ECDH(peerPub)
+	if err != nil {
+		t.Fatalf("ECDH failed: %v", err)
+	}
+
+	var pk kyber768.PublicKey
+	pk.Unpack(r.mlkemPub)
+	ct := make([]byte, kyber768.CiphertextSize)
+	z2 := make([]byte, kyber768.SharedKeySize)
+	pk.EncapsulateTo(ct, z2, nil)
+
+	wrapKey, err := deriveWrapKey(crypto.Circl(), z1, z2)
+	if err != nil {
+		t.Fatalf("deriveWrapKey failed: %v", err)
+	}
+	body := append(ephPriv.PublicKey().Bytes(), ct...)
+	if version == "h1" {
+		for i := range fileKey {
+			body = append(body, fileKey[i]^wrapKey[i%len(wrapKey)])
+		}
+	} else {
+		sealed, err := aeadSeal(wrapKey, fileKey)
+		if err != nil {
+			t.Fatalf("aeadSeal failed: %v", err)
+		}
+		body = append(body, sealed...)
+	}
+
+	return &age.Stanza{Type: "qage", Args: []string{version}, Body: body}
+}
+
+func TestUnwrapLegacy(t *testing.T) {
+	id := newLegacyIdentity(t)
+
+	fileKey := make([]byte, 16)
+	if _, err := rand.Read(fileKey); err != nil {
+		t.Fatalf("failed to generate file key: %v", err)
+	}
+
+	for _, version := range []string{"h1", "h2"} {
+		unwrapped, err := id.Unwrap([]*age.Stanza{wrapLegacy(t, id.Recipient(), fileKey, version)})
+		if err != nil {
+			t.Fatalf("Unwrap of %s stanza failed: %v", version, err)
+		}
+
+		if !bytes.Equal(fileKey, unwrapped) {
+			t.Errorf("unwrapped %s key doesn't match original", version)
+		}
+	}
+
+	// Legacy identities round-trip through their encoding
+	idStr, err := id.String()
+	if err != nil {
+		t.Fatalf("String() failed: %v", err)
+	}
+	parsed, err := ParseIdentity(idStr)
+	if err != nil {
+		t.Fatalf("ParseIdentity failed: %v", err)
+	}
+	if parsed.Suite() != HybridX25519Kyber768 {
+		t.Errorf("expected suite %v, got %v", HybridX25519Kyber768, parsed.Suite())
+	}
+
+	// ML-KEM identities don't accept Kyber stanzas
+	mlkemID, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	_, err = mlkemID.Unwrap([]*age.Stanza{wrapLegacy(t, id.Recipient(), fileKey, "h2")})
+	if !errors.Is(err, age.ErrIncorrectIdentity) {
+		t.Errorf("expected ErrIncorrectIdentity, got %v", err)
+	}
+}
+
+func TestLegacySuiteDecryptOnly(t *testing.T) {
+	id := newLegacyIdentity(t)
+
+	if _, err := id.Recipient().Wrap(make([]byte, 16)); err == nil {
+		t.Error("expected error wrapping to a legacy recipient")
+	}
+
+	if _, err := NewIdentityWithConfig(Config{Suite: HybridX25519Kyber768}); err == nil {
+		t.Error("expected error generating a legacy identity")
+	}
+}
+
+func TestUnwrapWrongIdentity(t *testing.T) {
+	id1, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	id2, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+
+	stanzas, err := id1.Recipient().Wrap(make([]byte, 16))
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+
+	_, err = id2.Unwrap(stanzas)
+	if !errors.Is(err, age.ErrIncorrectIdentity) {
+		t.Errorf("expected ErrIncorrectIdentity, got %v", err)
+	}
+
+	// The matching stanza should be found after a foreign one
+	stanzas2, err := id2.Recipient().Wrap(make([]byte, 16))
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	if _, err := id2.Unwrap(append(stanzas, stanzas2...)); err != nil {
+		t.Errorf("Unwrap with multiple stanzas failed: %v", err)
+	}
+}
+
+func TestUnwrapCorruptedStanza(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+
+	stanzas, err := id.Recipient().Wrap(make([]byte, 16))
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	s := stanzas[0]
+
+	// Tampered ciphertext fails authentication
+	tampered := &age.Stanza{Type: s.Type, Args: s.Args, Body: bytes.Clone(s.Body)}
+	tampered.Body[len(tampered.Body)-1] ^= 0x01
+	if _, err := id.Unwrap([]*age.Stanza{tampered}); !errors.Is(err, age.ErrIncorrectIdentity) {
+		t.Errorf("expected ErrIncorrectIdentity for tampered stanza, got %v", err)
+	}
+
+	// Truncated body is malformed
+	truncated := &age.Stanza{Type: s.Type, Args: s.Args, Body: s.Body[:32+kyber768.CiphertextSize+16]}
+	if _, err := id.Unwrap([]*age.Stanza{truncated}); !errors.Is(err, ErrMalformedStanza) {
+		t.Errorf("expected ErrMalformedStanza for truncated stanza, got %v", err)
+	}
+
+	// Extra arguments are malformed
+	extraArgs := &age.Stanza{Type: s.Type, Args: []string{"x25519-mlkem768", "c2", "x"}, Body: s.Body}
+	if _, err := id.Unwrap([]*age.Stanza{extraArgs}); !errors.Is(err, ErrMalformedStanza) {
+		t.Errorf("expected ErrMalformedStanza for extra arguments, got %v", err)
+	}
+
+	// Unknown combiners and versions are skipped
+	unknownCombiner := &age.Stanza{Type: s.Type, Args: []string{"x25519-mlkem768", "c9"}, Body: s.Body}
+	if _, err := id.Unwrap([]*age.Stanza{unknownCombiner}); !errors.Is(err, age.ErrIncorrectIdentity) {
+		t.Errorf("expected ErrIncorrectIdentity for unknown combiner, got %v", err)
+	}
+
+	unknown := &age.Stanza{Type: s.Type, Args: []string{"h9"}, Body: s.Body}
+	if _, err := id.Unwrap([]*age.Stanza{unknown}); !errors.Is(err, age.ErrIncorrectIdentity) {
+		t.Errorf("expected ErrIncorrectIdentity for unknown version, got %v", err)
+	}
+}
+
+func TestHybridP384MLKEM1024(t *testing.T) {
+	id, err := NewIdentityWithConfig(Config{Suite: HybridP384MLKEM1024})
+	if err != nil {
+		t.Fatalf("NewIdentityWithConfig failed: %v", err)
+	}
+
+	if id.Suite() != HybridP384MLKEM1024 {
+		t.Errorf("expected suite %v, got %v", HybridP384MLKEM1024, id.Suite())
+	}
+
+	// Round-trip identity and recipient encodings
+	idStr, err := id.String()
+	if err != nil {
+		t.Fatalf("String() failed: %v", err)
+	}
+	parsedID, err := ParseIdentity(idStr)
+	if err != nil {
+		t.Fatalf("ParseIdentity failed: %v", err)
+	}
+	if !bytes.Equal(parsedID.ecSecret, id.ecSecret) || !bytes.Equal(parsedID.mlkemSecret, id.mlkemSecret) {
+		t.Errorf("secret key mismatch after parsing")
+	}
+
+	rStr, err := id.Recipient().String()
+	if err != nil {
+		t.Fatalf("Recipient String() failed: %v", err)
+	}
+	r, err := ParseRecipient(rStr)
+	if err != nil {
+		t.Fatalf("ParseRecipient failed: %v", err)
+	}
+	if r.Suite() != HybridP384MLKEM1024 {
+		t.Errorf("expected recipient suite %v, got %v", HybridP384MLKEM1024, r.Suite())
+	}
+
+	// Encrypt and decrypt through age
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, r)
+	if err != nil {
+		t.Fatalf("age.Encrypt failed: %v", err)
+	}
+	if _, err := w.Write([]byte("category 5")); err != nil {
+		t.Fatalf("writing plaintext failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("closing age writer failed: %v", err)
+	}
+
+	out, err := age.Decrypt(bytes.NewReader(encrypted.Bytes()), parsedID)
+	if err != nil {
+		t.Fatalf("age.Decrypt failed: %v", err)
+	}
+	plaintext, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("reading decrypted data failed: %v", err)
+	}
+	if string(plaintext) != "category 5" {
+		t.Errorf("decrypted data doesn't match original")
+	}
+
+	// Identities of other suites skip the stanza
+	other, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	if _, err := age.Decrypt(bytes.NewReader(encrypted.Bytes()), other); err == nil {
+		t.Error("expected decryption with an X25519+ML-KEM-768 identity to fail")
+	}
+}
+
+func TestParseSuite(t *testing.T) {
+	tests := []struct {
+		name  string
+		suite Suite
+	}{
+		{"x25519-mlkem768", HybridX25519MLKEM768},
+		{"P384-MLKEM1024", HybridP384MLKEM1024},
+	}
+
+	for _, tt := range tests {
+		suite, err := ParseSuite(tt.name)
+		if err != nil {
+			t.Fatalf("ParseSuite(%q) failed: %v", tt.name, err)
+		}
+		if suite != tt.suite {
+			t.Errorf("ParseSuite(%q) = %v, expected %v", tt.name, suite, tt.suite)
+		}
+	}
+
+	for _, name := range []string{"", "h1", "x448-mlkem1024"} {
+		if _, err := ParseSuite(name); err == nil {
+			t.Errorf("expected error for suite %q", name)
+		}
+	}
+}
+
+func TestPluginEncoding(t *testing.T) {
+	id, err := NewIdentityWithConfig(Config{Suite: HybridP384MLKEM1024})
+	if err != nil {
+		t.Fatalf("NewIdentityWithConfig failed: %v", err)
+	}
+
+	rStr, err := id.Recipient().PluginString()
+	if err != nil {
+		t.Fatalf("Recipient PluginString() failed: %v", err)
+	}
+	idStr, err := id.PluginString()
+	if err != nil {
+		t.Fatalf("Identity PluginString() failed: %v", err)
+	}
+
+	// age must route both encodings to age-plugin-qage
+	name, _, err := plugin.ParseRecipient(rStr)
+	if err != nil || name != "qage" {
+		t.Fatalf("age does not parse the plugin recipient: %q, %v", name, err)
+	}
+	name, _, err = plugin.ParseIdentity(idStr)
+	if err != nil || name != "qage" {
+		t.Fatalf("age does not parse the plugin identity: %q, %v", name, err)
+	}
+
+	parsed, err := ParseRecipient(rStr)
+	if err != nil {
+		t.Fatalf("ParseRecipient failed: %v", err)
+	}
+	if !bytes.Equal(parsed.ecPub, id.Recipient().ecPub) || !bytes.Equal(parsed.mlkemPub, id.Recipient().mlkemPub) {
+		t.Errorf("recipient mismatch after parsing")
+	}
+
+	parsedID, err := ParseIdentity(idStr)
+	if err != nil {
+		t.Fatalf("ParseIdentity failed: %v", err)
+	}
+	if !bytes.Equal(parsedID.ecSecret, id.ecSecret) || !bytes.Equal(parsedID.mlkemSecret, id.mlkemSecret) {
+		t.Errorf("identity mismatch after parsing")
+	}
+}
+
+func TestParseIdentityDerivesRecipient(t *testing.T) {
+	ids := map[string]*Identity{"legacy": newLegacyIdentity(t)}
+	for _, suite := range []Suite{HybridX25519MLKEM768, HybridP384MLKEM1024} {
+		id, err := NewIdentityWithConfig(Config{Suite: suite})
+		if err != nil {
+			t.Fatalf("NewIdentityWithConfig failed: %v", err)
+		}
+		ids[suite.String()] = id
+	}
+
+	for name, id := range ids {
+		t.Run(name, func(t *testing.T) {
+			want, err := id.Recipient().String()
+			if err != nil {
+				t.Fatalf("Recipient String() failed: %v", err)
+			}
+
+			line, err := id.FormatFile("")
+			if err != nil {
+				t.Fatalf("FormatFile failed: %v", err)
+			}
+			parsed, _, err := ParseIdentityFile(line)
+			if err != nil {
+				t.Fatalf("ParseIdentityFile failed: %v", err)
+			}
+			got, err := parsed.Recipient().String()
+			if err != nil {
+				t.Fatalf("Recipient String() failed: %v", err)
+			}
+			if got != want {
+				t.Errorf("derived recipient does not match the generated one")
+			}
+
+			// Flip a byte of the public key embedded in the ML-KEM secret key
+			tampered := &Identity{
+				suite:       id.suite,
+				ecSecret:    id.ecSecret,
+				mlkemSecret: bytes.Clone(id.mlkemSecret),
+			}
+			tampered.mlkemSecret[len(tampered.mlkemSecret)-64-len(id.Recipient().mlkemPub)] ^= 1
+			s, err := tampered.String()
+			if err != nil {
+				t.Fatalf("String failed: %v", err)
+			}
+			if _, err := ParseIdentity(s); err == nil || !strings.Contains(err.Error(), "public key hash") {
+				t.Errorf("expected a public key hash error, got %v", err)
+			}
+		})
 	}
 }
@@ -0,0 +1,166 @@
+package qage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/zlobste/qage/internal/format"
+	"github.com/zlobste/qage/pkg/crypto"
+)
+
+// RekeyOptions describes how Rekey changes the recipients of a file.
+type RekeyOptions struct {
+	// Identities unwrap the file key. One of them must match a stanza of
+	// the file.
+	Identities []age.Identity
+
+	// Keep reports whether the i-th stanza of the file, counting from zero,
+	// is kept. If nil, every existing stanza is dropped, so that only
+	// Recipients can decrypt the rekeyed file.
+	Keep func(i int, s *age.Stanza) bool
+
+	// Recipients are added to the file.
+	Recipients []age.Recipient
+
+	// AllowClassical skips the label check of the stanzas kept, so that
+	// classical recipients can be added to a post-quantum file or the other
+	// way around. New recipients must still be compatible with each other;
+	// see Recipient.AllowClassical.
+	AllowClassical bool
+}
+
+// Rekey copies the age file read from src to dst with a new set of recipient
+// stanzas, without re-encrypting the payload: the file key is unwrapped with
+// opts.Identities, the stanzas chosen by opts.Keep are kept, new stanzas are
+// wrapped for opts.Recipients, and the header MAC is recomputed. The payload
+// is streamed through untouched, so rekeying a large file is cheap.
+//
+// As with age.Encrypt, recipients with different labels can't be mixed: new
+// recipients must be compatible with each other and with the stanzas kept,
+// whose labels are inferred from their type, unless opts.AllowClassical is
+// set. Passphrase-encrypted files, and passphrase recipients, can't be mixed
+// with anything.
+//
+// Removing a recipient only affects the new copy: anyone who kept the old
+// file, or its file key, can still decrypt it.
+func Rekey(dst io.Writer, src io.Reader, opts RekeyOptions) error {
+	hdr, payload, err := format.Parse(src)
+	if err != nil {
+		return fmt.Errorf("qage: failed to read header: %w", err)
+	}
+
+	var old bytes.Buffer
+	if err := hdr.Marshal(&old); err != nil {
+		return fmt.Errorf("qage: failed to read header: %w", err)
+	}
+	if len(opts.Identities) == 0 {
+		return errors.New("qage: no identities to unwrap the file key")
+	}
+	fileKey, err := age.DecryptHeader(old.Bytes(), opts.Identities...)
+	if err != nil {
+		return fmt.Errorf("qage: failed to unwrap file key: %w", err)
+	}
+	defer clear(fileKey)
+
+	newHdr := &format.Header{}
+	var labels []string
+	var labelled bool
+	for i, s := range hdr.Stanzas {
+		if opts.Keep == nil || !opts.Keep(i, s) {
+			continue
+		}
+		l, known := stanzaLabels(s)
+		if !known || opts.AllowClassical {
+			// Plugin stanzas don't reveal whether they are post-quantum
+			// (and with AllowClassical, it doesn't matter)
+			newHdr.Stanzas = append(newHdr.Stanzas, s)
+			continue
+		}
+		if labelled && !slices.Equal(labels, l) {
+			return incompatibleLabelsError(labels, l)
+		}
+		labels, labelled = l, true
+		newHdr.Stanzas = append(newHdr.Stanzas, s)
+	}
+
+	for i, r := range opts.Recipients {
+		var stanzas []*age.Stanza
+		var l []string
+		if rl, ok := r.(age.RecipientWithLabels); ok {
+			stanzas, l, err = rl.WrapWithLabels(fileKey)
+		} else {
+			stanzas, err = r.Wrap(fileKey)
+		}
+		if err != nil {
+			return fmt.Errorf("qage: failed to wrap key for recipient #%d: %w", i, err)
+		}
+		sort.Strings(l)
+		if labelled && !slices.Equal(labels, l) {
+			return incompatibleLabelsError(labels, l)
+		}
+		labels, labelled = l, true
+		newHdr.Stanzas = append(newHdr.Stanzas, stanzas...)
+	}
+	if len(newHdr.Stanzas) == 0 {
+		return errors.New("qage: no recipients left, the file would be undecryptable")
+	}
+
+	if newHdr.MAC, err = headerMAC(crypto.DefaultBackend(), fileKey, newHdr); err != nil {
+		return err
+	}
+	if err := newHdr.Marshal(dst); err != nil {
+		return fmt.Errorf("qage: failed to write header: %w", err)
+	}
+	if _, err := io.Copy(dst, payload); err != nil {
+		return fmt.Errorf("qage: failed to copy payload: %w", err)
+	}
+	return nil
+}
+
+// stanzaLabels returns the labels that the recipient of a stanza reports to
+// age, and whether they are known for its type.
+func stanzaLabels(s *age.Stanza) (labels []string, known bool) {
+	switch s.Type {
+	case stanzaType, thresholdStanzaType, shareStanzaType, hybridStanzaType:
+		return []string{postQuantumLabel}, true
+	case "X25519", "ssh-ed25519", "ssh-rsa":
+		return nil, true
+	case "scrypt":
+		// A passphrase stanza must be alone, like age's random label
+		return []string{"scrypt"}, true
+	default:
+		return nil, false
+	}
+}
+
+// incompatibleLabelsError explains why two recipients can't share a file,
+// like age.Encrypt.
+func incompatibleLabelsError(a, b []string) error {
+	if slices.Contains(a, postQuantumLabel) != slices.Contains(b, postQuantumLabel) {
+		return errors.New("qage: incompatible recipients: can't mix post-quantum and classical recipients, or the file would be vulnerable to quantum computers")
+	}
+	return fmt.Errorf("qage: incompatible recipients: labels %q and %q can't be mixed", strings.Join(a, ","), strings.Join(b, ","))
+}
+
+// headerMAC computes the MAC of an age header: HMAC-SHA-256 of the header up
+// to the "---", keyed with HKDF-SHA-256 of the file key and "header".
+func headerMAC(b crypto.Backend, fileKey []byte, hdr *format.Header) ([]byte, error) {
+	key, err := b.HKDF(fileKey, nil, "header", 32)
+	if err != nil {
+		return nil, fmt.Errorf("qage: failed to compute header MAC: %w", err)
+	}
+	h := hmac.New(sha256.New, key)
+	if err := hdr.MarshalWithoutMAC(h); err != nil {
+		return nil, fmt.Errorf("qage: failed to compute header MAC: %w", err)
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,147 @@
+package qage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestRekey(t *testing.T) {
+	alice, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	bob, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	carol, err := age.GenerateHybridIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := bytes.Repeat([]byte("a multi-GB archive "), 10000)
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, alice.Recipient())
+	if err != nil {
+		t.Fatalf("age.Encrypt failed: %v", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	oldHeader, err := age.ExtractHeader(bytes.NewReader(encrypted.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add bob and carol, keeping alice
+	var added bytes.Buffer
+	err = Rekey(&added, bytes.NewReader(encrypted.Bytes()), RekeyOptions{
+		Identities: []age.Identity{alice},
+		Keep:       func(int, *age.Stanza) bool { return true },
+		Recipients: []age.Recipient{bob.Recipient(), carol.Recipient()},
+	})
+	if err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	newHeader, err := age.ExtractHeader(bytes.NewReader(added.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := encrypted.Bytes()[len(oldHeader):]
+	if !bytes.HasSuffix(added.Bytes(), payload) || len(added.Bytes()) != len(newHeader)+len(payload) {
+		t.Fatal("payload changed")
+	}
+	for _, id := range []age.Identity{alice, bob, carol} {
+		r, err := age.Decrypt(bytes.NewReader(added.Bytes()), id)
+		if err != nil {
+			t.Fatalf("Decrypt with %T failed: %v", id, err)
+		}
+		if got, _ := io.ReadAll(r); !bytes.Equal(got, plaintext) {
+			t.Error("decrypted data doesn't match original")
+		}
+	}
+
+	// Replace everyone with bob
+	var replaced bytes.Buffer
+	err = Rekey(&replaced, bytes.NewReader(added.Bytes()), RekeyOptions{
+		Identities: []age.Identity{carol},
+		Recipients: []age.Recipient{bob.Recipient()},
+	})
+	if err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if _, err := age.Decrypt(bytes.NewReader(replaced.Bytes()), bob); err != nil {
+		t.Errorf("Decrypt with the new recipient failed: %v", err)
+	}
+	for _, id := range []age.Identity{alice, carol} {
+		if _, err := age.Decrypt(bytes.NewReader(replaced.Bytes()), id); !errors.Is(err, age.ErrIncorrectIdentity) {
+			t.Errorf("expected a removed recipient to fail, got %v", err)
+		}
+	}
+}
+
+func TestRekeyErrors(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	keepAll := func(int, *age.Stanza) bool { return true }
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]struct {
+		opts RekeyOptions
+		want string
+	}{
+		"wrong identity": {RekeyOptions{Identities: []age.Identity{other}, Recipients: []age.Recipient{other.Recipient()}}, "unwrap file key"},
+		"no recipients":  {RekeyOptions{Identities: []age.Identity{id}}, "no recipients left"},
+		"classical":      {RekeyOptions{Identities: []age.Identity{id}, Keep: keepAll, Recipients: []age.Recipient{x25519.Recipient()}}, "post-quantum and classical"},
+	} {
+		err := Rekey(io.Discard, bytes.NewReader(encrypted.Bytes()), c.opts)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected error containing %q, got %v", name, c.want, err)
+		}
+	}
+
+	var classical bytes.Buffer
+	err = Rekey(&classical, bytes.NewReader(encrypted.Bytes()), RekeyOptions{
+		Identities:     []age.Identity{id},
+		Keep:           keepAll,
+		Recipients:     []age.Recipient{x25519.Recipient()},
+		AllowClassical: true,
+	})
+	if err != nil {
+		t.Fatalf("Rekey with AllowClassical failed: %v", err)
+	}
+	for _, i := range []age.Identity{id, x25519} {
+		if _, err := age.Decrypt(bytes.NewReader(classical.Bytes()), i); err != nil {
+			t.Errorf("Decrypt with %T failed: %v", i, err)
+		}
+	}
+
+	if err := Rekey(io.Discard, strings.NewReader("not an age file\n"), RekeyOptions{Identities: []age.Identity{id}}); err == nil {
+		t.Error("expected error for a file that isn't an age file")
+	}
+}
@@ -0,0 +1,112 @@
+package qage
+
+import (
+	"crypto/sha3"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zlobste/qage/pkg/crypto"
+
+	"github.com/zlobste/qage/pkg/encoding"
+)
+
+// Identities are generated from a master seed of SeedSize bytes, and stored in
+// the compact form holding just the seed. Seeds of LongSeedSize bytes, such as
+// those derived from a mnemonic, are accepted as well.
+const (
+	SeedSize     = encoding.SeedSize
+	LongSeedSize = encoding.LongSeedSize
+)
+
+// NewIdentityFromSeed returns the identity of the suite in cfg expanded from
+// seed, which must be SeedSize or LongSeedSize bytes long. The same seed
+// always yields the same identity.
+//
+// The seed is expanded like the hybrid KEMs of draft-ietf-hpke-pq: the first
+// 64 bytes of SHAKE256(seed) are the ML-KEM (d, z) seed, and the following
+// bytes the ECDH secret key, skipping invalid P-384 scalars. For
+// HybridX25519MLKEM768 and a SeedSize seed, this yields the keys of the age
+// hybrid identity with the same seed.
+func NewIdentityFromSeed(seed []byte, cfg Config) (*Identity, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != SeedSize && len(seed) != LongSeedSize {
+		return nil, fmt.Errorf("qage: invalid seed length %d, expected %d or %d", len(seed), SeedSize, LongSeedSize)
+	}
+
+	id, err := expandSeed(cfg.Suite, seed, cfg.Backend)
+	if err != nil {
+		return nil, err
+	}
+	r, err := id.deriveRecipient()
+	if err != nil {
+		return nil, err
+	}
+	r.combiner = cfg.Combiner
+	r.rand = cfg.Rand
+	id.cachedRecipient = r
+
+	return id, nil
+}
+
+// newSeededIdentity generates an identity from a random seed.
+func newSeededIdentity(cfg Config) (*Identity, error) {
+	seed := make([]byte, SeedSize)
+	if _, err := io.ReadFull(randReader(cfg.Rand), seed); err != nil {
+		return nil, fmt.Errorf("qage: failed to generate seed: %w", err)
+	}
+	return NewIdentityFromSeed(seed, cfg)
+}
+
+// expandSeed derives the secret keys of an identity from its seed, with the
+// primitives of backend.
+func expandSeed(suite Suite, seed []byte, backend crypto.Backend) (*Identity, error) {
+	if suite == HybridX25519Kyber768 {
+		return nil, fmt.Errorf("qage: suite %s is decrypt-only", suite)
+	}
+	p, err := suite.primitives(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	s := sha3.NewSHAKE256()
+	s.Write(seed)
+	mlkemSeed := make([]byte, p.kem.SeedSize())
+	s.Read(mlkemSeed)
+	sk, err := p.kem.NewPrivateKey(mlkemSeed)
+	if err != nil {
+		return nil, fmt.Errorf("qage: failed to expand ML-KEM key: %w", err)
+	}
+	// Compact identities don't need the expanded key, which the stdlib
+	// backend doesn't expose.
+	mlkemSecret, err := sk.Bytes()
+	if err != nil && !errors.Is(err, crypto.ErrUnsupported) {
+		return nil, fmt.Errorf("qage: failed to expand ML-KEM key: %w", err)
+	}
+
+	ecSecret := make([]byte, p.dh.PrivateKeySize())
+	for {
+		s.Read(ecSecret)
+		if _, err := p.dh.PublicKey(ecSecret); err == nil {
+			break
+		}
+	}
+	return &Identity{
+		suite:       suite,
+		ecSecret:    ecSecret,
+		mlkemSecret: mlkemSecret,
+		mlkemSeed:   mlkemSeed,
+		seed:        append([]byte(nil), seed...),
+		backend:     p.backend,
+	}, nil
+}
+
+// Compact reports whether the identity is backed by a seed, and so is encoded
+// in the compact form. Identities generated before the compact form only
+// hold their expanded keys, from which the seed can't be recovered.
+func (id *Identity) Compact() bool {
+	return id.seed != nil
+}
@@ -0,0 +1,104 @@
+package qage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNewIdentityFromSeed(t *testing.T) {
+	for _, suite := range []Suite{HybridX25519MLKEM768, HybridP384MLKEM1024} {
+		for _, size := range []int{SeedSize, LongSeedSize} {
+			seed := bytes.Repeat([]byte{byte(size)}, size)
+			id, err := NewIdentityFromSeed(seed, Config{Suite: suite})
+			if err != nil {
+				t.Fatalf("NewIdentityFromSeed failed: %v", err)
+			}
+			if !id.Compact() || id.Suite() != suite {
+				t.Errorf("unexpected identity for suite %s, %d-byte seed", suite, size)
+			}
+
+			// Expansion is deterministic
+			again, err := NewIdentityFromSeed(seed, Config{Suite: suite})
+			if err != nil {
+				t.Fatalf("NewIdentityFromSeed failed: %v", err)
+			}
+			want, _ := id.Recipient().String()
+			if got, _ := again.Recipient().String(); got != want {
+				t.Errorf("%s: same seed gave different recipients", suite)
+			}
+
+			// The compact encoding round-trips through the seed
+			line, err := id.FormatFile("backup")
+			if err != nil {
+				t.Fatalf("FormatFile failed: %v", err)
+			}
+			if len(line) > 150 {
+				t.Errorf("%s: compact identity line is %d characters long", suite, len(line))
+			}
+			parsed, comment, err := ParseIdentityFile(line)
+			if err != nil {
+				t.Fatalf("ParseIdentityFile failed: %v", err)
+			}
+			if got, _ := parsed.Recipient().String(); got != want || !parsed.Compact() || comment != "backup" {
+				t.Errorf("%s: parsed compact identity doesn't match", suite)
+			}
+
+			// And decrypts what the original encrypts
+			stanzas, err := id.Recipient().Wrap(make([]byte, 16))
+			if err != nil {
+				t.Fatalf("Wrap failed: %v", err)
+			}
+			if _, err := parsed.Unwrap(stanzas); err != nil {
+				t.Errorf("Unwrap failed: %v", err)
+			}
+		}
+	}
+
+	// Different seeds give different keys
+	a, _ := NewIdentityFromSeed(make([]byte, SeedSize), Config{})
+	b, _ := NewIdentityFromSeed(make([]byte, LongSeedSize), Config{})
+	if bytes.Equal(a.Recipient().mlkemPub, b.Recipient().mlkemPub) {
+		t.Error("different seeds gave the same keys")
+	}
+
+	if _, err := NewIdentityFromSeed(make([]byte, 16), Config{}); err == nil || !strings.Contains(err.Error(), "seed length") {
+		t.Errorf("expected a seed length error, got %v", err)
+	}
+	if _, err := NewIdentityFromSeed(make([]byte, SeedSize), Config{Suite: HybridX25519Kyber768}); err == nil {
+		t.Error("expected error for the decrypt-only suite")
+	}
+}
+
+func TestExpandedIdentityStillParses(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	expanded := *id
+	expanded.seed = nil
+
+	s, err := expanded.String()
+	if err != nil {
+		t.Fatalf("String failed: %v", err)
+	}
+	compact, err := id.String()
+	if err != nil {
+		t.Fatalf("String failed: %v", err)
+	}
+	if len(s) < 3000 || len(compact) > 100 {
+		t.Errorf("unexpected encoding lengths %d (expanded) and %d (compact)", len(s), len(compact))
+	}
+
+	parsed, err := ParseIdentity(s)
+	if err != nil {
+		t.Fatalf("ParseIdentity failed: %v", err)
+	}
+	if parsed.Compact() {
+		t.Error("expanded identity parsed as compact")
+	}
+	want, _ := id.Recipient().String()
+	if got, _ := parsed.Recipient().String(); got != want {
+		t.Error("expanded and compact encodings have different recipients")
+	}
+}
@@ -8,26 +8,48 @@ import (
 	"io"
 
 	"filippo.io/age"
+
+	"github.com/zlobste/qage/pkg/crypto"
 )
 
-// Selftest runs internal validation tests.
+// SelftestResult is the result of one self-test.
+type SelftestResult struct {
+	Name string
+
+	// Skipped reports whether the crypto backend doesn't provide what is
+	// tested, in which case Err is the reason.
+	Skipped bool
+	Err     error
+}
+
+// Selftest runs internal validation tests, and returns the first failure.
 func Selftest() error {
-	// Test 1: Key generation and round-trip
-	if err := SelftestKeygenRoundtrip(); err != nil {
-		return fmt.Errorf("keygen roundtrip: %w", err)
+	for _, r := range SelftestResults() {
+		if r.Err != nil && !r.Skipped {
+			return fmt.Errorf("%s: %w", r.Name, r.Err)
+		}
+	}
+	return nil
+}
+
+// SelftestResults runs the known-answer tests of the default crypto backend,
+// then the round-trip tests, and returns the result of each.
+func SelftestResults() []SelftestResult {
+	var results []SelftestResult
+	for _, r := range crypto.KnownAnswerTests(DefaultConfig().Backend) {
+		results = append(results, SelftestResult{Name: r.Name, Skipped: r.Skipped, Err: r.Err})
 	}
 
+	// Test 1: Key generation and round-trip
+	results = append(results, SelftestResult{Name: "keygen roundtrip", Err: SelftestKeygenRoundtrip()})
+
 	// Test 2: Age integration
-	if err := SelftestAgeIntegration(); err != nil {
-		return fmt.Errorf("age integration: %w", err)
-	}
+	results = append(results, SelftestResult{Name: "age integration", Err: SelftestAgeIntegration()})
 
 	// Test 3: String encoding/decoding
-	if err := SelftestStringEncoding(); err != nil {
-		return fmt.Errorf("string encoding: %w", err)
-	}
+	results = append(results, SelftestResult{Name: "string encoding", Err: SelftestStringEncoding()})
 
-	return nil
+	return results
 }
 
 // SelftestKeygenRoundtrip tests key generation and round-trip encoding.
@@ -53,8 +75,8 @@ func SelftestKeygenRoundtrip() error {
 	if id.suite != id2.suite {
 		return errors.New("suite mismatch")
 	}
-	if id.x25519Secret != id2.x25519Secret {
-		return errors.New("X25519 secret mismatch")
+	if !bytes.Equal(id.ecSecret, id2.ecSecret) {
+		return errors.New("ECDH secret mismatch")
 	}
 	if !bytes.Equal(id.mlkemSecret, id2.mlkemSecret) {
 		return errors.New("ML-KEM secret mismatch")
@@ -75,8 +97,8 @@ func SelftestKeygenRoundtrip() error {
 	if r.suite != r2.suite {
 		return errors.New("recipient suite mismatch")
 	}
-	if r.x25519Pub != r2.x25519Pub {
-		return errors.New("recipient X25519 public mismatch")
+	if !bytes.Equal(r.ecPub, r2.ecPub) {
+		return errors.New("recipient ECDH public mismatch")
 	}
 	if !bytes.Equal(r.mlkemPub, r2.mlkemPub) {
 		return errors.New("recipient ML-KEM public mismatch")
@@ -158,8 +180,8 @@ func SelftestStringEncoding() error {
 	if id.suite != id2.suite {
 		return errors.New("file format suite mismatch")
 	}
-	if id.x25519Secret != id2.x25519Secret {
-		return errors.New("file format X25519 secret mismatch")
+	if !bytes.Equal(id.ecSecret, id2.ecSecret) {
+		return errors.New("file format ECDH secret mismatch")
 	}
 	if !bytes.Equal(id.mlkemSecret, id2.mlkemSecret) {
 		return errors.New("file format ML-KEM secret mismatch")
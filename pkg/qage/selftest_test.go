@@ -1,6 +1,7 @@
 package qage
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -29,3 +30,19 @@ func TestSelftestStringEncoding(t *testing.T) {
 		t.Fatalf("SelftestStringEncoding failed: %v", err)
 	}
 }
+
+func TestSelftestResults(t *testing.T) {
+	results := SelftestResults()
+	kats := 0
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Name, r.Err)
+		}
+		if strings.Contains(r.Name, "ACVP") || strings.Contains(r.Name, "RFC") {
+			kats++
+		}
+	}
+	if kats == 0 || kats != len(results)-3 {
+		t.Errorf("expected known-answer tests and 3 round-trip tests, got %d results", len(results))
+	}
+}
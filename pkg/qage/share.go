@@ -0,0 +1,103 @@
+package qage
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/zlobste/qage/internal/shamir"
+	"github.com/zlobste/qage/pkg/encoding"
+)
+
+// ErrShareMismatch is returned by CombineShares when the shares don't rebuild
+// the identity they were split from, because they belong to different
+// identities or one of them is corrupted.
+var ErrShareMismatch = errors.New("qage: shares don't match the identity they were split from")
+
+// SplitIdentity splits an identity into n shares with Shamir's secret sharing
+// over GF(256), so that any threshold of them rebuild it with CombineShares
+// and fewer reveal nothing about it. threshold must be at least 2, and n at
+// most 255.
+//
+// Each share is a bech32 string (qagshare1...) carrying its index, the
+// threshold and the fingerprint of the identity's recipient. Compact
+// identities make shares of about 100 characters; expanded identities make
+// shares as long as the identity itself.
+func SplitIdentity(id *Identity, threshold, n int) ([]string, error) {
+	data, err := encoding.IdentityData(id.encodingIdentity())
+	if err != nil {
+		return nil, err
+	}
+	defer clear(data)
+
+	shares, err := shamir.Split(data, threshold, n, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("qage: failed to split identity: %w", err)
+	}
+
+	fp := id.Recipient().fingerprint()
+	encoded := make([]string, len(shares))
+	for i, s := range shares {
+		encoded[i], err = encoding.EncodeShare(&encoding.Share{
+			Index:       s.Index,
+			Threshold:   byte(threshold),
+			Fingerprint: fp,
+			Value:       s.Value,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return encoded, nil
+}
+
+// CombineShares rebuilds an identity from shares returned by SplitIdentity.
+// At least the threshold recorded in the shares must be given, all from the
+// same split, and the recipient of the rebuilt identity must match their
+// fingerprint, or the returned error wraps ErrShareMismatch.
+func CombineShares(shares []string) (*Identity, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("qage: no shares")
+	}
+
+	var first *encoding.Share
+	parts := make([]shamir.Share, len(shares))
+	for i, str := range shares {
+		s, err := encoding.ParseShare(str)
+		if err != nil {
+			return nil, fmt.Errorf("qage: error in share %d: %w", i+1, err)
+		}
+		if first == nil {
+			first = s
+		} else if s.Fingerprint != first.Fingerprint {
+			return nil, fmt.Errorf("%w: share %d is for %s, not %s", ErrShareMismatch, i+1,
+				formatFingerprint(s.Fingerprint), formatFingerprint(first.Fingerprint))
+		} else if s.Threshold != first.Threshold {
+			return nil, fmt.Errorf("%w: share %d has threshold %d, not %d", ErrShareMismatch, i+1, s.Threshold, first.Threshold)
+		}
+		parts[i] = shamir.Share{Index: s.Index, Value: s.Value}
+	}
+	if len(shares) < int(first.Threshold) {
+		return nil, fmt.Errorf("qage: %d shares are needed to rebuild %s, got %d",
+			first.Threshold, formatFingerprint(first.Fingerprint), len(shares))
+	}
+
+	data, err := shamir.Combine(parts)
+	if err != nil {
+		return nil, fmt.Errorf("qage: %w", err)
+	}
+	defer clear(data)
+
+	encId, err := encoding.ParseIdentityData(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrShareMismatch, err)
+	}
+	id, err := newIdentityFromEncoding(encId, Config{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrShareMismatch, err)
+	}
+	if id.Recipient().fingerprint() != first.Fingerprint {
+		return nil, fmt.Errorf("%w: rebuilt %s, expected %s", ErrShareMismatch, id.Fingerprint(), formatFingerprint(first.Fingerprint))
+	}
+	return id, nil
+}
@@ -0,0 +1,102 @@
+package qage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zlobste/qage/pkg/encoding"
+)
+
+func TestSplitCombineShares(t *testing.T) {
+	compact, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	p384, err := NewIdentityWithConfig(Config{Suite: HybridP384MLKEM1024})
+	if err != nil {
+		t.Fatalf("NewIdentityWithConfig failed: %v", err)
+	}
+	expanded := *p384
+	expanded.seed = nil
+
+	for name, id := range map[string]*Identity{"compact": compact, "p384": p384, "expanded": &expanded} {
+		shares, err := SplitIdentity(id, 3, 5)
+		if err != nil {
+			t.Fatalf("%s: SplitIdentity failed: %v", name, err)
+		}
+		if len(shares) != 5 {
+			t.Fatalf("%s: expected 5 shares, got %d", name, len(shares))
+		}
+		for _, s := range shares {
+			if !strings.HasPrefix(s, encoding.HRPShare+"1") {
+				t.Fatalf("%s: unexpected share %q", name, s)
+			}
+		}
+
+		want, _ := id.String()
+		for _, subset := range [][]string{shares[:3], shares[2:], {shares[4], shares[0], shares[2]}, shares} {
+			got, err := CombineShares(subset)
+			if err != nil {
+				t.Fatalf("%s: CombineShares failed: %v", name, err)
+			}
+			if s, _ := got.String(); s != want {
+				t.Errorf("%s: rebuilt identity doesn't match", name)
+			}
+		}
+
+		if _, err := CombineShares(shares[:2]); err == nil || !strings.Contains(err.Error(), "3 shares are needed") {
+			t.Errorf("%s: expected an error about missing shares, got %v", name, err)
+		}
+	}
+	if shares, _ := SplitIdentity(compact, 2, 2); len(shares[0]) > 110 {
+		t.Errorf("compact identity share is %d characters long", len(shares[0]))
+	}
+}
+
+func TestCombineSharesMismatch(t *testing.T) {
+	a, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharesA, err := SplitIdentity(a, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharesB, err := SplitIdentity(b, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CombineShares([]string{sharesA[0], sharesB[1]}); !errors.Is(err, ErrShareMismatch) {
+		t.Errorf("expected ErrShareMismatch for shares of different identities, got %v", err)
+	}
+
+	// A share with a forged fingerprint rebuilds a different identity
+	forged, err := encoding.ParseShare(sharesB[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.Fingerprint = a.Recipient().fingerprint()
+	s, err := encoding.EncodeShare(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CombineShares([]string{sharesA[0], s}); !errors.Is(err, ErrShareMismatch) {
+		t.Errorf("expected ErrShareMismatch for a corrupted share, got %v", err)
+	}
+
+	if _, err := CombineShares([]string{sharesA[0], sharesA[0]}); err == nil {
+		t.Error("expected error for a duplicate share")
+	}
+	if _, err := CombineShares([]string{sharesA[0], "qage1invalid"}); err == nil {
+		t.Error("expected error for an invalid share")
+	}
+	if _, err := SplitIdentity(a, 1, 3); err == nil {
+		t.Error("expected error for a threshold of 1")
+	}
+}
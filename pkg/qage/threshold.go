@@ -0,0 +1,232 @@
+package qage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"filippo.io/age"
+
+	"github.com/zlobste/qage/internal/shamir"
+)
+
+// A file encrypted to a ThresholdRecipient carries a descriptor stanza and one
+// share stanza per recipient:
+//
+//	-> qage-threshold <group> <threshold> <shares>
+//	-> qage-share <group> <index> <qage stanza arguments...>
+//	<qage stanza body sealing the share>
+//
+// The group is a random identifier tying the share stanzas to their
+// descriptor, so that one file can hold several threshold groups. Share
+// stanzas have a type of their own so that identities which don't know about
+// thresholds skip them instead of taking a share for the file key.
+const (
+	thresholdStanzaType = "qage-threshold"
+	shareStanzaType     = "qage-share"
+
+	// thresholdGroupSize is the size of the random group identifier.
+	thresholdGroupSize = 8
+)
+
+// ThresholdRecipient is an age.Recipient that splits the file key with
+// Shamir's secret sharing across several qage recipients, so that the file
+// can only be decrypted by a ThresholdIdentity holding the identities of at
+// least threshold of them.
+type ThresholdRecipient struct {
+	threshold  int
+	recipients []*Recipient
+}
+
+// Ensure ThresholdRecipient implements age.Recipient and
+// age.RecipientWithLabels
+var (
+	_ age.Recipient           = (*ThresholdRecipient)(nil)
+	_ age.RecipientWithLabels = (*ThresholdRecipient)(nil)
+)
+
+// NewThresholdRecipient returns a recipient that requires the identities of
+// threshold of the given recipients to decrypt. threshold must be at least 2
+// and at most the number of recipients, which must be distinct and at most
+// 255.
+func NewThresholdRecipient(threshold int, recipients ...*Recipient) (*ThresholdRecipient, error) {
+	if threshold < 2 || threshold > len(recipients) {
+		return nil, fmt.Errorf("qage: invalid threshold %d of %d recipients", threshold, len(recipients))
+	}
+	if len(recipients) > shamir.MaxShares {
+		return nil, fmt.Errorf("qage: at most %d threshold recipients are supported", shamir.MaxShares)
+	}
+	seen := make(map[[fingerprintSize]byte]bool, len(recipients))
+	for _, r := range recipients {
+		fp := r.fingerprint()
+		if seen[fp] {
+			return nil, fmt.Errorf("qage: recipient %s is listed more than once", r.Fingerprint())
+		}
+		seen[fp] = true
+	}
+
+	return &ThresholdRecipient{threshold: threshold, recipients: recipients}, nil
+}
+
+// Threshold returns the number of identities needed to decrypt.
+func (t *ThresholdRecipient) Threshold() int {
+	return t.threshold
+}
+
+// Recipients returns the recipients the file key is split across.
+func (t *ThresholdRecipient) Recipients() []*Recipient {
+	return t.recipients
+}
+
+// WrapWithLabels implements age.RecipientWithLabels, labelling the stanzas as
+// "postquantum" like those of a single Recipient.
+func (t *ThresholdRecipient) WrapWithLabels(fileKey []byte) ([]*age.Stanza, []string, error) {
+	stanzas, err := t.Wrap(fileKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stanzas, []string{postQuantumLabel}, nil
+}
+
+// Wrap implements age.Recipient.
+func (t *ThresholdRecipient) Wrap(fileKey []byte) ([]*age.Stanza, error) {
+	// Randomness comes from the Config.Rand of the first recipient, like
+	// the stanza of each recipient from its own.
+	random := randReader(t.recipients[0].rand)
+	shares, err := shamir.Split(fileKey, t.threshold, len(t.recipients), random)
+	if err != nil {
+		return nil, fmt.Errorf("qage: failed to split file key: %w", err)
+	}
+
+	group := make([]byte, thresholdGroupSize)
+	if _, err := io.ReadFull(random, group); err != nil {
+		return nil, fmt.Errorf("qage: failed to generate threshold group: %w", err)
+	}
+	groupArg := base64.RawStdEncoding.EncodeToString(group)
+
+	stanzas := []*age.Stanza{{
+		Type: thresholdStanzaType,
+		Args: []string{groupArg, strconv.Itoa(t.threshold), strconv.Itoa(len(shares))},
+	}}
+	for i, r := range t.recipients {
+		wrapped, err := r.Wrap(shares[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		s := wrapped[0]
+		args := append([]string{groupArg, strconv.Itoa(int(shares[i].Index))}, s.Args...)
+		stanzas = append(stanzas, &age.Stanza{Type: shareStanzaType, Args: args, Body: s.Body})
+	}
+	return stanzas, nil
+}
+
+// ThresholdIdentity is an age.Identity holding several qage identities. It
+// unwraps stanzas addressed to any of them like the identities themselves,
+// and files encrypted to a ThresholdRecipient by combining the shares
+// addressed to them.
+type ThresholdIdentity struct {
+	identities []*Identity
+	index      *IdentityIndex
+}
+
+// Ensure ThresholdIdentity implements age.Identity
+var _ age.Identity = (*ThresholdIdentity)(nil)
+
+// NewThresholdIdentity returns an identity that unwraps with all the given
+// identities together.
+func NewThresholdIdentity(identities ...*Identity) *ThresholdIdentity {
+	return &ThresholdIdentity{identities: identities, index: NewIdentityIndex(identities...)}
+}
+
+// thresholdGroup is a threshold group found in a file header.
+type thresholdGroup struct {
+	threshold, shares int
+	unwrapped         []shamir.Share
+}
+
+// Unwrap implements age.Identity.
+//
+// Stanzas addressed to one of the identities are unwrapped first. Otherwise,
+// the shares addressed to the identities are combined as soon as a threshold
+// group has enough of them. If no group does, Unwrap returns an error
+// wrapping age.ErrIncorrectIdentity that tells how many shares were found.
+func (t *ThresholdIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	fileKey, err := t.index.Unwrap(stanzas)
+	if !errors.Is(err, age.ErrIncorrectIdentity) {
+		return fileKey, err
+	}
+
+	groups := make(map[string]*thresholdGroup)
+	var order []string
+	for _, s := range stanzas {
+		if s.Type != thresholdStanzaType {
+			continue
+		}
+		if len(s.Args) != 3 {
+			return nil, fmt.Errorf("%w: expected 3 %s arguments, got %d", ErrMalformedStanza, s.Type, len(s.Args))
+		}
+		k, err1 := strconv.Atoi(s.Args[1])
+		n, err2 := strconv.Atoi(s.Args[2])
+		if err1 != nil || err2 != nil || k < 2 || k > n || n > shamir.MaxShares {
+			return nil, fmt.Errorf("%w: invalid threshold %q of %q", ErrMalformedStanza, s.Args[1], s.Args[2])
+		}
+		if groups[s.Args[0]] != nil {
+			return nil, fmt.Errorf("%w: duplicate threshold group", ErrMalformedStanza)
+		}
+		groups[s.Args[0]] = &thresholdGroup{threshold: k, shares: n}
+		order = append(order, s.Args[0])
+	}
+	if len(groups) == 0 {
+		return nil, age.ErrIncorrectIdentity
+	}
+
+	for _, s := range stanzas {
+		if s.Type != shareStanzaType {
+			continue
+		}
+		if len(s.Args) < 3 {
+			return nil, fmt.Errorf("%w: expected at least 3 %s arguments, got %d", ErrMalformedStanza, s.Type, len(s.Args))
+		}
+		g := groups[s.Args[0]]
+		if g == nil {
+			return nil, fmt.Errorf("%w: share of an unknown threshold group", ErrMalformedStanza)
+		}
+		index, err := strconv.Atoi(s.Args[1])
+		if err != nil || index < 1 || index > g.shares {
+			return nil, fmt.Errorf("%w: invalid share index %q", ErrMalformedStanza, s.Args[1])
+		}
+
+		inner := &age.Stanza{Type: stanzaType, Args: s.Args[2:], Body: s.Body}
+		for _, id := range t.identities {
+			share, err := id.unwrapStanza(inner)
+			if errors.Is(err, age.ErrIncorrectIdentity) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			g.unwrapped = append(g.unwrapped, shamir.Share{Index: byte(index), Value: share})
+			break
+		}
+
+		if len(g.unwrapped) == g.threshold {
+			fileKey, err := shamir.Combine(g.unwrapped)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrMalformedStanza, err)
+			}
+			return fileKey, nil
+		}
+	}
+
+	// Report the group that came closest
+	best := groups[order[0]]
+	for _, name := range order[1:] {
+		if g := groups[name]; len(g.unwrapped) > len(best.unwrapped) {
+			best = g
+		}
+	}
+	return nil, fmt.Errorf("%w: found %d of the %d threshold shares needed to decrypt",
+		age.ErrIncorrectIdentity, len(best.unwrapped), best.threshold)
+}
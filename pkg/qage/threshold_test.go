@@ -0,0 +1,105 @@
+package qage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestThresholdRecipient(t *testing.T) {
+	ids := make([]*Identity, 3)
+	recs := make([]*Recipient, 3)
+	for i := range ids {
+		id, err := NewIdentity()
+		if err != nil {
+			t.Fatalf("NewIdentity failed: %v", err)
+		}
+		ids[i], recs[i] = id, id.Recipient()
+	}
+	tr, err := NewThresholdRecipient(2, recs...)
+	if err != nil {
+		t.Fatalf("NewThresholdRecipient failed: %v", err)
+	}
+
+	plaintext := []byte("needs two officers")
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, tr)
+	if err != nil {
+		t.Fatalf("age.Encrypt failed: %v", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any two identities decrypt
+	for _, pair := range [][]*Identity{{ids[0], ids[1]}, {ids[2], ids[0]}, ids} {
+		r, err := age.Decrypt(bytes.NewReader(encrypted.Bytes()), NewThresholdIdentity(pair...))
+		if err != nil {
+			t.Fatalf("Decrypt with %d identities failed: %v", len(pair), err)
+		}
+		if got, _ := io.ReadAll(r); !bytes.Equal(got, plaintext) {
+			t.Error("decrypted data doesn't match original")
+		}
+	}
+
+	// One identity doesn't, on its own or as a threshold identity
+	_, err = age.Decrypt(bytes.NewReader(encrypted.Bytes()), ids[1])
+	if !errors.Is(err, age.ErrIncorrectIdentity) {
+		t.Errorf("expected ErrIncorrectIdentity, got %v", err)
+	}
+	_, err = age.Decrypt(bytes.NewReader(encrypted.Bytes()), NewThresholdIdentity(ids[1]))
+	if err == nil || !strings.Contains(err.Error(), "found 1 of the 2 threshold shares") {
+		t.Errorf("expected an error counting shares, got %v", err)
+	}
+}
+
+func TestThresholdIdentityUnwrapsPlainStanzas(t *testing.T) {
+	a, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, b.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := age.Decrypt(&encrypted, NewThresholdIdentity(a, b)); err != nil {
+		t.Errorf("Decrypt of a plain file failed: %v", err)
+	}
+}
+
+func TestNewThresholdRecipientErrors(t *testing.T) {
+	a, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewThresholdRecipient(1, a.Recipient(), b.Recipient()); err == nil {
+		t.Error("expected error for a threshold of 1")
+	}
+	if _, err := NewThresholdRecipient(3, a.Recipient(), b.Recipient()); err == nil {
+		t.Error("expected error for a threshold above the number of recipients")
+	}
+	if _, err := NewThresholdRecipient(2, a.Recipient(), a.Recipient()); err == nil {
+		t.Error("expected error for a duplicate recipient")
+	}
+}
@@ -1,31 +1,51 @@
 package qage
 
 import (
-	"crypto/ecdh"
-	"crypto/rand"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha3"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 
 	"filippo.io/age"
-	kyber768 "github.com/cloudflare/circl/kem/kyber/kyber768"
+	"golang.org/x/crypto/chacha20poly1305"
 
-	"github.com/zlobste/qage/internal/hkdf"
+	"github.com/zlobste/qage/pkg/crypto"
 	"github.com/zlobste/qage/pkg/encoding"
 )
 
 // Identity represents a qage private identity for decryption.
 type Identity struct {
-	suite           Suite
-	x25519Secret    [32]byte
-	mlkemSecret     []byte
+	suite       Suite
+	ecSecret    []byte
+	mlkemSecret []byte
+	seed        []byte
+	comment     string
+
+	// mlkemSeed is the ML-KEM (d, z) seed of identities expanded from a
+	// seed, from which the decapsulation key is derived. mlkemSecret is
+	// unset if the backend doesn't expose expanded keys.
+	mlkemSeed []byte
+
+	// backend implements the primitives of the suite, crypto.DefaultBackend
+	// if nil.
+	backend crypto.Backend
+
 	cachedRecipient *Recipient
 }
 
 // Recipient represents a qage public recipient for encryption.
 type Recipient struct {
-	suite     Suite
-	x25519Pub [32]byte
-	mlkemPub  []byte
+	suite          Suite
+	combiner       Combiner
+	ecPub          []byte
+	mlkemPub       []byte
+	allowClassical bool
+	keyHint        bool
+	backend        crypto.Backend
+	rand           io.Reader
 }
 
 // Suite returns the cryptographic suite of the identity.
@@ -33,39 +53,158 @@ func (id *Identity) Suite() Suite {
 	return id.suite
 }
 
+// Comment returns the comment the identity was stored with in an identity
+// file, if any.
+func (id *Identity) Comment() string {
+	return id.comment
+}
+
 // Recipient returns the corresponding public recipient for this identity.
 func (id *Identity) Recipient() *Recipient {
 	if id.cachedRecipient != nil {
 		return id.cachedRecipient
 	}
 
-	// This should never happen in normal usage since cachedRecipient is set during creation
-	// Return a zero recipient as fallback
-	return &Recipient{
-		suite:     id.suite,
-		x25519Pub: [32]byte{},
-		mlkemPub:  nil,
+	// Identities are always created or parsed with their recipient; derive it
+	// for any constructed otherwise.
+	r, err := id.deriveRecipient()
+	if err != nil {
+		return &Recipient{suite: id.suite}
 	}
+	id.cachedRecipient = r
+	return r
 }
 
 // String returns the bech32 encoding of the identity.
 func (id *Identity) String() (string, error) {
-	encId := &encoding.Identity{
-		Suite:        encoding.Suite(id.suite),
-		X25519Secret: id.x25519Secret,
-		MLKEMSecret:  id.mlkemSecret,
-	}
-	return encoding.EncodeIdentity(encId)
+	return encoding.EncodeIdentity(id.encodingIdentity())
+}
+
+// PluginString returns the age plugin encoding of the identity
+// (AGE-PLUGIN-QAGE-1...), which can be used in age identity files.
+func (id *Identity) PluginString() (string, error) {
+	return encoding.EncodePluginIdentity(id.encodingIdentity())
 }
 
 // FormatFile returns the file format representation of the identity.
 func (id *Identity) FormatFile(comment string) (string, error) {
+	return encoding.FormatIdentityFile(id.encodingIdentity(), comment)
+}
+
+// encodingIdentity converts the identity to its encoding representation, the
+// compact one if the identity has a seed.
+func (id *Identity) encodingIdentity() *encoding.Identity {
+	if id.seed != nil {
+		return &encoding.Identity{Suite: encoding.Suite(id.suite), Seed: id.seed}
+	}
+
 	encId := &encoding.Identity{
-		Suite:        encoding.Suite(id.suite),
-		X25519Secret: id.x25519Secret,
-		MLKEMSecret:  id.mlkemSecret,
+		Suite:       encoding.Suite(id.suite),
+		MLKEMSecret: id.mlkemSecret,
+	}
+	if id.suite == HybridP384MLKEM1024 {
+		encId.P384Secret = id.ecSecret
+	} else {
+		copy(encId.X25519Secret[:], id.ecSecret)
+	}
+	return encId
+}
+
+// newIdentityFromEncoding converts a parsed identity to an Identity with the
+// backend and combiner of cfg, and derives its recipient, rejecting
+// inconsistent secret keys. Compact identities are expanded from their seed.
+func newIdentityFromEncoding(encId *encoding.Identity, cfg Config) (*Identity, error) {
+	cfg.Suite = Suite(encId.Suite)
+	if encId.Seed != nil {
+		return NewIdentityFromSeed(encId.Seed, cfg)
+	}
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	id := &Identity{
+		suite:       cfg.Suite,
+		mlkemSecret: encId.MLKEMSecret,
+		backend:     cfg.Backend,
+	}
+	if id.suite == HybridP384MLKEM1024 {
+		id.ecSecret = encId.P384Secret
+	} else {
+		id.ecSecret = append([]byte(nil), encId.X25519Secret[:]...)
+	}
+
+	r, err := id.deriveRecipient()
+	if err != nil {
+		return nil, err
+	}
+	r.combiner = cfg.Combiner
+	r.rand = cfg.Rand
+	id.cachedRecipient = r
+
+	return id, nil
+}
+
+// deriveRecipient recovers the public keys from the secret keys: the ECDH
+// public key by scalar multiplication, and the ML-KEM public key from the
+// ML-KEM seed or, for expanded identities, from its copy embedded in the
+// ML-KEM secret key, which must match the embedded hash.
+func (id *Identity) deriveRecipient() (*Recipient, error) {
+	p, err := id.suite.primitives(id.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	ecPub, err := p.dh.PublicKey(id.ecSecret)
+	if err != nil {
+		return nil, fmt.Errorf("qage: invalid ECDH secret key: %w", err)
+	}
+
+	if id.mlkemSeed == nil {
+		// The secret key is dk_PKE || ek || H(ek) || z, with H = SHA3-256,
+		// for both Kyber768 and ML-KEM.
+		pkSize := p.kem.PublicKeySize()
+		if len(id.mlkemSecret) != p.kem.PrivateKeySize() {
+			return nil, fmt.Errorf("qage: invalid ML-KEM secret key length %d", len(id.mlkemSecret))
+		}
+		off := len(id.mlkemSecret) - 2*32 - pkSize // H(ek) and z are 32 bytes
+		h := sha3.Sum256(id.mlkemSecret[off : off+pkSize])
+		if !bytes.Equal(h[:], id.mlkemSecret[off+pkSize:off+pkSize+len(h)]) {
+			return nil, errors.New("qage: ML-KEM secret key does not match its embedded public key hash")
+		}
 	}
-	return encoding.FormatIdentityFile(encId, comment)
+	sk, err := id.kemPrivateKey(p.kem)
+	if err != nil {
+		return nil, fmt.Errorf("qage: invalid ML-KEM secret key: %w", err)
+	}
+
+	return &Recipient{
+		suite:    id.suite,
+		combiner: DefaultConfig().Combiner,
+		ecPub:    ecPub,
+		mlkemPub: bytes.Clone(sk.PublicKey()),
+		backend:  id.backend,
+	}, nil
+}
+
+// kemPrivateKey returns the ML-KEM decapsulation key of the identity,
+// derived from its ML-KEM seed if it has one.
+func (id *Identity) kemPrivateKey(kem crypto.KEM) (crypto.KEMPrivateKey, error) {
+	if id.mlkemSeed != nil {
+		return kem.NewPrivateKey(id.mlkemSeed)
+	}
+	return kem.ParsePrivateKey(id.mlkemSecret)
+}
+
+// publicKeys returns the public keys of the identity.
+func (id *Identity) publicKeys() (ecPub []byte, mlkemPub []byte, err error) {
+	r := id.cachedRecipient
+	if r == nil {
+		if r, err = id.deriveRecipient(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return r.ecPub, r.mlkemPub, nil
 }
 
 // Suite returns the cryptographic suite of the recipient.
@@ -73,78 +212,261 @@ func (r *Recipient) Suite() Suite {
 	return r.suite
 }
 
+// Combiner returns the combiner used when wrapping file keys.
+func (r *Recipient) Combiner() Combiner {
+	if r.combiner == 0 {
+		return DefaultConfig().Combiner
+	}
+	return r.combiner
+}
+
 // String returns the bech32 encoding of the recipient.
 func (r *Recipient) String() (string, error) {
+	return encoding.EncodeRecipient(r.encodingRecipient())
+}
+
+// PluginString returns the age plugin encoding of the recipient
+// (age1qage1...), which age and other clients pass to age-plugin-qage.
+func (r *Recipient) PluginString() (string, error) {
+	return encoding.EncodePluginRecipient(r.encodingRecipient())
+}
+
+// encodingRecipient converts the recipient to its encoding representation.
+func (r *Recipient) encodingRecipient() *encoding.Recipient {
 	encRec := &encoding.Recipient{
-		Suite:     encoding.Suite(r.suite),
-		X25519Pub: r.x25519Pub,
-		MLKEMPub:  r.mlkemPub,
+		Suite:    encoding.Suite(r.suite),
+		MLKEMPub: r.mlkemPub,
+	}
+	if r.suite == HybridP384MLKEM1024 {
+		encRec.P384Pub = r.ecPub
+	} else {
+		copy(encRec.X25519Pub[:], r.ecPub)
 	}
-	return encoding.EncodeRecipient(encRec)
+	return encRec
 }
 
 // Age Integration Methods
 
-// Ensure Recipient implements age.Recipient
-var _ age.Recipient = (*Recipient)(nil)
+const (
+	// stanzaType is the age stanza type used by all qage recipients.
+	stanzaType = "qage"
 
-// Wrap implements age.Recipient.
-func (r *Recipient) Wrap(fileKey []byte) ([]*age.Stanza, error) {
-	switch r.suite {
+	// stanzaH1 is the original X25519+Kyber768 stanza, which masks the file
+	// key with the wrap key and carries no authentication. It is only read,
+	// never written.
+	stanzaH1 = "h1"
+
+	// stanzaH2 is the authenticated X25519+Kyber768 stanza. Like every
+	// stanza after h1, it seals the file key with ChaCha20-Poly1305 under the
+	// wrap key. An optional second argument names the combiner; without it
+	// the shared secrets are simply concatenated.
+	stanzaH2 = "h2"
+
+	// stanzaX25519MLKEM768 is the stanza written by HybridX25519MLKEM768.
+	stanzaX25519MLKEM768 = "x25519-mlkem768"
+
+	// stanzaP384MLKEM1024 is the stanza written by HybridP384MLKEM1024.
+	stanzaP384MLKEM1024 = "p384-mlkem1024"
+
+	// stanzaCombinerTranscript marks stanzas derived with CombinerTranscript.
+	stanzaCombinerTranscript = "c2"
+
+	// transcriptLabel domain-separates the transcript combiner.
+	transcriptLabel = "qage/combiner/v2"
+)
+
+// ErrMalformedStanza is returned by Unwrap when a qage stanza is structurally
+// invalid, as opposed to simply not being addressed to the identity.
+var ErrMalformedStanza = errors.New("qage: malformed stanza")
+
+// suiteParams describes the primitives and stanza encoding of a suite.
+type suiteParams struct {
+	dhID  crypto.DHID
+	kemID crypto.KEMID
+
+	// stanzaTag is the first stanza argument written by Wrap. It is empty
+	// for decrypt-only suites.
+	stanzaTag string
+
+	// acceptedTags are the first stanza arguments read by Unwrap.
+	acceptedTags []string
+}
+
+var (
+	paramsX25519Kyber768 = &suiteParams{
+		dhID:         crypto.X25519,
+		kemID:        crypto.Kyber768,
+		acceptedTags: []string{stanzaH1, stanzaH2},
+	}
+	paramsX25519MLKEM768 = &suiteParams{
+		dhID:         crypto.X25519,
+		kemID:        crypto.MLKEM768,
+		stanzaTag:    stanzaX25519MLKEM768,
+		acceptedTags: []string{stanzaX25519MLKEM768},
+	}
+	paramsP384MLKEM1024 = &suiteParams{
+		dhID:         crypto.P384,
+		kemID:        crypto.MLKEM1024,
+		stanzaTag:    stanzaP384MLKEM1024,
+		acceptedTags: []string{stanzaP384MLKEM1024},
+	}
+)
+
+// params returns the parameters of the suite.
+func (s Suite) params() (*suiteParams, error) {
+	switch s {
+	case HybridX25519Kyber768:
+		return paramsX25519Kyber768, nil
 	case HybridX25519MLKEM768:
-		return r.wrapHybridX25519MLKEM768(fileKey)
+		return paramsX25519MLKEM768, nil
+	case HybridP384MLKEM1024:
+		return paramsP384MLKEM1024, nil
 	default:
-		return nil, fmt.Errorf("qage: unsupported suite %d", r.suite)
+		return nil, fmt.Errorf("qage: unsupported suite %d", s)
 	}
 }
 
-func (r *Recipient) wrapHybridX25519MLKEM768(fileKey []byte) ([]*age.Stanza, error) {
-	// Generate ephemeral X25519 key
-	curve := ecdh.X25519()
-	ephPriv, err := curve.GenerateKey(rand.Reader)
+// suitePrimitives are the parameters of a suite with the implementations of
+// its primitives by a backend.
+type suitePrimitives struct {
+	*suiteParams
+	backend crypto.Backend
+	dh      crypto.DH
+	kem     crypto.KEM
+}
+
+// primitives returns the implementations of the primitives of the suite by
+// backend, or by crypto.DefaultBackend if it is nil. It fails if the backend
+// doesn't support the suite or, in FIPS 140-3 mode, doesn't approve it.
+func (s Suite) primitives(backend crypto.Backend) (*suitePrimitives, error) {
+	params, err := s.params()
 	if err != nil {
-		return nil, fmt.Errorf("qage: failed to generate ephemeral key: %w", err)
+		return nil, err
+	}
+	if backend == nil {
+		backend = crypto.DefaultBackend()
+	}
+	dh, err := backend.DH(params.dhID)
+	if err != nil {
+		return nil, fmt.Errorf("qage: suite %s: %w", s, err)
+	}
+	kem, err := backend.KEM(params.kemID)
+	if err != nil {
+		return nil, fmt.Errorf("qage: suite %s: %w", s, err)
+	}
+	return &suitePrimitives{suiteParams: params, backend: backend, dh: dh, kem: kem}, nil
+}
+
+// accepts reports whether stanzas with the given first argument are
+// addressed to identities of the suite.
+func (p *suiteParams) accepts(tag string) bool {
+	for _, t := range p.acceptedTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// postQuantumLabel is the label reported by WrapWithLabels. age refuses to
+// encrypt to recipients with different labels, so a file can't silently lose
+// its post-quantum protection to a classical recipient listed next to it.
+const postQuantumLabel = "postquantum"
+
+// Ensure Recipient implements age.Recipient and age.RecipientWithLabels
+var (
+	_ age.Recipient           = (*Recipient)(nil)
+	_ age.RecipientWithLabels = (*Recipient)(nil)
+)
+
+// AllowClassical returns a copy of the recipient that reports no labels, so
+// that it can be mixed with classical recipients such as age X25519 and SSH
+// keys. A file encrypted to such a mix is only as strong as its weakest
+// recipient: anyone who breaks the classical one can decrypt it.
+func (r *Recipient) AllowClassical() *Recipient {
+	c := *r
+	c.allowClassical = true
+	return &c
+}
+
+// WrapWithLabels implements age.RecipientWithLabels, labelling the stanza as
+// "postquantum" unless the recipient was returned by AllowClassical.
+func (r *Recipient) WrapWithLabels(fileKey []byte) ([]*age.Stanza, []string, error) {
+	stanzas, err := r.Wrap(fileKey)
+	if err != nil {
+		return nil, nil, err
 	}
-	ephPub := ephPriv.PublicKey().Bytes()
+	if r.allowClassical {
+		return stanzas, nil, nil
+	}
+	return stanzas, []string{postQuantumLabel}, nil
+}
 
-	// ECDH with peer's X25519 public
-	peerPub, err := curve.NewPublicKey(r.x25519Pub[:])
+// Wrap implements age.Recipient.
+func (r *Recipient) Wrap(fileKey []byte) ([]*age.Stanza, error) {
+	p, err := r.suite.primitives(r.backend)
 	if err != nil {
-		return nil, fmt.Errorf("qage: invalid X25519 public key: %w", err)
+		return nil, err
+	}
+	if p.stanzaTag == "" {
+		return nil, fmt.Errorf("qage: suite %s is decrypt-only", r.suite)
 	}
-	z1, err := ephPriv.ECDH(peerPub)
+
+	// Generate ephemeral ECDH key
+	ephPriv, ephPub, err := p.dh.GenerateKey(r.rand)
+	if err != nil {
+		return nil, fmt.Errorf("qage: failed to generate ephemeral key: %w", err)
+	}
+
+	// ECDH with peer's public key
+	z1, err := p.dh.ECDH(ephPriv, r.ecPub)
 	if err != nil {
 		return nil, fmt.Errorf("qage: ECDH failed: %w", err)
 	}
 
 	// ML-KEM encapsulation
-	var pk kyber768.PublicKey
-	pk.Unpack(r.mlkemPub)
-	ct := make([]byte, kyber768.CiphertextSize)
-	z2 := make([]byte, kyber768.SharedKeySize)
-	pk.EncapsulateTo(ct, z2, nil)
+	ct, z2, err := p.kem.Encapsulate(r.mlkemPub, r.rand)
+	if err != nil {
+		return nil, fmt.Errorf("qage: ML-KEM encapsulation failed: %w", err)
+	}
 
 	// Hybrid KDF: derive wrap key from both shared secrets
-	combined := make([]byte, 0, len(z1)+len(z2))
-	combined = append(combined, z1...)
-	combined = append(combined, z2...)
-	wrapKey := hkdf.Derive(nil, combined, []byte("qage/wrap"), 32)
+	var wrapKey []byte
+	args := []string{p.stanzaTag}
+	switch r.Combiner() {
+	case CombinerConcat:
+		wrapKey, err = deriveWrapKey(p.backend, z1, z2)
+	case CombinerTranscript:
+		wrapKey, err = deriveTranscriptWrapKey(p.backend, z1, z2, ephPub, ct, r.ecPub, r.mlkemPub)
+		args = append(args, stanzaCombinerTranscript)
+	default:
+		return nil, fmt.Errorf("qage: unsupported combiner %d", r.combiner)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.keyHint {
+		if r.Combiner() != CombinerTranscript {
+			return nil, errors.New("qage: key hints require the transcript combiner")
+		}
+		args = append(args, r.stanzaKeyHint(ephPub))
+	}
 
-	// Encrypt file key using XOR
-	encryptedKey := make([]byte, len(fileKey))
-	for i := range fileKey {
-		encryptedKey[i] = fileKey[i] ^ wrapKey[i%len(wrapKey)]
+	// Seal file key under the wrap key
+	sealed, err := aeadSeal(wrapKey, fileKey)
+	if err != nil {
+		return nil, err
 	}
 
-	// Construct stanza body: ephPub || ct || encryptedKey
-	body := make([]byte, 0, 32+kyber768.CiphertextSize+len(encryptedKey))
+	// Construct stanza body: ephPub || ct || sealed
+	body := make([]byte, 0, len(ephPub)+len(ct)+len(sealed))
 	body = append(body, ephPub...)
 	body = append(body, ct...)
-	body = append(body, encryptedKey...)
+	body = append(body, sealed...)
 
 	stanza := &age.Stanza{
-		Type: "qage",
-		Args: []string{"h1"}, // hybrid version 1
+		Type: stanzaType,
+		Args: args,
 		Body: body,
 	}
 
@@ -155,11 +477,20 @@ func (r *Recipient) wrapHybridX25519MLKEM768(fileKey []byte) ([]*age.Stanza, err
 var _ age.Identity = (*Identity)(nil)
 
 // Unwrap implements age.Identity.
+//
+// Stanzas that are not addressed to the identity are skipped. If none of them
+// match, Unwrap returns age.ErrIncorrectIdentity. A qage stanza that cannot be
+// parsed results in an error wrapping ErrMalformedStanza.
 func (id *Identity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
 	for _, s := range stanzas {
-		if s.Type == "qage" && len(s.Args) == 1 && s.Args[0] == "h1" {
-			return id.unwrapStanza(s)
+		fileKey, err := id.unwrapStanza(s)
+		if errors.Is(err, age.ErrIncorrectIdentity) {
+			continue
 		}
+		if err != nil {
+			return nil, err
+		}
+		return fileKey, nil
 	}
 	return nil, age.ErrIncorrectIdentity
 }
@@ -170,57 +501,171 @@ func (id *Identity) UnwrapStanza(s *age.Stanza) ([]byte, error) {
 }
 
 func (id *Identity) unwrapStanza(s *age.Stanza) ([]byte, error) {
-	switch id.suite {
-	case HybridX25519MLKEM768:
-		return id.unwrapHybridX25519MLKEM768(s)
-	default:
-		return nil, fmt.Errorf("qage: unsupported suite %d", id.suite)
+	if s.Type == hybridStanzaType {
+		return id.unwrapHybridStanza(s)
+	}
+	if s.Type != stanzaType {
+		return nil, age.ErrIncorrectIdentity
 	}
-}
 
-func (id *Identity) unwrapHybridX25519MLKEM768(s *age.Stanza) ([]byte, error) {
+	p, err := id.suite.primitives(id.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.Args) < 1 || len(s.Args) > 3 {
+		return nil, fmt.Errorf("%w: expected 1 to 3 arguments, got %d", ErrMalformedStanza, len(s.Args))
+	}
+
+	// Stanzas of other suites, and unknown versions which may be readable
+	// by a newer release, are not for us.
+	tag := s.Args[0]
+	if !p.accepts(tag) {
+		return nil, age.ErrIncorrectIdentity
+	}
+
+	combiner := CombinerConcat
+	if len(s.Args) >= 2 {
+		if tag == stanzaH1 {
+			return nil, fmt.Errorf("%w: unexpected %s argument %q", ErrMalformedStanza, tag, s.Args[1])
+		}
+		if s.Args[1] != stanzaCombinerTranscript {
+			// Unknown combiners may be readable by a newer release.
+			return nil, age.ErrIncorrectIdentity
+		}
+		combiner = CombinerTranscript
+	}
+
+	pointSize := p.dh.PublicKeySize()
+	ctSize := p.kem.CiphertextSize()
 	body := s.Body
-	if len(body) < 32+kyber768.CiphertextSize {
-		return nil, errors.New("qage: stanza too short")
+
+	// A key hint that isn't ours saves the decapsulation.
+	if hint, ok := parseKeyHint(s); ok {
+		if !validKeyHint(hint) {
+			return nil, fmt.Errorf("%w: invalid key hint %q", ErrMalformedStanza, hint)
+		}
+		if len(body) < pointSize {
+			return nil, fmt.Errorf("%w: stanza too short", ErrMalformedStanza)
+		}
+		if hint != id.Recipient().stanzaKeyHint(body[:pointSize]) {
+			return nil, age.ErrIncorrectIdentity
+		}
+	}
+
+	if len(body) < pointSize+ctSize {
+		return nil, fmt.Errorf("%w: stanza too short", ErrMalformedStanza)
+	}
+	if tag != stanzaH1 && len(body) <= pointSize+ctSize+chacha20poly1305.Overhead {
+		return nil, fmt.Errorf("%w: invalid %s body length %d", ErrMalformedStanza, tag, len(body))
 	}
 
 	// Parse stanza: ephPub || ct || encryptedKey
-	ephPub := body[:32]
-	ct := body[32 : 32+kyber768.CiphertextSize]
-	encryptedKey := body[32+kyber768.CiphertextSize:]
+	ephPub := body[:pointSize]
+	ct := body[pointSize : pointSize+ctSize]
+	encryptedKey := body[pointSize+ctSize:]
 
-	// ECDH with ephemeral public
-	curve := ecdh.X25519()
-	privKey, err := curve.NewPrivateKey(id.x25519Secret[:])
+	// ECDH with ephemeral public; the secret key was checked when the
+	// identity was created.
+	z1, err := p.dh.ECDH(id.ecSecret, ephPub)
 	if err != nil {
-		return nil, fmt.Errorf("qage: invalid X25519 secret key: %w", err)
+		return nil, fmt.Errorf("%w: ECDH failed: %v", ErrMalformedStanza, err)
 	}
-	peerPub, err := curve.NewPublicKey(ephPub)
+
+	// ML-KEM decapsulation
+	sk, err := id.kemPrivateKey(p.kem)
 	if err != nil {
-		return nil, fmt.Errorf("qage: invalid ephemeral public key: %w", err)
+		return nil, fmt.Errorf("qage: invalid ML-KEM secret key: %w", err)
 	}
-	z1, err := privKey.ECDH(peerPub)
+	z2, err := sk.Decapsulate(ct)
 	if err != nil {
-		return nil, fmt.Errorf("qage: ECDH failed: %w", err)
+		return nil, fmt.Errorf("%w: ML-KEM decapsulation failed: %v", ErrMalformedStanza, err)
 	}
 
-	// ML-KEM decapsulation
-	var sk kyber768.PrivateKey
-	sk.Unpack(id.mlkemSecret)
-	z2 := make([]byte, kyber768.SharedKeySize)
-	sk.DecapsulateTo(z2, ct)
-
 	// Hybrid KDF
+	var wrapKey []byte
+	if combiner == CombinerTranscript {
+		var ecPub, mlkemPub []byte
+		if ecPub, mlkemPub, err = id.publicKeys(); err != nil {
+			return nil, err
+		}
+		wrapKey, err = deriveTranscriptWrapKey(p.backend, z1, z2, ephPub, ct, ecPub, mlkemPub)
+	} else {
+		wrapKey, err = deriveWrapKey(p.backend, z1, z2)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if tag == stanzaH1 {
+		// Legacy stanzas are not authenticated: a wrong identity yields a
+		// garbage file key, which age rejects at the header MAC.
+		fileKey := make([]byte, len(encryptedKey))
+		for i := range encryptedKey {
+			fileKey[i] = encryptedKey[i] ^ wrapKey[i%len(wrapKey)]
+		}
+		return fileKey, nil
+	}
+
+	// Any tampering is indistinguishable from a stanza addressed to another
+	// identity, as with age's native X25519 stanzas.
+	fileKey, err := aeadOpen(wrapKey, encryptedKey)
+	if err != nil {
+		return nil, age.ErrIncorrectIdentity
+	}
+	return fileKey, nil
+}
+
+// deriveWrapKey combines the ECDH and ML-KEM shared secrets into the key
+// that protects the file key.
+func deriveWrapKey(b crypto.Backend, z1, z2 []byte) ([]byte, error) {
 	combined := make([]byte, 0, len(z1)+len(z2))
 	combined = append(combined, z1...)
 	combined = append(combined, z2...)
-	wrapKey := hkdf.Derive(nil, combined, []byte("qage/wrap"), 32)
+	return b.HKDF(combined, nil, "qage/wrap", 32)
+}
 
-	// Decrypt file key using XOR
-	fileKey := make([]byte, len(encryptedKey))
-	for i := range encryptedKey {
-		fileKey[i] = encryptedKey[i] ^ wrapKey[i%len(wrapKey)]
+// deriveTranscriptWrapKey derives the wrap key for CombinerTranscript. The
+// salt is a hash over the ephemeral share, the ML-KEM ciphertext and the
+// recipient's public keys, so the key is bound to the full KEM transcript.
+func deriveTranscriptWrapKey(b crypto.Backend, z1, z2, ephPub, ct, ecPub, mlkemPub []byte) ([]byte, error) {
+	h := sha256.New()
+	h.Write([]byte(transcriptLabel))
+	for _, part := range [][]byte{ephPub, ct, ecPub, mlkemPub} {
+		var length [2]byte
+		binary.BigEndian.PutUint16(length[:], uint16(len(part)))
+		h.Write(length[:])
+		h.Write(part)
 	}
+	salt := h.Sum(nil)
 
-	return fileKey, nil
+	combined := make([]byte, 0, len(z1)+len(z2))
+	combined = append(combined, z1...)
+	combined = append(combined, z2...)
+	return b.HKDF(combined, salt, transcriptLabel, 32)
+}
+
+// aeadSeal encrypts plaintext with ChaCha20-Poly1305. The wrap key is only
+// ever used once, so a zero nonce is safe.
+//
+// The AEAD is part of the stanza format, like the age payload encryption,
+// so it doesn't go through the backend: it comes from x/crypto even in FIPS
+// 140-3 mode, where ChaCha20-Poly1305 is not an approved algorithm.
+func aeadSeal(key, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, fmt.Errorf("qage: failed to initialize AEAD: %w", err)
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// aeadOpen decrypts a ciphertext produced by aeadSeal.
+func aeadOpen(key, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, fmt.Errorf("qage: failed to initialize AEAD: %w", err)
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Open(nil, nonce, ciphertext, nil)
 }
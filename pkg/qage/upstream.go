@@ -0,0 +1,74 @@
+package qage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/zlobste/qage/pkg/encoding"
+)
+
+// age v1.3 ships its own ML-KEM-768 + X25519 hybrid (age1pq1... recipients and
+// AGE-SECRET-KEY-PQ-1... identities, mlkem768x25519 stanzas), implemented by
+// age.HybridRecipient and age.HybridIdentity. ParseRecipients and
+// ParseIdentities accept both formats next to qage keys, and because both
+// carry the postquantum label they can be mixed freely in one file.
+
+// ErrNotConvertible is returned by Identity.HybridIdentity when a qage
+// identity has no equivalent age hybrid identity.
+var ErrNotConvertible = errors.New("qage: identity can't be converted to an age hybrid identity")
+
+// hybridStanzaType is the stanza type of age hybrid recipients, and
+// hybridIdentityHRP the bech32 HRP of age hybrid identities, which are written
+// in uppercase.
+const (
+	hybridStanzaType  = "mlkem768x25519"
+	hybridIdentityHRP = "age-secret-key-pq-"
+)
+
+// HybridIdentity returns the age hybrid identity (AGE-SECRET-KEY-PQ-1...) with
+// the same key material as the identity, so that the key can be used with age
+// alone.
+//
+// An age hybrid identity is a 32-byte seed from which both the ML-KEM-768
+// and X25519 keys are derived, like those of a compact HybridX25519MLKEM768
+// identity with a SeedSize seed. Other identities can't be converted: the
+// returned error, wrapping ErrNotConvertible, explains why.
+func (id *Identity) HybridIdentity() (*age.HybridIdentity, error) {
+	switch id.suite {
+	case HybridX25519MLKEM768:
+	case HybridP384MLKEM1024:
+		return nil, fmt.Errorf("%w: age only supports ML-KEM-768 with X25519, not %s", ErrNotConvertible, id.suite)
+	case HybridX25519Kyber768:
+		return nil, fmt.Errorf("%w: %s predates ML-KEM and is not compatible with it", ErrNotConvertible, id.suite)
+	default:
+		return nil, fmt.Errorf("%w: unsupported suite %d", ErrNotConvertible, id.suite)
+	}
+
+	switch len(id.seed) {
+	case 0:
+		return nil, fmt.Errorf("%w: it predates compact identities and stores expanded ML-KEM-768 and X25519 keys, and age derives both from a 32-byte seed that can't be recovered from them", ErrNotConvertible)
+	case SeedSize:
+	default:
+		return nil, fmt.Errorf("%w: its %d-byte seed is longer than the %d-byte seeds of age hybrid identities", ErrNotConvertible, len(id.seed), SeedSize)
+	}
+
+	s, err := encoding.Encode(hybridIdentityHRP, id.seed)
+	if err != nil {
+		return nil, err
+	}
+	return age.ParseHybridIdentity(strings.ToUpper(s))
+}
+
+// unwrapHybridStanza unwraps an age hybrid stanza with the equivalent age
+// hybrid identity, if there is one, so that a convertible identity also
+// decrypts files encrypted to its age1pq1 recipient.
+func (id *Identity) unwrapHybridStanza(s *age.Stanza) ([]byte, error) {
+	hid, err := id.HybridIdentity()
+	if err != nil {
+		return nil, age.ErrIncorrectIdentity
+	}
+	return hid.Unwrap([]*age.Stanza{s})
+}
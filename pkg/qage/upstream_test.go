@@ -0,0 +1,152 @@
+package qage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/zlobste/qage/pkg/encoding"
+)
+
+func TestHybridInterop(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("NewIdentity failed: %v", err)
+	}
+	qageRec, err := id.Recipient().String()
+	if err != nil {
+		t.Fatalf("String failed: %v", err)
+	}
+	qageKey, err := id.String()
+	if err != nil {
+		t.Fatalf("String failed: %v", err)
+	}
+	hid, err := age.GenerateHybridIdentity()
+	if err != nil {
+		t.Fatalf("GenerateHybridIdentity failed: %v", err)
+	}
+
+	recs, err := ParseRecipients(strings.NewReader(qageRec + "\n" + hid.Recipient().String() + "\n"))
+	if err != nil {
+		t.Fatalf("ParseRecipients failed: %v", err)
+	}
+	if _, ok := recs[1].(*age.HybridRecipient); !ok {
+		t.Fatalf("expected an age hybrid recipient, got %T", recs[1])
+	}
+	ids, err := ParseIdentities(strings.NewReader(hid.String() + "\n" + qageKey + "\n"))
+	if err != nil {
+		t.Fatalf("ParseIdentities failed: %v", err)
+	}
+	if got, ok := ids[0].(*age.HybridIdentity); !ok || got.String() != hid.String() {
+		t.Fatalf("unexpected first identity %#v", ids[0])
+	}
+
+	// Both are post-quantum, so age lets them share a file
+	plaintext := []byte("readable by qage and age alike")
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, recs...)
+	if err != nil {
+		t.Fatalf("age.Encrypt failed: %v", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range ids {
+		r, err := age.Decrypt(bytes.NewReader(encrypted.Bytes()), i)
+		if err != nil {
+			t.Fatalf("age.Decrypt with %T failed: %v", i, err)
+		}
+		if got, _ := io.ReadAll(r); !bytes.Equal(got, plaintext) {
+			t.Errorf("decrypted data doesn't match original")
+		}
+	}
+
+	// A qage identity skips the mlkem768x25519 stanza
+	other, err := age.GenerateHybridIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stanzas, err := other.Recipient().Wrap(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := id.Unwrap(stanzas); !errors.Is(err, age.ErrIncorrectIdentity) {
+		t.Errorf("expected ErrIncorrectIdentity, got %v", err)
+	}
+}
+
+func TestHybridIdentityConversion(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x42}, SeedSize)
+	id, err := NewIdentityFromSeed(seed, Config{})
+	if err != nil {
+		t.Fatalf("NewIdentityFromSeed failed: %v", err)
+	}
+	hid, err := id.HybridIdentity()
+	if err != nil {
+		t.Fatalf("HybridIdentity failed: %v", err)
+	}
+
+	// The age recipient holds the same keys: the ML-KEM-768 encapsulation
+	// key followed by the X25519 public key.
+	hrp, pk, err := encoding.Decode(hid.Recipient().String())
+	if err != nil || hrp != "age1pq" {
+		t.Fatalf("unexpected age recipient %q: %v", hid.Recipient(), err)
+	}
+	r := id.Recipient()
+	if !bytes.Equal(pk, append(append([]byte(nil), r.mlkemPub...), r.ecPub...)) {
+		t.Fatal("age hybrid recipient doesn't match the qage recipient keys")
+	}
+
+	// The qage identity decrypts files encrypted to the age recipient
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, hid.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := age.Decrypt(&encrypted, id); err != nil {
+		t.Errorf("age.Decrypt of an age1pq1 file failed: %v", err)
+	}
+}
+
+func TestHybridIdentityNotConvertible(t *testing.T) {
+	p384, err := NewIdentityWithConfig(Config{Suite: HybridP384MLKEM1024})
+	if err != nil {
+		t.Fatalf("NewIdentityWithConfig failed: %v", err)
+	}
+	long, err := NewIdentityFromSeed(make([]byte, LongSeedSize), Config{})
+	if err != nil {
+		t.Fatalf("NewIdentityFromSeed failed: %v", err)
+	}
+	expanded := *long
+	expanded.seed = nil
+
+	for name, id := range map[string]*Identity{"p384": p384, "long seed": long, "expanded": &expanded} {
+		if _, err := id.HybridIdentity(); !errors.Is(err, ErrNotConvertible) {
+			t.Errorf("%s: expected ErrNotConvertible, got %v", name, err)
+		}
+	}
+
+	// Without an equivalent age identity, age stanzas are simply skipped
+	hid, err := age.GenerateHybridIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stanzas, err := hid.Recipient().Wrap(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expanded.Unwrap(stanzas); !errors.Is(err, age.ErrIncorrectIdentity) {
+		t.Errorf("expected ErrIncorrectIdentity, got %v", err)
+	}
+}
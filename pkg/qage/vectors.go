@@ -0,0 +1,275 @@
+package qage
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+
+	"filippo.io/age"
+
+	"github.com/zlobste/qage/pkg/crypto"
+)
+
+// The test vectors in testdata/vectors, one file per suite, pin down the
+// key derivation, the encodings and the stanza format byte for byte, so that
+// other implementations can check themselves against qage. The file of the
+// decrypt-only legacy suite only has stanzas to reject. They are embedded
+// for SelftestVectors.
+//
+//go:embed testdata/vectors/*.json
+var vectorFiles embed.FS
+
+// vectorFile is a file of test vectors for one suite.
+type vectorFile struct {
+	Description string `json:"description"`
+
+	// Suite is the suite name, as accepted by ParseSuite, or
+	// legacyVectorSuite.
+	Suite string `json:"suite"`
+
+	Valid             []validVector   `json:"valid"`
+	InvalidStanzas    []invalidStanza `json:"invalid_stanzas"`
+	InvalidIdentities []invalidKey    `json:"invalid_identities"`
+	InvalidRecipients []invalidKey    `json:"invalid_recipients"`
+}
+
+// validVector is an identity expanded from a seed, and a stanza wrapping a
+// file key for its recipient. Binary fields are hex-encoded, except for the
+// stanza body, which is base64-encoded as in age headers.
+type validVector struct {
+	Comment     string `json:"comment"`
+	Seed        string `json:"seed"`
+	Combiner    string `json:"combiner"`
+	KeyHint     bool   `json:"key_hint"`
+	Identity    string `json:"identity"`
+	Recipient   string `json:"recipient"`
+	Fingerprint string `json:"fingerprint"`
+	FileKey     string `json:"file_key"`
+
+	// WrapRand is the randomness consumed by Wrap: the ephemeral ECDH
+	// secret key, followed by the 32-byte ML-KEM encapsulation message m.
+	WrapRand string       `json:"wrap_rand"`
+	Stanza   vectorStanza `json:"stanza"`
+}
+
+// vectorStanza is an age stanza.
+type vectorStanza struct {
+	Type string   `json:"type"`
+	Args []string `json:"args"`
+	Body string   `json:"body"`
+}
+
+// invalidStanza is a stanza that an identity must reject, either as
+// malformed or as not addressed to it.
+type invalidStanza struct {
+	Comment  string       `json:"comment"`
+	Identity string       `json:"identity"`
+	Stanza   vectorStanza `json:"stanza"`
+
+	// Result is "malformed" for ErrMalformedStanza, or
+	// "incorrect_identity" for age.ErrIncorrectIdentity.
+	Result string `json:"result"`
+}
+
+// invalidKey is an identity or recipient encoding that must be rejected.
+type invalidKey struct {
+	Comment string `json:"comment"`
+	Key     string `json:"key"`
+}
+
+// legacyVectorSuite is the suite name of the vectors of the decrypt-only
+// HybridX25519Kyber768, which ParseSuite rejects.
+const legacyVectorSuite = "x25519-kyber768"
+
+// Results of invalid stanza vectors.
+const (
+	vectorMalformed         = "malformed"
+	vectorIncorrectIdentity = "incorrect_identity"
+)
+
+// SelftestVectors checks the build against the embedded test vectors. It
+// returns the number of vectors checked and skipped: vectors of suites the
+// backend refuses, such as X25519 suites in FIPS 140-3 mode, are skipped, and
+// so are valid vectors with the stdlib backend, which can't reproduce their
+// stanza, though their keys and file key are still checked.
+func SelftestVectors() (checked, skipped int, err error) {
+	paths, err := fs.Glob(vectorFiles, "testdata/vectors/*.json")
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, path := range paths {
+		data, err := vectorFiles.ReadFile(path)
+		if err != nil {
+			return checked, skipped, err
+		}
+		var vf vectorFile
+		if err := json.Unmarshal(data, &vf); err != nil {
+			return checked, skipped, fmt.Errorf("%s: %w", path, err)
+		}
+		c, s, err := checkVectorFile(&vf, DefaultConfig().Backend)
+		checked, skipped = checked+c, skipped+s
+		if err != nil {
+			return checked, skipped, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return checked, skipped, nil
+}
+
+// checkVectorFile checks the vectors of a file with backend.
+func checkVectorFile(vf *vectorFile, backend crypto.Backend) (checked, skipped int, err error) {
+	suite := HybridX25519Kyber768
+	if vf.Suite != legacyVectorSuite {
+		if suite, err = ParseSuite(vf.Suite); err != nil {
+			return 0, 0, err
+		}
+	}
+	total := len(vf.Valid) + len(vf.InvalidStanzas) + len(vf.InvalidIdentities) + len(vf.InvalidRecipients)
+	if _, err := suite.primitives(backend); errors.Is(err, crypto.ErrNotApproved) || errors.Is(err, crypto.ErrUnsupported) {
+		return 0, total, nil
+	}
+	cfg := Config{Suite: suite, Backend: backend}
+
+	for i, v := range vf.Valid {
+		wrapped, err := checkValidVector(&v, cfg)
+		if err != nil {
+			return checked, skipped, fmt.Errorf("valid vector %d (%s): %w", i, v.Comment, err)
+		}
+		if wrapped {
+			checked++
+		} else {
+			skipped++
+		}
+	}
+	for i, v := range vf.InvalidStanzas {
+		if err := checkInvalidStanza(&v, cfg); err != nil {
+			return checked, skipped, fmt.Errorf("invalid stanza %d (%s): %w", i, v.Comment, err)
+		}
+		checked++
+	}
+	for i, v := range vf.InvalidIdentities {
+		if _, err := ParseIdentityWithConfig(v.Key, cfg); err == nil {
+			return checked, skipped, fmt.Errorf("invalid identity %d (%s): accepted", i, v.Comment)
+		}
+		checked++
+	}
+	for i, v := range vf.InvalidRecipients {
+		if _, err := ParseRecipientWithConfig(v.Key, cfg); err == nil {
+			return checked, skipped, fmt.Errorf("invalid recipient %d (%s): accepted", i, v.Comment)
+		}
+		checked++
+	}
+	return checked, skipped, nil
+}
+
+// checkValidVector checks the keys expanded from the seed of a valid vector,
+// that the stanza unwraps to the file key and, unless the backend can't wrap
+// deterministically, that Wrap reproduces the stanza. It reports whether the
+// stanza was reproduced.
+func checkValidVector(v *validVector, cfg Config) (wrapped bool, err error) {
+	seed, err := hex.DecodeString(v.Seed)
+	if err != nil {
+		return false, err
+	}
+	fileKey, err := hex.DecodeString(v.FileKey)
+	if err != nil {
+		return false, err
+	}
+	wrapRand, err := hex.DecodeString(v.WrapRand)
+	if err != nil {
+		return false, err
+	}
+	want, err := v.Stanza.stanza()
+	if err != nil {
+		return false, err
+	}
+	switch v.Combiner {
+	case CombinerConcat.String():
+		cfg.Combiner = CombinerConcat
+	case CombinerTranscript.String():
+		cfg.Combiner = CombinerTranscript
+	default:
+		return false, fmt.Errorf("unknown combiner %q", v.Combiner)
+	}
+
+	id, err := NewIdentityFromSeed(seed, cfg)
+	if err != nil {
+		return false, err
+	}
+	if s, err := id.String(); err != nil || s != v.Identity {
+		return false, fmt.Errorf("identity mismatch (%v)", err)
+	}
+	if s, err := id.Recipient().String(); err != nil || s != v.Recipient {
+		return false, fmt.Errorf("recipient mismatch (%v)", err)
+	}
+	if id.Fingerprint() != v.Fingerprint {
+		return false, errors.New("fingerprint mismatch")
+	}
+
+	fk, err := id.Unwrap([]*age.Stanza{want})
+	if err != nil {
+		return false, fmt.Errorf("unwrap failed: %w", err)
+	}
+	if !bytes.Equal(fk, fileKey) {
+		return false, errors.New("unwrapped file key mismatch")
+	}
+
+	random := bytes.NewReader(wrapRand)
+	cfg.Rand = random
+	r, err := ParseRecipientWithConfig(v.Recipient, cfg)
+	if err != nil {
+		return false, err
+	}
+	if v.KeyHint {
+		r = r.WithKeyHint()
+	}
+	stanzas, err := r.Wrap(fileKey)
+	if errors.Is(err, crypto.ErrUnsupported) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("wrap failed: %w", err)
+	}
+	got := stanzas[0]
+	if got.Type != want.Type || !slices.Equal(got.Args, want.Args) || !bytes.Equal(got.Body, want.Body) {
+		return false, errors.New("wrapped stanza mismatch")
+	}
+	if random.Len() != 0 {
+		return false, fmt.Errorf("wrap left %d bytes of randomness unused", random.Len())
+	}
+	return true, nil
+}
+
+// checkInvalidStanza checks that an identity rejects a stanza as expected.
+func checkInvalidStanza(v *invalidStanza, cfg Config) error {
+	id, err := ParseIdentityWithConfig(v.Identity, cfg)
+	if err != nil {
+		return err
+	}
+	s, err := v.Stanza.stanza()
+	if err != nil {
+		return err
+	}
+	_, err = id.Unwrap([]*age.Stanza{s})
+	switch {
+	case v.Result == vectorMalformed && errors.Is(err, ErrMalformedStanza):
+	case v.Result == vectorIncorrectIdentity && errors.Is(err, age.ErrIncorrectIdentity):
+	default:
+		return fmt.Errorf("expected %s, got %v", v.Result, err)
+	}
+	return nil
+}
+
+// stanza decodes the stanza.
+func (s *vectorStanza) stanza() (*age.Stanza, error) {
+	body, err := base64.RawStdEncoding.Strict().DecodeString(s.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stanza body: %w", err)
+	}
+	return &age.Stanza{Type: s.Type, Args: s.Args, Body: body}, nil
+}
@@ -0,0 +1,520 @@
+package qage
+
+import (
+	"bytes"
+	"crypto/sha3"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/zlobste/qage/pkg/crypto"
+	"github.com/zlobste/qage/pkg/encoding"
+)
+
+var updateVectors = flag.Bool("update-vectors", false, "regenerate testdata/vectors")
+
+// vectorsDescription is the description of every test vector file.
+const vectorsDescription = `qage test vectors for one suite. Each valid vector expands an identity from a seed with NewIdentityFromSeed, and wraps file_key for its recipient, reading wrap_rand as randomness: the ephemeral ECDH secret key (re-read while it is not a valid scalar), then the 32-byte ML-KEM encapsulation message m. Binary fields are hex, stanza bodies base64 without padding as in age headers. invalid_stanzas must be rejected by the given identity, as malformed (qage.ErrMalformedStanza) or as not addressed to it (age.ErrIncorrectIdentity). invalid_identities and invalid_recipients must fail to parse.`
+
+// legacyVectorsDescription is the description of the vector file of the
+// legacy suite.
+const legacyVectorsDescription = `qage test vectors for the decrypt-only X25519+Kyber768 suite of earlier releases, whose identities use expanded round-3 Kyber768 secret keys and read unauthenticated "h1" and authenticated "h2" stanzas. invalid_stanzas must be rejected by the given identity, as malformed (qage.ErrMalformedStanza) or as not addressed to it (age.ErrIncorrectIdentity). Binary fields are hex, stanza bodies base64 without padding as in age headers.`
+
+func TestVectors(t *testing.T) {
+	for _, suite := range []Suite{HybridX25519MLKEM768, HybridP384MLKEM1024, HybridX25519Kyber768} {
+		params, err := suite.params()
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, generate := params.stanzaTag, generateVectors
+		if suite == HybridX25519Kyber768 {
+			name, generate = legacyVectorSuite, func(t *testing.T, _ Suite) *vectorFile { return generateLegacyVectors(t) }
+		}
+		path := filepath.Join("testdata", "vectors", name+".json")
+		if *updateVectors {
+			data, err := json.MarshalIndent(generate(t, suite), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vf vectorFile
+		if err := json.Unmarshal(data, &vf); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		total := len(vf.Valid) + len(vf.InvalidStanzas) + len(vf.InvalidIdentities) + len(vf.InvalidRecipients)
+		checked, skipped, err := checkVectorFile(&vf, crypto.Circl())
+		if err != nil || checked != total || skipped != 0 {
+			t.Errorf("%s: circl checked %d of %d vectors: %v", path, checked, total, err)
+		}
+		if suite == HybridX25519Kyber768 {
+			// Only circl has Kyber768
+			if len(vf.InvalidStanzas) == 0 {
+				t.Fatalf("%s: missing vectors", path)
+			}
+			checked, skipped, err = checkVectorFile(&vf, crypto.Stdlib())
+			if err != nil || checked != 0 || skipped != total {
+				t.Errorf("%s: stdlib checked %d of %d vectors: %v", path, checked, total, err)
+			}
+			continue
+		}
+		if len(vf.Valid) == 0 || len(vf.InvalidStanzas) == 0 || len(vf.InvalidIdentities) == 0 || len(vf.InvalidRecipients) == 0 {
+			t.Fatalf("%s: missing vectors", path)
+		}
+
+		// The stdlib backend can't reproduce the stanzas, but checks the rest
+		checked, skipped, err = checkVectorFile(&vf, crypto.Stdlib())
+		if err != nil || checked != total-len(vf.Valid) || skipped != len(vf.Valid) {
+			t.Errorf("%s: stdlib checked %d of %d vectors: %v", path, checked, total, err)
+		}
+
+		// A vector that doesn't match is reported
+		broken := vf
+		broken.Valid = slices.Clone(vf.Valid)
+		broken.Valid[0].FileKey = strings.Repeat("00", 16)
+		if _, _, err := checkVectorFile(&broken, crypto.Circl()); err == nil {
+			t.Errorf("%s: expected an error for a wrong file key", path)
+		}
+		broken.Valid[0] = vf.Valid[0]
+		broken.Valid[0].WrapRand += "00"
+		if _, _, err := checkVectorFile(&broken, crypto.Circl()); err == nil {
+			t.Errorf("%s: expected an error for unused randomness", path)
+		}
+	}
+
+	checked, skipped, err := SelftestVectors()
+	if err != nil || checked == 0 || skipped != 0 {
+		t.Errorf("SelftestVectors checked %d vectors, skipped %d: %v", checked, skipped, err)
+	}
+}
+
+func TestDeterministicRand(t *testing.T) {
+	cfg := Config{Rand: bytes.NewReader(bytes.Repeat([]byte{1}, SeedSize))}
+	a, err := NewIdentityWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewIdentityWithConfig failed: %v", err)
+	}
+	b, err := NewIdentityFromSeed(bytes.Repeat([]byte{1}, SeedSize), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mustString(t, a.Recipient()) != mustString(t, b.Recipient()) {
+		t.Error("identity doesn't come from Config.Rand")
+	}
+	if _, err := NewIdentityWithConfig(Config{Rand: bytes.NewReader(nil)}); err == nil {
+		t.Error("expected an error for exhausted randomness")
+	}
+
+	// Recipients wrap with the randomness of their configuration, and the
+	// threshold recipient with that of its first recipient
+	other, err := NewIdentityFromSeed(bytes.Repeat([]byte{2}, SeedSize), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrap := func(backend crypto.Backend) ([]*age.Stanza, error) {
+		rand := sha3.NewSHAKE256()
+		rand.Write([]byte("deterministic"))
+		cfg := Config{Rand: rand, Backend: backend}
+		var rs []*Recipient
+		for _, id := range []*Identity{a, other} {
+			r, err := ParseRecipientWithConfig(mustString(t, id.Recipient()), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs = append(rs, r)
+		}
+		tr, err := NewThresholdRecipient(2, rs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr.Wrap(bytes.Repeat([]byte{2}, 16))
+	}
+	first, err := wrap(crypto.Circl())
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	second, err := wrap(crypto.Circl())
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	for i := range first {
+		if !slices.Equal(first[i].Args, second[i].Args) || !bytes.Equal(first[i].Body, second[i].Body) {
+			t.Errorf("stanza %d differs between wraps with the same randomness", i)
+		}
+	}
+	if _, err := wrap(crypto.Stdlib()); !errors.Is(err, crypto.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported from the stdlib backend, got %v", err)
+	}
+}
+
+// generateVectors generates the test vectors of a suite, with randomness
+// derived from their comment.
+func generateVectors(t *testing.T, suite Suite) *vectorFile {
+	t.Helper()
+	p, err := suite.primitives(crypto.Circl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vf := &vectorFile{Description: vectorsDescription, Suite: p.stanzaTag}
+
+	var ids []*Identity
+	for _, c := range []struct {
+		comment  string
+		seedSize int
+		combiner Combiner
+		keyHint  bool
+	}{
+		{"32-byte seed", SeedSize, CombinerTranscript, false},
+		{"64-byte seed, as derived from a recovery phrase", LongSeedSize, CombinerTranscript, false},
+		{"concat combiner", SeedSize, CombinerConcat, false},
+		{"key hint", SeedSize, CombinerTranscript, true},
+	} {
+		rand := sha3.NewSHAKE256()
+		rand.Write([]byte("qage test vectors/" + p.stanzaTag + "/" + c.comment))
+		seed := make([]byte, c.seedSize)
+		fileKey := make([]byte, 16)
+		rand.Read(seed)
+		rand.Read(fileKey)
+
+		cfg := Config{Suite: suite, Combiner: c.combiner, Backend: crypto.Circl()}
+		id, err := NewIdentityFromSeed(seed, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		var wrapRand bytes.Buffer
+		cfg.Rand = io.TeeReader(rand, &wrapRand)
+		r, err := ParseRecipientWithConfig(mustString(t, id.Recipient()), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.keyHint {
+			r = r.WithKeyHint()
+		}
+		stanzas, err := r.Wrap(fileKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identity, err := id.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		vf.Valid = append(vf.Valid, validVector{
+			Comment:     c.comment,
+			Seed:        hex.EncodeToString(seed),
+			Combiner:    c.combiner.String(),
+			KeyHint:     c.keyHint,
+			Identity:    identity,
+			Recipient:   mustString(t, id.Recipient()),
+			Fingerprint: id.Fingerprint(),
+			FileKey:     hex.EncodeToString(fileKey),
+			WrapRand:    hex.EncodeToString(wrapRand.Bytes()),
+			Stanza:      newVectorStanza(stanzas[0]),
+		})
+	}
+
+	// Invalid stanzas are variations of the stanzas of the first identity
+	identity := vf.Valid[0].Identity
+	pointSize, ctSize := p.dh.PublicKeySize(), p.kem.CiphertextSize()
+	invalid := func(comment, result string, v *validVector, f func(s *age.Stanza)) {
+		s, err := v.Stanza.stanza()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Args = slices.Clone(s.Args)
+		f(s)
+		vf.InvalidStanzas = append(vf.InvalidStanzas, invalidStanza{
+			Comment:  comment,
+			Identity: identity,
+			Stanza:   newVectorStanza(s),
+			Result:   result,
+		})
+	}
+	transcript, other, hinted := &vf.Valid[0], &vf.Valid[1], &vf.Valid[3]
+	invalid("stanza for another identity", vectorIncorrectIdentity, other, func(s *age.Stanza) {})
+	invalid("other stanza type", vectorIncorrectIdentity, transcript, func(s *age.Stanza) { s.Type = "X25519" })
+	invalid("stanza of another suite", vectorIncorrectIdentity, transcript, func(s *age.Stanza) {
+		s.Args[0] = map[string]string{stanzaX25519MLKEM768: stanzaP384MLKEM1024, stanzaP384MLKEM1024: stanzaX25519MLKEM768}[s.Args[0]]
+	})
+	invalid("unknown combiner", vectorIncorrectIdentity, transcript, func(s *age.Stanza) { s.Args[1] = "c9" })
+	invalid("combiner argument removed", vectorIncorrectIdentity, transcript, func(s *age.Stanza) { s.Args = s.Args[:1] })
+	invalid("no arguments", vectorMalformed, transcript, func(s *age.Stanza) { s.Args = nil })
+	invalid("four arguments", vectorMalformed, hinted, func(s *age.Stanza) { s.Args = append(s.Args, "extra") })
+	invalid("invalid key hint", vectorMalformed, hinted, func(s *age.Stanza) { s.Args[2] = "not-a-hint" })
+	invalid("key hint of another identity", vectorIncorrectIdentity, hinted, func(s *age.Stanza) {
+		s.Args[2] = ids[1].Recipient().stanzaKeyHint(s.Body[:pointSize])
+	})
+	invalid("body shorter than the ephemeral share and ciphertext", vectorMalformed, transcript, func(s *age.Stanza) {
+		s.Body = s.Body[:pointSize+ctSize-1]
+	})
+	invalid("body without a sealed file key", vectorMalformed, transcript, func(s *age.Stanza) {
+		s.Body = s.Body[:pointSize+ctSize+16]
+	})
+	invalid("invalid ephemeral share", vectorMalformed, transcript, func(s *age.Stanza) {
+		s.Body = slices.Clone(s.Body)
+		clear(s.Body[:pointSize])
+	})
+	invalid("tampered ML-KEM ciphertext", vectorIncorrectIdentity, transcript, func(s *age.Stanza) {
+		s.Body = slices.Clone(s.Body)
+		s.Body[pointSize] ^= 1
+	})
+	invalid("tampered sealed file key", vectorIncorrectIdentity, transcript, func(s *age.Stanza) {
+		s.Body = slices.Clone(s.Body)
+		s.Body[len(s.Body)-1] ^= 1
+	})
+	_, legacy := generateLegacyStanzas(t, "legacy identity")
+	for _, s := range legacy {
+		vf.InvalidStanzas = append(vf.InvalidStanzas, invalidStanza{
+			Comment:  "Kyber768 " + s.Args[0] + " stanza of a legacy identity",
+			Identity: identity,
+			Stanza:   newVectorStanza(s),
+			Result:   vectorIncorrectIdentity,
+		})
+	}
+
+	// Invalid keys are variations of the encodings of the first identity
+	_, idData, err := encoding.Decode(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, recData, err := encoding.Decode(vf.Valid[0].Recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(hrp string, data []byte) string {
+		s, err := encoding.Encode(hrp, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	compact := idData[0]
+	vf.InvalidIdentities = []invalidKey{
+		{"bad checksum", badChecksum(identity)},
+		{"recipient prefix", encode(encoding.HRPPublic, idData)},
+		{"unknown suite", encode(encoding.HRPSecret, append([]byte{compact&^0x80 + 8}, idData[1:]...))},
+		{"compact identity of the decrypt-only Kyber768 suite", encode(encoding.HRPSecret, append([]byte{byte(HybridX25519Kyber768) | 0x80}, idData[1:]...))},
+		{"33-byte seed", encode(encoding.HRPSecret, append(slices.Clone(idData), 0))},
+		{"expanded identity without its last byte", encode(encoding.HRPSecret, append([]byte{compact &^ 0x80}, make([]byte, p.dh.PrivateKeySize()+p.kem.PrivateKeySize()-1)...))},
+		{"expanded identity whose ML-KEM secret key doesn't match its embedded public key hash", expandedIdentity(t, p, ids[0], func(dk []byte) {
+			// The decapsulation key ends with H(ek) and z
+			dk[len(dk)-33] ^= 1
+		})},
+	}
+	rec, err := encoding.ParseRecipient(vf.Valid[0].Recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodeRecipient := func(f func(r *encoding.Recipient)) string {
+		r := *rec
+		r.P384Pub, r.MLKEMPub = slices.Clone(rec.P384Pub), slices.Clone(rec.MLKEMPub)
+		f(&r)
+		s, err := encoding.EncodeRecipient(&r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	vf.InvalidRecipients = []invalidKey{
+		{"bad checksum", badChecksum(vf.Valid[0].Recipient)},
+		{"identity prefix", encode(encoding.HRPSecret, recData)},
+		{"unknown suite", encode(encoding.HRPPublic, append([]byte{recData[0] + 8}, recData[1:]...))},
+		{"ML-KEM public key without its last byte", encode(encoding.HRPPublic, recData[:len(recData)-1])},
+		{"ML-KEM public key with a coefficient not reduced modulo q", encodeRecipient(func(r *encoding.Recipient) {
+			r.MLKEMPub[0], r.MLKEMPub[1] = 0xff, r.MLKEMPub[1]|0x0f
+		})},
+	}
+	if suite == HybridP384MLKEM1024 {
+		vf.InvalidRecipients = append(vf.InvalidRecipients, invalidKey{"P-384 point not on the curve", encodeRecipient(func(r *encoding.Recipient) {
+			r.P384Pub[len(r.P384Pub)-1] ^= 1
+		})})
+	}
+	return vf
+}
+
+// expandedIdentity returns the expanded encoding of id, with its ML-KEM
+// decapsulation key changed by f.
+func expandedIdentity(t *testing.T, p *suitePrimitives, id *Identity, f func(dk []byte)) string {
+	t.Helper()
+	sk, err := id.kemPrivateKey(p.kem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dk, err := sk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dk = slices.Clone(dk)
+	f(dk)
+	enc := &encoding.Identity{Suite: encoding.Suite(id.suite), MLKEMSecret: dk}
+	if id.suite == HybridP384MLKEM1024 {
+		enc.P384Secret = id.ecSecret
+	} else {
+		enc.X25519Secret = [32]byte(id.ecSecret)
+	}
+	s, err := encoding.EncodeIdentity(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// generateLegacyVectors generates the test vectors of the legacy suite.
+// Since it is decrypt-only, they are stanzas to reject, written with the
+// format of earlier releases.
+func generateLegacyVectors(t *testing.T) *vectorFile {
+	t.Helper()
+	p, err := HybridX25519Kyber768.primitives(crypto.Circl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vf := &vectorFile{
+		Description:       legacyVectorsDescription,
+		Suite:             legacyVectorSuite,
+		Valid:             []validVector{},
+		InvalidIdentities: []invalidKey{},
+		InvalidRecipients: []invalidKey{},
+	}
+
+	identity, stanzas := generateLegacyStanzas(t, "legacy identity")
+	_, other := generateLegacyStanzas(t, "another legacy identity")
+	h1, h2 := stanzas[0], stanzas[1]
+	pointSize, ctSize := p.dh.PublicKeySize(), p.kem.CiphertextSize()
+	invalid := func(comment, result string, s *age.Stanza, f func(s *age.Stanza)) {
+		s = &age.Stanza{Type: s.Type, Args: slices.Clone(s.Args), Body: slices.Clone(s.Body)}
+		f(s)
+		vf.InvalidStanzas = append(vf.InvalidStanzas, invalidStanza{
+			Comment:  comment,
+			Identity: identity,
+			Stanza:   newVectorStanza(s),
+			Result:   result,
+		})
+	}
+	invalid("h2 stanza for another identity", vectorIncorrectIdentity, other[1], func(s *age.Stanza) {})
+	invalid("unknown legacy version", vectorIncorrectIdentity, h2, func(s *age.Stanza) { s.Args[0] = "h3" })
+	invalid("h1 stanza with a combiner argument", vectorMalformed, h1, func(s *age.Stanza) { s.Args = append(s.Args, stanzaCombinerTranscript) })
+	invalid("h2 stanza with an unknown combiner", vectorIncorrectIdentity, h2, func(s *age.Stanza) { s.Args = append(s.Args, "c9") })
+	invalid("h1 body shorter than the ephemeral share and ciphertext", vectorMalformed, h1, func(s *age.Stanza) {
+		s.Body = s.Body[:pointSize+ctSize-1]
+	})
+	invalid("h2 body without a sealed file key", vectorMalformed, h2, func(s *age.Stanza) {
+		s.Body = s.Body[:pointSize+ctSize+16]
+	})
+	invalid("tampered h2 sealed file key", vectorIncorrectIdentity, h2, func(s *age.Stanza) {
+		s.Body[len(s.Body)-1] ^= 1
+	})
+	return vf
+}
+
+// generateLegacyStanzas generates an X25519+Kyber768 identity as created by
+// earlier releases, and an "h1" and an "h2" stanza wrapping a file key for
+// it, with randomness derived from comment.
+func generateLegacyStanzas(t *testing.T, comment string) (identity string, stanzas []*age.Stanza) {
+	t.Helper()
+	p, err := HybridX25519Kyber768.primitives(crypto.Circl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rand := sha3.NewSHAKE256()
+	rand.Write([]byte("qage test vectors/" + legacyVectorSuite + "/" + comment))
+
+	ecSecret, ecPub, err := p.dh.GenerateKey(rand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := make([]byte, p.kem.SeedSize())
+	rand.Read(seed)
+	sk, err := p.kem.NewPrivateKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dk, err := sk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err = encoding.EncodeIdentity(&encoding.Identity{
+		Suite:        encoding.HybridX25519Kyber768,
+		X25519Secret: [32]byte(ecSecret),
+		MLKEMSecret:  dk,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileKey := make([]byte, 16)
+	rand.Read(fileKey)
+	for _, tag := range []string{stanzaH1, stanzaH2} {
+		ephSecret, ephPub, err := p.dh.GenerateKey(rand)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z1, err := p.dh.ECDH(ephSecret, ecPub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct, z2, err := p.kem.Encapsulate(sk.PublicKey(), rand)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrapKey, err := deriveWrapKey(p.backend, z1, z2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := append(slices.Clone(ephPub), ct...)
+		if tag == stanzaH1 {
+			for i := range fileKey {
+				body = append(body, fileKey[i]^wrapKey[i%len(wrapKey)])
+			}
+		} else {
+			sealed, err := aeadSeal(wrapKey, fileKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = append(body, sealed...)
+		}
+		stanzas = append(stanzas, &age.Stanza{Type: stanzaType, Args: []string{tag}, Body: body})
+	}
+
+	// The stanzas must be valid for the identity to be worth rejecting
+	// variations of
+	id, err := ParseIdentityWithConfig(identity, Config{Backend: crypto.Circl()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stanzas {
+		if fk, err := id.UnwrapStanza(s); err != nil || !bytes.Equal(fk, fileKey) {
+			t.Fatalf("legacy %s stanza doesn't unwrap: %v", s.Args[0], err)
+		}
+	}
+	return identity, stanzas
+}
+
+func newVectorStanza(s *age.Stanza) vectorStanza {
+	return vectorStanza{Type: s.Type, Args: s.Args, Body: base64.RawStdEncoding.EncodeToString(s.Body)}
+}
+
+// badChecksum changes the last character of a bech32 string.
+func badChecksum(s string) string {
+	last := 'q'
+	if s[len(s)-1] == 'q' {
+		last = 'p'
+	}
+	return s[:len(s)-1] + string(last)
+}